@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"math/big"
 
-	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/params"
 	_ "github.com/mattn/go-sqlite3"
 	watchtheburn "github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
@@ -53,7 +52,7 @@ func main() {
 		}
 	}
 
-	queryAll := "SELECT * FROM block_stats"
+	queryAll := "SELECT number, timestamp, base_fee, burned, gas_target, gas_used, priority_fee, rewards, tips, transactions, type2_transactions FROM block_stats"
 	rows, err := db.Query(queryAll)
 	if err != nil {
 		panic(err)
@@ -124,10 +123,7 @@ func (b *BlocksFull) Initialize(count uint) {
 func (b *BlocksFull) ProcessBlock(block watchtheburn.BlockStats) error {
 	b.totalBlocks++
 
-	blockstats, err := b.decodeBlockStats(block)
-	if err != nil {
-		return err
-	}
+	blockstats := b.decodeBlockStats(block)
 	
 	b.storePercentage(*blockstats, 90)
 	b.storePercentage(*blockstats, 95)
@@ -280,71 +276,26 @@ func (b *BlocksFull) updateComplexRecord(complex ComplexRecord, value big.Int) C
 	return complex
 }
 
-func (b *BlocksFull) decodeBlockStats(block watchtheburn.BlockStats) (*WatchTheBurnBlockStat, error) {
-	baseFee, err := hexutil.DecodeBig(block.BaseFee)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode BaseFee: %v", err)
-	}
-
-	burned, err := hexutil.DecodeBig(block.Burned)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode Burned: %v", err)
-	}
-
-	gasTarget, err := hexutil.DecodeUint64(block.GasTarget)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode GasTarget: %v", err)
-	}
-
-	gasUsed, err := hexutil.DecodeUint64(block.GasUsed)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode GasUsed: %v", err)
-	}
-
-	priorityFee, err := hexutil.DecodeBig(block.PriorityFee)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode PriorityFee: %v", err)
-	}
-
-	rewards, err := hexutil.DecodeBig(block.Rewards)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode Rewards: %v", err)
-	}
-
-	tips, err := hexutil.DecodeBig(block.Tips)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode Tips: %v", err)
-	}
-
-	transactions, err := hexutil.DecodeUint64(block.Transactions)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode Transactions: %v", err)
-	}
-
-	type2Transactions, err := hexutil.DecodeUint64(block.Type2Transactions)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode Type2Transactions: %v", err)
-	}
-
+func (b *BlocksFull) decodeBlockStats(block watchtheburn.BlockStats) *WatchTheBurnBlockStat {
 	var gasUsedPercentage float64
-	if gasTarget == 0 {
+	if block.GasTarget == 0 {
 		gasUsedPercentage = 0.0
 	} else {
-		gasUsedPercentage = float64(gasUsed) / float64(gasTarget * 2) * 100
+		gasUsedPercentage = float64(block.GasUsed) / float64(block.GasTarget * 2) * 100
 	}
 
 	return &WatchTheBurnBlockStat{
 		Number: block.Number,
-		BaseFee: *baseFee,
-		Burned: *burned,
-		GasTarget: gasTarget,
-		GasUsed: gasUsed,
-		PriorityFee: *priorityFee,
-		Rewards: *rewards,
-		Tips: *tips,
-		Transactions: transactions,
-		Type2Transactions: type2Transactions,
+		BaseFee: *block.BaseFee.ToInt(),
+		Burned: *block.Burned.ToInt(),
+		GasTarget: uint64(block.GasTarget),
+		GasUsed: uint64(block.GasUsed),
+		PriorityFee: *block.PriorityFee.ToInt(),
+		Rewards: *block.Rewards.ToInt(),
+		Tips: *block.Tips.ToInt(),
+		Transactions: uint64(block.Transactions),
+		Type2Transactions: uint64(block.Type2Transactions),
 		Timestamp: block.Timestamp,
 		GasUsedPercentage: gasUsedPercentage,
-	}, nil
+	}
 }
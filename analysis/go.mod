@@ -3,7 +3,9 @@ module github.com/mohamedmansour/ethereum-burn-stats/analysis
 go 1.16
 
 require (
-	github.com/ethereum/go-ethereum v1.10.9 // indirect
+	github.com/ethereum/go-ethereum v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.8
-	github.com/mohamedmansour/ethereum-burn-stats/daemon v0.0.0-20210929233232-a8ed04012aba // indirect
+	github.com/mohamedmansour/ethereum-burn-stats/daemon v0.0.0-20210929233232-a8ed04012aba
 )
+
+replace github.com/mohamedmansour/ethereum-burn-stats/daemon => ../daemon
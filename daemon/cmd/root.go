@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/mohamedmansour/ethereum-burn-stats/daemon/hub"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/network"
 	"github.com/spf13/cobra"
 )
 
@@ -14,8 +16,14 @@ func newRootCmd() *cobra.Command {
 	var gethEndpointHTTP string
 	var gethEndpointWebsocket string
 	var dbPath string
-	var ropsten bool
+	var networkName string
+	var networkConfigPath string
 	var workerCount int
+	var beaconEndpoint string
+	var readOnly bool
+	var health hub.HealthConfig
+	var priceSourceSpecs []string
+	var currencies []string
 
 	rootCmd := &cobra.Command{
 		// TODO:
@@ -24,12 +32,12 @@ func newRootCmd() *cobra.Command {
 		Short: "short",
 		Long:  `long`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if gethEndpointHTTP == "" {
+			if gethEndpointHTTP == "" && !readOnly {
 				cmd.Help()
 				return fmt.Errorf("--geth-endpoint-http is required")
 			}
 
-			if gethEndpointWebsocket == "" {
+			if gethEndpointWebsocket == "" && !readOnly {
 				cmd.Help()
 				return fmt.Errorf("--geth-endpoint-websocket is required")
 			}
@@ -39,6 +47,16 @@ func newRootCmd() *cobra.Command {
 				return fmt.Errorf("--geth-endpoint-websocket is required")
 			}
 
+			networkConfig, err := network.Load(networkName, networkConfigPath)
+			if err != nil {
+				return err
+			}
+
+			priceSources, err := hub.NewPriceSources(priceSourceSpecs)
+			if err != nil {
+				return err
+			}
+
 			return root(
 				addr,
 				debug,
@@ -46,8 +64,13 @@ func newRootCmd() *cobra.Command {
 				gethEndpointHTTP,
 				gethEndpointWebsocket,
 				dbPath,
-				ropsten,
+				networkConfig,
 				workerCount,
+				beaconEndpoint,
+				readOnly,
+				health,
+				priceSources,
+				currencies,
 			)
 		},
 	}
@@ -57,9 +80,21 @@ func newRootCmd() *cobra.Command {
 	rootCmd.Flags().BoolVar(&development, "development", true, "enable for development mode")
 	rootCmd.Flags().StringVar(&gethEndpointHTTP, "geth-endpoint-http", "http://localhost:8545", "Endpoint to geth for http")
 	rootCmd.Flags().StringVar(&gethEndpointWebsocket, "geth-endpoint-websocket", "ws://localhost:8546", "Endpoint to geth for websocket")
-	rootCmd.Flags().StringVar(&dbPath, "db-path", "watchtheburn.db", "Path to the SQLite db")
+	rootCmd.Flags().StringVar(&dbPath, "db-path", "watchtheburn.db", "Path to the SQLite db, or a postgres:// DSN")
 	rootCmd.Flags().IntVar(&workerCount, "worker-count", 10, "Number of workers to spawn to parallelize http client")
-	rootCmd.Flags().BoolVar(&ropsten, "ropsten", false, "Use ropsten block numbers")
+	rootCmd.Flags().StringVar(&networkName, "network", "mainnet", fmt.Sprintf("Network profile to use, one of %v", network.Names()))
+	rootCmd.Flags().StringVar(&networkConfigPath, "network-config", "", "Path to a JSON network config, overrides --network")
+	rootCmd.Flags().StringVar(&beaconEndpoint, "beacon-endpoint", "", "Endpoint to a beacon node API to include consensus layer issuance after the merge")
+	rootCmd.Flags().BoolVar(&readOnly, "read-only", false, "Serve the blocks another daemon writes to the database, without connecting to geth")
+	rootCmd.Flags().DurationVar(&health.ReadyHeadAge, "ready-max-head-age", 2*time.Minute, "Time without a new block after which /readyz fails, 0 to disable")
+	rootCmd.Flags().DurationVar(&health.LiveHeadAge, "live-max-head-age", 10*time.Minute, "Time without a new block after which /livez fails, 0 to disable")
+	rootCmd.Flags().StringSliceVar(&priceSourceSpecs, "price-sources", hub.DefaultPriceSources, "Sources the prices are the median of, a source can be followed by =URL to override its endpoint, with {CURRENCY} or {currency} in place of the quote currency")
+	rootCmd.Flags().StringSliceVar(&currencies, "currencies", hub.DefaultCurrencies, "Quote currencies the ETH price is watched in, USD is always included")
+	rootCmd.Flags().DurationVar(&health.ReadyPriceAge, "ready-max-price-age", 15*time.Minute, "Age of the USD price after which /readyz fails, 0 to disable")
+
+	rootCmd.AddCommand(newBackfillCmd())
+	rootCmd.AddCommand(newReprocessCmd())
+	rootCmd.AddCommand(newImportPricesCmd())
 
 	return rootCmd
 }
@@ -71,8 +106,13 @@ func root(
 	gethEndpointHTTP string,
 	gethEndpointWebsocket string,
 	dbPath string,
-	ropsten bool,
+	networkConfig *network.Config,
 	workerCount int,
+	beaconEndpoint string,
+	readOnly bool,
+	health hub.HealthConfig,
+	priceSources []hub.PriceSource,
+	currencies []string,
 ) error {
 	hub, err := hub.New(
 		debug,
@@ -80,8 +120,13 @@ func root(
 		gethEndpointHTTP,
 		gethEndpointWebsocket,
 		dbPath,
-		ropsten,
+		networkConfig,
 		workerCount,
+		beaconEndpoint,
+		readOnly,
+		health,
+		priceSources,
+		currencies,
 	)
 	if err != nil {
 		return err
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/hub"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/network"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// statsOptions are the flags shared by the commands that write blocks to the
+// database and exit.
+type statsOptions struct {
+	debug             bool
+	gethEndpointHTTP  string
+	dbPath            string
+	networkName       string
+	networkConfigPath string
+	workerCount       int
+	beaconEndpoint    string
+	from              uint64
+	to                uint64
+}
+
+func (o *statsOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&o.debug, "debug", false, "enable debug logs")
+	cmd.Flags().StringVar(&o.gethEndpointHTTP, "geth-endpoint-http", "http://localhost:8545", "Endpoint to geth for http")
+	cmd.Flags().StringVar(&o.dbPath, "db-path", "watchtheburn.db", "Path to the SQLite db, or a postgres:// DSN")
+	cmd.Flags().IntVar(&o.workerCount, "worker-count", 10, "Number of workers to spawn to parallelize http client")
+	cmd.Flags().StringVar(&o.networkName, "network", "mainnet", fmt.Sprintf("Network profile to use, one of %v", network.Names()))
+	cmd.Flags().StringVar(&o.networkConfigPath, "network-config", "", "Path to a JSON network config, overrides --network")
+	cmd.Flags().StringVar(&o.beaconEndpoint, "beacon-endpoint", "", "Endpoint to a beacon node API to include consensus layer issuance after the merge")
+	cmd.Flags().Uint64Var(&o.from, "from", 0, "First block of the range, defaults to the london block")
+	cmd.Flags().Uint64Var(&o.to, "to", 0, "Last block of the range, defaults to the latest block")
+}
+
+func (o *statsOptions) newStats() (*hub.Stats, error) {
+	if o.debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	networkConfig, err := network.Load(o.networkName, o.networkConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return hub.NewStats(
+		o.gethEndpointHTTP,
+		o.dbPath,
+		networkConfig,
+		o.workerCount,
+		o.beaconEndpoint,
+	)
+}
+
+func newBackfillCmd() *cobra.Command {
+	var o statsOptions
+
+	backfillCmd := &cobra.Command{
+		Use:   "backfill",
+		Short: "Fetch the blocks of a range missing from the database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.newStats()
+			if err != nil {
+				return err
+			}
+
+			err = s.Backfill(o.from, o.to)
+			if err != nil {
+				return err
+			}
+
+			return s.RebuildTotals(o.from)
+		},
+	}
+
+	o.addFlags(backfillCmd)
+
+	return backfillCmd
+}
+
+func newReprocessCmd() *cobra.Command {
+	var o statsOptions
+	var force bool
+
+	reprocessCmd := &cobra.Command{
+		Use:   "reprocess",
+		Short: "Fetch the blocks of a range again and overwrite them in the database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.newStats()
+			if err != nil {
+				return err
+			}
+
+			err = s.Reprocess(o.from, o.to, force)
+			if err != nil {
+				return err
+			}
+
+			return s.RebuildTotals(o.from)
+		},
+	}
+
+	o.addFlags(reprocessCmd)
+	reprocessCmd.Flags().BoolVar(&force, "force", false, "Bypass the cache and fetch every block from geth")
+
+	return reprocessCmd
+}
+
+func newImportPricesCmd() *cobra.Command {
+	var o statsOptions
+	var file string
+	var source string
+	var duration time.Duration
+	var overwrite bool
+
+	importPricesCmd := &cobra.Command{
+		Use:   "import-prices",
+		Short: "Import ETH/USD candles from a CSV file and record their price in the blocks produced during them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			s, err := o.newStats()
+			if err != nil {
+				return err
+			}
+
+			if source == "" {
+				source = filepath.Base(file)
+			}
+
+			err = s.ImportUSDPrices(f, source, uint64(duration.Seconds()), o.from, o.to, overwrite)
+			if err != nil {
+				return err
+			}
+
+			return s.RebuildTotals(o.from)
+		},
+	}
+
+	o.addFlags(importPricesCmd)
+	importPricesCmd.Flags().StringVar(&file, "file", "", "Path to a CSV file with a header, whose candles have a time column and a close column")
+	importPricesCmd.Flags().StringVar(&source, "source", "", "Name the prices are stored with, defaults to the name of the file")
+	importPricesCmd.Flags().DurationVar(&duration, "candle-duration", 0, "Duration of a candle, defaults to the shortest time between two candles")
+	importPricesCmd.Flags().BoolVar(&overwrite, "overwrite", false, "Replace the price already recorded in the blocks, like the live one")
+	importPricesCmd.MarkFlagRequired("file")
+
+	return importPricesCmd
+}
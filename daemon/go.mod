@@ -5,9 +5,12 @@ go 1.16
 require (
 	github.com/ethereum/go-ethereum v1.10.6
 	github.com/gorilla/websocket v1.4.2
+	github.com/holiman/uint256 v1.2.0
 	github.com/mattn/go-sqlite3 v1.14.8 // indirect
+	github.com/prometheus/client_golang v1.11.1
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v1.2.1
+	gorm.io/driver/postgres v1.1.0
 	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.12
 )
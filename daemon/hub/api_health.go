@@ -2,27 +2,215 @@ package hub
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sync"
+	"time"
 )
 
 type Health struct {
 	Status string `json:"status"`
-	Blocks int `json:"blocks`
+	Blocks int    `json:"blocks"`
 }
 
-func (h *Hub) serveHealth(w http.ResponseWriter, r *http.Request) {
-	h.s.statsByBlock.mu.Lock()
-	defer h.s.statsByBlock.mu.Unlock()
+// HealthConfig defines the thresholds past which the daemon is reported as
+// not ready or not live, a zero threshold is not checked.
+type HealthConfig struct {
+	// ReadyHeadAge is how long after the last processed head the daemon
+	// stops taking traffic.
+	ReadyHeadAge time.Duration
+
+	// LiveHeadAge is how long after the last processed head the daemon is
+	// considered stuck and must be restarted.
+	LiveHeadAge time.Duration
+
+	// ReadyPriceAge is how old the USD price can be while taking traffic.
+	ReadyPriceAge time.Duration
+}
+
+// HealthState defines the mutexed state of the daemon reported by the health
+// checks.
+type HealthState struct {
+	mu          sync.RWMutex
+	initialized bool
+	syncing     *Syncing
+	following   bool
+	subscribed  bool
+	lastHead    time.Time
+	dbError     error
+}
+
+// HealthReport type represents the response of /livez and /readyz.
+type HealthReport struct {
+	Status          string   `json:"status"`
+	Failures        []string `json:"failures"`
+	Initialized     bool     `json:"initialized"`
+	Syncing         *Syncing `json:"syncing"`
+	NodeConnected   *bool    `json:"nodeConnected"`
+	LatestBlock     uint64   `json:"latestBlock"`
+	HeadAgeSeconds  *float64 `json:"headAgeSeconds"`
+	DBError         string   `json:"dbError,omitempty"`
+	PriceAgeSeconds *float64 `json:"priceAgeSeconds"`
+}
+
+func (hs *HealthState) setInitialized() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.initialized = true
+	hs.lastHead = time.Now()
+}
+
+func (hs *HealthState) isInitialized() bool {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	return hs.initialized
+}
+
+func (hs *HealthState) setSyncing(syncing *Syncing) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.syncing = syncing
+}
+
+// setSubscribed records whether the subscription to the heads of the node
+// is up, the daemon follows a node once it is first called.
+func (hs *HealthState) setSubscribed(subscribed bool) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.following = true
+	hs.subscribed = subscribed
+}
+
+func (hs *HealthState) setHeadProcessed() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.lastHead = time.Now()
+}
+
+// setDBResult records the result of the latest write to the database, or of
+// the latest read in read-only mode.
+func (hs *HealthState) setDBResult(err error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.dbError = err
+}
+
+// healthReport returns the state of the daemon, and the reasons it is not
+// ready.
+func (h *Hub) healthReport() HealthReport {
+	hs := &h.s.health
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	report := HealthReport{
+		Status:      "ok",
+		Failures:    []string{},
+		Initialized: hs.initialized,
+		Syncing:     hs.syncing,
+	}
 
+	if !hs.initialized {
+		report.Failures = append(report.Failures, "initializing")
+		if hs.syncing != nil {
+			report.Failures = append(report.Failures, fmt.Sprintf("node is syncing %s/%s", hs.syncing.CurrentBlock, hs.syncing.HighestBlock))
+		}
+		report.Status = "fail"
+		return report
+	}
+
+	report.LatestBlock = h.s.latestBlock.getBlockNumber()
+
+	if hs.following {
+		nodeConnected := hs.subscribed
+		report.NodeConnected = &nodeConnected
+		if !nodeConnected {
+			report.Failures = append(report.Failures, "node subscription is lost")
+		}
+	}
+
+	headAge := time.Since(hs.lastHead)
+	headAgeSeconds := headAge.Seconds()
+	report.HeadAgeSeconds = &headAgeSeconds
+	if h.health.ReadyHeadAge > 0 && headAge > h.health.ReadyHeadAge {
+		report.Failures = append(report.Failures, fmt.Sprintf("no head processed for %s", headAge.Truncate(time.Second)))
+	}
+
+	if hs.dbError != nil {
+		report.DBError = hs.dbError.Error()
+		report.Failures = append(report.Failures, "database is failing")
+	}
+
+	if updatedAt := h.prices.GetUpdatedAt(usdCurrency); !updatedAt.IsZero() {
+		priceAge := time.Since(updatedAt)
+		priceAgeSeconds := priceAge.Seconds()
+		report.PriceAgeSeconds = &priceAgeSeconds
+		if h.health.ReadyPriceAge > 0 && priceAge > h.health.ReadyPriceAge {
+			report.Failures = append(report.Failures, fmt.Sprintf("price is %s old", priceAge.Truncate(time.Second)))
+		}
+	} else if h.health.ReadyPriceAge > 0 {
+		report.Failures = append(report.Failures, "price is not known")
+	}
+
+	if len(report.Failures) > 0 {
+		report.Status = "fail"
+	}
+
+	return report
+}
+
+// serveLivez fails only when the daemon is stuck and must be restarted, it
+// passes while initializing, which can wait for the node to sync for hours.
+func (h *Hub) serveLivez(w http.ResponseWriter, r *http.Request) {
+	report := h.healthReport()
+	report.Status = "ok"
+	report.Failures = []string{}
+
+	if report.HeadAgeSeconds != nil && h.health.LiveHeadAge > 0 {
+		headAge := time.Duration(*report.HeadAgeSeconds * float64(time.Second))
+		if headAge > h.health.LiveHeadAge {
+			report.Status = "fail"
+			report.Failures = append(report.Failures, fmt.Sprintf("no head processed for %s", headAge.Truncate(time.Second)))
+		}
+	}
+
+	writeHealthReport(w, report)
+}
+
+// serveReadyz fails when the daemon should not take traffic.
+func (h *Hub) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, h.healthReport())
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if report.Status == "ok" {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Errorf("Error writing health report: %v", err)
+	}
+}
+
+func (h *Hub) serveHealth(w http.ResponseWriter, r *http.Request) {
 	health := Health{
 		Status: "OK",
-		Blocks: len(h.s.statsByBlock.v),
+		Blocks: h.s.blocks.len(),
 	}
 
-    w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-    w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
 
-    if err := json.NewEncoder(w).Encode(health); err != nil {
-        panic(err)
-    }
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,269 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// apiV1Prefix is the path the versioned HTTP API is served under.
+	apiV1Prefix = "/api/v1/"
+
+	// finalMaxAge is how long the responses that a reorg can not change
+	// anymore are cached, the blocks deeper than maxReorgDepth. It is short
+	// as the reprocess and import-prices commands still rewrite them.
+	finalMaxAge = 10 * time.Minute
+
+	// latestMaxAge is how long the responses that change with every block are
+	// cached.
+	latestMaxAge = secondsPerSlot * time.Second
+)
+
+// totalsWindows are the rolling windows of /api/v1/totals, the same ones
+// sent with the initial data.
+var totalsWindows = map[string]uint64{
+	"hour":  3600,
+	"day":   86400,
+	"week":  7 * 86400,
+	"month": 30 * 86400,
+}
+
+// APIError type represents the body of a failed HTTP API request.
+type APIError struct {
+	Error *jsonError `json:"error"`
+}
+
+// serveAPIV1 serves the read-only HTTP API, the same data as the websocket
+// methods for clients that can not speak JSON-RPC.
+func (h *Hub) serveAPIV1(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeAPIError(w, http.StatusMethodNotAllowed, invalidRequestErrorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, apiV1Prefix), "/")
+	parts := strings.Split(path, "/")
+
+	var result interface{}
+	var maxAge time.Duration
+	var err error
+
+	switch {
+	case parts[0] == "blocks" && len(parts) == 1:
+		result, maxAge, err = h.apiBlocks(r)
+	case parts[0] == "blocks" && len(parts) == 2:
+		result, maxAge, err = h.apiBlock(parts[1])
+	case parts[0] == "totals" && len(parts) == 1:
+		result, maxAge, err = h.apiTotals(r)
+	case parts[0] == "aggregates" && len(parts) == 2:
+		result, maxAge, err = h.apiAggregates(r, parts[1])
+	default:
+		err = notFoundErrorf("%s is not an API endpoint", r.URL.Path)
+	}
+
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		log.Errorf("Error marshaling API response: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resultJSON)
+}
+
+// apiBlock serves /api/v1/blocks/{n}.
+func (h *Hub) apiBlock(param string) (interface{}, time.Duration, error) {
+	blockNumber, err := h.parseQueryParam("block number", param, "block")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page, err := h.s.getBlockStatsRange(blockNumber, blockNumber)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(page.Blocks) == 0 {
+		return nil, 0, notFoundErrorf("block %d is not stored", blockNumber)
+	}
+
+	return page.Blocks[0], h.blocksMaxAge(blockNumber), nil
+}
+
+// apiBlocks serves /api/v1/blocks?from=&to=, to is the latest block when it
+// is not given.
+func (h *Hub) apiBlocks(r *http.Request) (interface{}, time.Duration, error) {
+	query := r.URL.Query()
+
+	from, err := h.parseQueryParam("from", query.Get("from"), "block")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	toParam := query.Get("to")
+	if toParam == "" {
+		toParam = "latest"
+	}
+	to, err := h.parseQueryParam("to", toParam, "block")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if from > to {
+		return nil, 0, invalidParamsErrorf("from %d is after to %d", from, to)
+	}
+
+	page, err := h.s.getBlockStatsRange(from, to)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// a page ending after the latest block gets the blocks produced later
+	lastBlock := to
+	if page.Next != nil {
+		lastBlock = uint64(*page.Next) - 1
+	}
+	if toParam == "latest" || lastBlock > h.s.latestBlock.getBlockNumber() {
+		return page, latestMaxAge, nil
+	}
+
+	return page, h.blocksMaxAge(lastBlock), nil
+}
+
+// apiTotals serves /api/v1/totals?window=, the totals since london when no
+// window is given.
+func (h *Hub) apiTotals(r *http.Request) (interface{}, time.Duration, error) {
+	window := r.URL.Query().Get("window")
+
+	blockNumber := h.s.latestBlock.getBlockNumber()
+	if window == "" || window == "all" {
+		totals, err := h.s.getTotals(blockNumber)
+		if err != nil {
+			return nil, 0, notReadyErrorf("latest block %d is not processed yet", blockNumber)
+		}
+		return totals, latestMaxAge, nil
+	}
+
+	seconds, ok := totalsWindows[window]
+	if !ok {
+		return nil, 0, invalidParamsErrorf("window '%s' is not one of all, hour, day, week or month", window)
+	}
+
+	blockTimestamp, err := h.s.getBlockTimestamp(blockNumber)
+	if err != nil {
+		return nil, 0, notReadyErrorf("latest block %d is not processed yet", blockNumber)
+	}
+
+	// the windows include the current block
+	windowEnd := blockTimestamp + 1
+
+	totals, err := h.s.getTotalsTimeDelta(windowEnd-seconds, windowEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return totals, latestMaxAge, nil
+}
+
+// apiAggregates serves /api/v1/aggregates/{granularity}?count=&timezone=.
+func (h *Hub) apiAggregates(r *http.Request, name string) (interface{}, time.Duration, error) {
+	g, ok := getGranularity(name)
+	if !ok {
+		return nil, 0, notFoundErrorf("granularity '%s' is not one of %v", name, getGranularityNames())
+	}
+
+	query := r.URL.Query()
+
+	periodCount := 300
+	if countParam := query.Get("count"); countParam != "" {
+		count, err := strconv.Atoi(countParam)
+		if err != nil || count < 0 {
+			return nil, 0, invalidParamsErrorf("count is not a number - %s", countParam)
+		}
+		periodCount = count
+	}
+
+	// periods are in UTC unless an IANA timezone is requested
+	zone := query.Get("timezone")
+	if zone == "" {
+		return h.s.aggregates[g.Name].getTotals(periodCount), latestMaxAge, nil
+	}
+
+	totals, err := h.s.getZonedAggregates(g, zone, periodCount)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return totals, latestMaxAge, nil
+}
+
+// parseQueryParam reads a block number or a timestamp given in a URL as a
+// decimal number, a hex string or "latest".
+func (h *Hub) parseQueryParam(name string, param string, unit string) (uint64, error) {
+	if param == "" {
+		return 0, invalidParamsErrorf("%s is required", name)
+	}
+
+	n, err := strconv.ParseUint(param, 10, 64)
+	if err == nil {
+		return n, nil
+	}
+
+	return h.s.parseRangeParam(name, param, unit)
+}
+
+// blocksMaxAge returns how long blocks up to blockNumber are cached, they
+// can only change while a reorg can replace them.
+func (h *Hub) blocksMaxAge(blockNumber uint64) time.Duration {
+	if blockNumber+maxReorgDepth < h.s.latestBlock.getBlockNumber() {
+		return finalMaxAge
+	}
+
+	return latestMaxAge
+}
+
+// apiErrorStatus returns the HTTP status of the JSON-RPC error code of err.
+func apiErrorStatus(err error) int {
+	e, ok := err.(rpcError)
+	if !ok {
+		return http.StatusInternalServerError
+	}
+
+	switch e.ErrorCode() {
+	case errcodeInvalidParams, errcodeInvalidRequest, errcodeParse:
+		return http.StatusBadRequest
+	case errcodeNotFound, errcodeMethodNotFound:
+		return http.StatusNotFound
+	case errcodeNotReady:
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	jsonErr := errorMessage(nil, err).Error
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(APIError{Error: jsonErr}); err != nil {
+		log.Errorf("Error writing API error: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestAPIServer returns a server of the HTTP API of s.
+func newTestAPIServer(t *testing.T, s *Stats) *httptest.Server {
+	t.Helper()
+
+	h := &Hub{s: s}
+	server := httptest.NewServer(h.whenInitialized(h.serveAPIV1))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// getAPI requests path from server and returns the response and its body.
+func getAPI(t *testing.T, server *httptest.Server, method string, path string) (*http.Response, string) {
+	t.Helper()
+
+	request, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response, string(body)
+}
+
+func TestAPIV1(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 250)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 250)
+
+	server := newTestAPIServer(t, s)
+
+	// nothing is served until the blocks are loaded
+	response, _ := getAPI(t, server, http.MethodGet, "/api/v1/totals")
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status before the blocks are loaded is %d, want %d", response.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	s.health.setInitialized()
+
+	final := fmt.Sprintf("public, max-age=%d", int(finalMaxAge.Seconds()))
+	latest := fmt.Sprintf("public, max-age=%d", int(latestMaxAge.Seconds()))
+
+	// the latest block is 250, the ones up to 250-maxReorgDepth-1 are final
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		status       int
+		cacheControl string
+		errorCode    int
+	}{
+		{"final block", http.MethodGet, "/api/v1/blocks/150", http.StatusOK, final, 0},
+		{"hex block", http.MethodGet, "/api/v1/blocks/0x96", http.StatusOK, final, 0},
+		{"block a reorg can replace", http.MethodGet, "/api/v1/blocks/240", http.StatusOK, latest, 0},
+		{"latest block", http.MethodGet, "/api/v1/blocks/latest", http.StatusOK, latest, 0},
+		{"bad block number", http.MethodGet, "/api/v1/blocks/0xzz", http.StatusBadRequest, "no-store", errcodeInvalidParams},
+		{"block after the latest", http.MethodGet, "/api/v1/blocks/300", http.StatusNotFound, "no-store", errcodeNotFound},
+		{"final blocks", http.MethodGet, "/api/v1/blocks?from=100&to=120", http.StatusOK, final, 0},
+		{"blocks up to the latest", http.MethodGet, "/api/v1/blocks?from=240", http.StatusOK, latest, 0},
+		{"blocks ending after the latest", http.MethodGet, "/api/v1/blocks?from=100&to=300", http.StatusOK, latest, 0},
+		{"blocks without from", http.MethodGet, "/api/v1/blocks", http.StatusBadRequest, "no-store", errcodeInvalidParams},
+		{"blocks from after to", http.MethodGet, "/api/v1/blocks?from=120&to=100", http.StatusBadRequest, "no-store", errcodeInvalidParams},
+		{"totals", http.MethodGet, "/api/v1/totals", http.StatusOK, latest, 0},
+		{"totals of a window", http.MethodGet, "/api/v1/totals?window=day", http.StatusOK, latest, 0},
+		{"totals of an unknown window", http.MethodGet, "/api/v1/totals?window=year", http.StatusBadRequest, "no-store", errcodeInvalidParams},
+		{"aggregates", http.MethodGet, "/api/v1/aggregates/day?count=2", http.StatusOK, latest, 0},
+		{"zoned aggregates", http.MethodGet, "/api/v1/aggregates/hour?count=2&timezone=Australia/Lord_Howe", http.StatusOK, latest, 0},
+		{"unknown granularity", http.MethodGet, "/api/v1/aggregates/fortnight", http.StatusNotFound, "no-store", errcodeNotFound},
+		{"bad count", http.MethodGet, "/api/v1/aggregates/day?count=x", http.StatusBadRequest, "no-store", errcodeInvalidParams},
+		{"unknown timezone", http.MethodGet, "/api/v1/aggregates/day?timezone=Mars/Base", http.StatusBadRequest, "no-store", errcodeInvalidParams},
+		{"unknown endpoint", http.MethodGet, "/api/v1/supply", http.StatusNotFound, "no-store", errcodeNotFound},
+		{"post", http.MethodPost, "/api/v1/totals", http.StatusMethodNotAllowed, "no-store", errcodeInvalidRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, body := getAPI(t, server, test.method, test.path)
+			if response.StatusCode != test.status {
+				t.Errorf("status is %d, want %d: %s", response.StatusCode, test.status, body)
+			}
+			if cacheControl := response.Header.Get("Cache-Control"); cacheControl != test.cacheControl {
+				t.Errorf("Cache-Control is %s, want %s", cacheControl, test.cacheControl)
+			}
+			if origin := response.Header.Get("Access-Control-Allow-Origin"); origin != "*" {
+				t.Errorf("Access-Control-Allow-Origin is %s, want *", origin)
+			}
+
+			if test.errorCode == 0 {
+				if !json.Valid([]byte(body)) {
+					t.Errorf("body is not JSON: %s", body)
+				}
+				return
+			}
+
+			var apiError APIError
+			err := json.Unmarshal([]byte(body), &apiError)
+			if err != nil || apiError.Error == nil {
+				t.Fatalf("body %s is not an error: %v", body, err)
+			}
+			if apiError.Error.Code != test.errorCode {
+				t.Errorf("error is %d '%s', want %d", apiError.Error.Code, apiError.Error.Message, test.errorCode)
+			}
+		})
+	}
+
+	response, body := getAPI(t, server, http.MethodGet, "/api/v1/blocks/150")
+	if !strings.Contains(body, `"number":150,`) {
+		t.Errorf("block 150 is %s", body)
+	}
+	if allow := response.Header.Get("Allow"); allow != "" {
+		t.Errorf("Allow is %s on a GET", allow)
+	}
+	response, _ = getAPI(t, server, http.MethodPost, "/api/v1/totals")
+	if allow := response.Header.Get("Allow"); allow != "GET, HEAD" {
+		t.Errorf("Allow is %s, want GET, HEAD", allow)
+	}
+}
+
+func TestAPIV1NotReady(t *testing.T) {
+	// the blocks are loaded but none is processed yet
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 110)
+	s := newTestStats(t, node)
+	s.health.setInitialized()
+
+	server := newTestAPIServer(t, s)
+
+	for _, path := range []string{"/api/v1/totals", "/api/v1/totals?window=hour", "/api/v1/aggregates/day?timezone=UTC"} {
+		response, body := getAPI(t, server, http.MethodGet, path)
+		if response.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("%s: status is %d, want %d: %s", path, response.StatusCode, http.StatusServiceUnavailable, body)
+		}
+		if cacheControl := response.Header.Get("Cache-Control"); cacheControl != "no-store" {
+			t.Errorf("%s: Cache-Control is %s, want no-store", path, cacheControl)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package hub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+const (
+	// backfillConcurrency is how many blocks are fetched at the same time, the
+	// receipts of every block are still fetched by the receipt workers.
+	backfillConcurrency = 8
+
+	// backfillWindow is how far ahead of the last committed block blocks are
+	// fetched, it bounds the blocks held in memory waiting to be committed.
+	backfillWindow = 256
+
+	// backfillCommitSize is how many blocks are committed at once.
+	backfillCommitSize = 100
+
+	backfillLogInterval = 10 * time.Second
+)
+
+type backfillResult struct {
+	blockNumber           uint64
+	blockStats            sql.BlockStats
+	blockStatsPercentiles []sql.BlockStatsPercentiles
+	err                   error
+}
+
+// backfillBlocks fetches the blocks from -> to concurrently and commits them
+// to the database in order. Progress is checkpointed under name and the
+// range, so a backfill of the same range that was interrupted resumes after
+// the last committed block, and the checkpoint is deleted once every block is
+// committed. With updateCache set every block is fetched from the node
+// instead of the cache, and the backfill never resumes.
+func (s *Stats) backfillBlocks(name string, from uint64, to uint64, updateCache bool) error {
+	checkpointName := fmt.Sprintf("%s:%d-%d", name, from, to)
+
+	if !updateCache {
+		checkpoint, ok, err := s.db.GetCheckpoint(checkpointName)
+		if err != nil {
+			return fmt.Errorf("error getting checkpoint '%s': %v", checkpointName, err)
+		}
+
+		if ok && checkpoint >= from && checkpoint < to {
+			log.Infof("backfill %s: resuming after block %d", name, checkpoint)
+			from = checkpoint + 1
+		}
+	}
+
+	if from > to {
+		return nil
+	}
+
+	// the stored totals after from were computed without these blocks
+	err := s.rewindAggregatesCheckpoint(from - 1)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// a slot of the window is taken when a block is queued and released when
+	// it is committed
+	window := make(chan struct{}, backfillWindow)
+	blockNumbers := make(chan uint64)
+	results := make(chan backfillResult, backfillWindow)
+
+	go func() {
+		defer close(blockNumbers)
+
+		for n := from; n <= to; n++ {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			select {
+			case blockNumbers <- n:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < backfillConcurrency; w++ {
+		go func() {
+			for n := range blockNumbers {
+				blockStats, blockStatsPercentiles, err := s.updateBlockStats(n, updateCache)
+
+				select {
+				case results <- backfillResult{
+					blockNumber:           n,
+					blockStats:            blockStats,
+					blockStatsPercentiles: blockStatsPercentiles,
+					err:                   err,
+				}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	start := time.Now()
+	lastLog := start
+	total := to - from + 1
+	pending := make(map[uint64]backfillResult)
+
+	var batchBlockStats []sql.BlockStats
+	var batchBlockStatsPercentiles []sql.BlockStatsPercentiles
+
+	next := from
+	for next <= to {
+		r := <-results
+		if r.err != nil {
+			return fmt.Errorf("cannot update block stats for '%d', %v", r.blockNumber, r.err)
+		}
+		pending[r.blockNumber] = r
+
+		// commit the blocks that are next in order
+		for next <= to {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+
+			batchBlockStats = append(batchBlockStats, r.blockStats)
+			batchBlockStatsPercentiles = append(batchBlockStatsPercentiles, r.blockStatsPercentiles...)
+
+			if len(batchBlockStats) == backfillCommitSize || next == to {
+				err = s.db.AddBlocksWithCheckpoint(checkpointName, next, batchBlockStats, batchBlockStatsPercentiles)
+				if err != nil {
+					return fmt.Errorf("error adding blocks %d -> %d to database: %v", next+1-uint64(len(batchBlockStats)), next, err)
+				}
+
+				for range batchBlockStats {
+					<-window
+				}
+
+				batchBlockStats = nil
+				batchBlockStatsPercentiles = nil
+			}
+
+			next++
+		}
+
+		if time.Since(lastLog) >= backfillLogInterval {
+			lastLog = time.Now()
+
+			committed := next - from
+			blocksPerSecond := float64(committed) / time.Since(start).Seconds()
+			eta := time.Duration(0)
+			if blocksPerSecond > 0 {
+				eta = time.Duration(float64(total-committed)/blocksPerSecond) * time.Second
+			}
+
+			log.Infof("backfill %s: block %d of %d, %d/%d blocks, %.1f blocks/s, eta %s", name, next-1, to, committed, total, blocksPerSecond, eta.Round(time.Second))
+		}
+	}
+
+	err = s.db.DeleteCheckpoint(checkpointName)
+	if err != nil {
+		return fmt.Errorf("error deleting checkpoint '%s': %v", checkpointName, err)
+	}
+
+	duration := time.Since(start)
+	log.Infof("backfill %s: fetched %d blocks (%d -> %d) in %s", name, total, from, to, duration.Round(time.Second))
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package hub
+
+import (
+	"testing"
+)
+
+// checkStored checks which of the blocks from -> to are in the database.
+func checkStored(t *testing.T, s *Stats, from uint64, to uint64, stored bool) {
+	t.Helper()
+
+	for i := from; i <= to; i++ {
+		_, ok, err := s.db.GetBlockStats(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != stored {
+			t.Errorf("block %d stored is %t, want %t", i, ok, stored)
+		}
+	}
+}
+
+func TestBackfillBlocksDeletesCheckpoint(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 120)
+	s := newTestStats(t, node)
+
+	err := s.backfillBlocks("reprocess", 100, 110, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStored(t, s, 100, 110, true)
+
+	_, ok, err := s.db.GetCheckpoint("reprocess:100-110")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("checkpoint of a finished backfill is kept")
+	}
+}
+
+func TestBackfillBlocksResumesSameRange(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 120)
+	s := newTestStats(t, node)
+
+	// an interrupted run of 100 -> 110 committed up to 104
+	err := s.db.SetCheckpoint("reprocess:100-110", 104)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.backfillBlocks("reprocess", 100, 110, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStored(t, s, 100, 104, false)
+	checkStored(t, s, 105, 110, true)
+}
+
+func TestBackfillBlocksIgnoresOtherRange(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 120)
+	s := newTestStats(t, node)
+
+	err := s.db.SetCheckpoint("reprocess:100-110", 104)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.backfillBlocks("reprocess", 100, 115, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStored(t, s, 100, 115, true)
+}
+
+func TestBackfillBlocksForceNeverResumes(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 120)
+	s := newTestStats(t, node)
+
+	err := s.db.SetCheckpoint("reprocess:100-110", 104)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.backfillBlocks("reprocess", 100, 110, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStored(t, s, 100, 110, true)
+}
@@ -0,0 +1,199 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+)
+
+const (
+	slotsPerEpoch  = 32
+	secondsPerSlot = 12
+)
+
+// BeaconClient is a client for the standard beacon node HTTP API
+type BeaconClient struct {
+	endpoint   string
+	httpClient HTTPClient
+}
+
+type beaconGenesisResponse struct {
+	Data struct {
+		GenesisTime string `json:"genesis_time"`
+	} `json:"data"`
+}
+
+type beaconFinalityCheckpointsResponse struct {
+	Data struct {
+		Finalized struct {
+			Epoch string `json:"epoch"`
+		} `json:"finalized"`
+	} `json:"data"`
+}
+
+type beaconBlockRewardsResponse struct {
+	Data struct {
+		Total string `json:"total"`
+	} `json:"data"`
+}
+
+type beaconSyncCommitteeRewardsResponse struct {
+	Data []struct {
+		Reward string `json:"reward"`
+	} `json:"data"`
+}
+
+type beaconAttestationRewardsResponse struct {
+	Data struct {
+		TotalRewards []struct {
+			Head           string `json:"head"`
+			Target         string `json:"target"`
+			Source         string `json:"source"`
+			InclusionDelay string `json:"inclusion_delay"`
+			Inactivity     string `json:"inactivity"`
+		} `json:"total_rewards"`
+	} `json:"data"`
+}
+
+// get sends a request to the beacon node and decodes the response into v. It
+// returns false when the resource does not exist, such as a missed slot.
+func (c *BeaconClient) get(method string, path string, body interface{}, v interface{}) (bool, error) {
+	var requestBody *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return false, err
+		}
+		requestBody = bytes.NewReader(b)
+	} else {
+		requestBody = bytes.NewReader(nil)
+	}
+
+	request, err := http.NewRequest(method, c.endpoint+path, requestBody)
+	if err != nil {
+		return false, fmt.Errorf("error while creating http request %s", err)
+	}
+	request.Header.Add("Content-Type", "application/json")
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return false, fmt.Errorf("error while doing http request %s", err)
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return false, fmt.Errorf("error while reading http response body %s", err)
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("beacon node returned %d for %s: %s", response.StatusCode, path, string(responseBody))
+	}
+
+	err = json.Unmarshal(responseBody, v)
+	if err != nil {
+		return false, fmt.Errorf("error while unmarshalling response body %s '%s'", err, string(responseBody))
+	}
+
+	return true, nil
+}
+
+func (c *BeaconClient) getGenesisTime() (uint64, error) {
+	var response beaconGenesisResponse
+	_, err := c.get("GET", "/eth/v1/beacon/genesis", nil, &response)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(response.Data.GenesisTime, 10, 64)
+}
+
+func (c *BeaconClient) getFinalizedEpoch() (uint64, error) {
+	var response beaconFinalityCheckpointsResponse
+	_, err := c.get("GET", "/eth/v1/beacon/states/head/finality_checkpoints", nil, &response)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(response.Data.Finalized.Epoch, 10, 64)
+}
+
+// getEpochIssuance sums the proposer, sync committee and attestation rewards
+// paid out during epoch, in wei.
+func (c *BeaconClient) getEpochIssuance(epoch uint64) (*big.Int, error) {
+	issuance := big.NewInt(0)
+
+	for slot := epoch * slotsPerEpoch; slot < (epoch+1)*slotsPerEpoch; slot++ {
+		var blockRewards beaconBlockRewardsResponse
+		found, err := c.get("GET", fmt.Sprintf("/eth/v1/beacon/rewards/blocks/%d", slot), nil, &blockRewards)
+		if err != nil {
+			return nil, fmt.Errorf("error getting block rewards for slot %d: %v", slot, err)
+		}
+
+		// missed slots have no proposer or sync committee rewards
+		if !found {
+			continue
+		}
+
+		err = addGwei(issuance, blockRewards.Data.Total)
+		if err != nil {
+			return nil, err
+		}
+
+		var syncCommitteeRewards beaconSyncCommitteeRewardsResponse
+		_, err = c.get("POST", fmt.Sprintf("/eth/v1/beacon/rewards/sync_committee/%d", slot), []string{}, &syncCommitteeRewards)
+		if err != nil {
+			return nil, fmt.Errorf("error getting sync committee rewards for slot %d: %v", slot, err)
+		}
+
+		for _, r := range syncCommitteeRewards.Data {
+			err = addGwei(issuance, r.Reward)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var attestationRewards beaconAttestationRewardsResponse
+	_, err := c.get("POST", fmt.Sprintf("/eth/v1/beacon/rewards/attestations/%d", epoch), []string{}, &attestationRewards)
+	if err != nil {
+		return nil, fmt.Errorf("error getting attestation rewards for epoch %d: %v", epoch, err)
+	}
+
+	for _, r := range attestationRewards.Data.TotalRewards {
+		for _, gwei := range []string{r.Head, r.Target, r.Source, r.InclusionDelay, r.Inactivity} {
+			err = addGwei(issuance, gwei)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return issuance, nil
+}
+
+// addGwei adds a decimal gwei amount, which can be negative for penalties, to
+// total in wei.
+func addGwei(total *big.Int, gwei string) error {
+	if gwei == "" {
+		return nil
+	}
+
+	amount, ok := new(big.Int).SetString(gwei, 10)
+	if !ok {
+		return fmt.Errorf("gwei amount is not a number - %s", gwei)
+	}
+
+	amount.Mul(amount, big.NewInt(1_000_000_000))
+	total.Add(total, amount)
+
+	return nil
+}
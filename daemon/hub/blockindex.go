@@ -0,0 +1,444 @@
+package hub
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"unsafe"
+
+	"github.com/holiman/uint256"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+// hashWindow is how many of the latest block hashes are kept to detect
+// reorgs, it must cover maxReorgDepth and followDepth.
+const hashWindow = 1024
+
+// blockEntry is the part of the stats of a block kept in memory, the other
+// fields are read from the database. A zero timestamp marks a missing block.
+type blockEntry struct {
+	timestamp uint64
+	baseFee   uint64
+	gasUsed   uint64
+	gasTarget uint64
+	usdPrice  float64
+}
+
+// blockSums are the sums of the stats of every block from london up to a
+// block, without the consensus layer issuance. burned includes blobBurned.
+// The USD sums are in millionths of a dollar at the price of each block.
+type blockSums struct {
+	blobBurned uint256.Int
+	burned     uint256.Int
+	rewards    uint256.Int
+	tips       uint256.Int
+	burnedUSD  int64
+	rewardsUSD int64
+	tipsUSD    int64
+}
+
+func (bs *blockSums) add(x *blockSums) {
+	bs.blobBurned.Add(&bs.blobBurned, &x.blobBurned)
+	bs.burned.Add(&bs.burned, &x.burned)
+	bs.rewards.Add(&bs.rewards, &x.rewards)
+	bs.tips.Add(&bs.tips, &x.tips)
+	bs.burnedUSD += x.burnedUSD
+	bs.rewardsUSD += x.rewardsUSD
+	bs.tipsUSD += x.tipsUSD
+}
+
+func (bs *blockSums) sub(x *blockSums) {
+	bs.blobBurned.Sub(&bs.blobBurned, &x.blobBurned)
+	bs.burned.Sub(&bs.burned, &x.burned)
+	bs.rewards.Sub(&bs.rewards, &x.rewards)
+	bs.tips.Sub(&bs.tips, &x.tips)
+	bs.burnedUSD -= x.burnedUSD
+	bs.rewardsUSD -= x.rewardsUSD
+	bs.tipsUSD -= x.tipsUSD
+}
+
+type blockHash struct {
+	number uint64
+	hash   string
+}
+
+// baseFeeDay is the histogram of the base fees in gwei of the blocks stored
+// for a UTC day, the percentiles of whole days are read from it instead of
+// sorting the base fee of every block.
+type baseFeeDay struct {
+	blocks int
+	counts map[uint64]int
+}
+
+// BlockIndex defines a mutexed dense index of every block since london, the
+// block londonBlock+i is stored at offset i with the prefix sums up to it, so
+// the totals of any range of blocks are a subtraction.
+type BlockIndex struct {
+	mu     sync.RWMutex
+	first  uint64
+	count  int
+	blocks []blockEntry
+	sums   []blockSums
+	hashes [hashWindow]blockHash
+
+	// baseFeeDays are the base fee histograms by unix day
+	baseFeeDays map[uint64]*baseFeeDay
+}
+
+func newBlockIndex(first uint64) *BlockIndex {
+	return &BlockIndex{
+		first:       first,
+		baseFeeDays: map[uint64]*baseFeeDay{},
+	}
+}
+
+func (e blockEntry) day() uint64 {
+	return e.timestamp / 86400
+}
+
+func (e blockEntry) baseFeeGwei() uint64 {
+	return e.baseFee / 1_000_000_000
+}
+
+// addBaseFee counts the base fee of a stored block in the histogram of its day.
+func (bi *BlockIndex) addBaseFee(e blockEntry) {
+	d, ok := bi.baseFeeDays[e.day()]
+	if !ok {
+		d = &baseFeeDay{counts: map[uint64]int{}}
+		bi.baseFeeDays[e.day()] = d
+	}
+
+	d.blocks++
+	d.counts[e.baseFeeGwei()]++
+}
+
+// removeBaseFee removes the base fee of a block replaced or dropped from the
+// histogram of its day.
+func (bi *BlockIndex) removeBaseFee(e blockEntry) {
+	d, ok := bi.baseFeeDays[e.day()]
+	if !ok {
+		return
+	}
+
+	d.blocks--
+	d.counts[e.baseFeeGwei()]--
+	if d.counts[e.baseFeeGwei()] == 0 {
+		delete(d.counts, e.baseFeeGwei())
+	}
+	if d.blocks == 0 {
+		delete(bi.baseFeeDays, e.day())
+	}
+}
+
+func newBlockEntry(b sql.BlockStats) blockEntry {
+	baseFee := b.BaseFee.ToInt()
+
+	entry := blockEntry{
+		timestamp: b.Timestamp,
+		baseFee:   math.MaxUint64,
+		gasUsed:   uint64(b.GasUsed),
+		gasTarget: uint64(b.GasTarget),
+		usdPrice:  b.USDPrice,
+	}
+	if baseFee.IsUint64() {
+		entry.baseFee = baseFee.Uint64()
+	}
+
+	return entry
+}
+
+func newBlockSums(b sql.BlockStats) blockSums {
+	var bs blockSums
+	bs.blobBurned.SetFromBig(b.BlobBurned.ToInt())
+	bs.burned.SetFromBig(b.Burned.ToInt())
+	bs.burned.Add(&bs.burned, &bs.blobBurned)
+	bs.rewards.SetFromBig(b.Rewards.ToInt())
+	bs.tips.SetFromBig(b.Tips.ToInt())
+	bs.burnedUSD = usdMicros(bs.burned.ToBig(), b.USDPrice)
+	bs.rewardsUSD = usdMicros(b.Rewards.ToInt(), b.USDPrice)
+	bs.tipsUSD = usdMicros(b.Tips.ToInt(), b.USDPrice)
+
+	return bs
+}
+
+// addBlocks adds or replaces blocks, and updates the sums of every block
+// after them in a single pass.
+func (bi *BlockIndex) addBlocks(blocks ...sql.BlockStats) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+
+	type change struct {
+		added   blockSums
+		removed blockSums
+	}
+	changes := map[int]*change{}
+	firstChange := -1
+
+	for _, b := range blocks {
+		if uint64(b.Number) < bi.first {
+			continue
+		}
+		i := int(uint64(b.Number) - bi.first)
+
+		for len(bi.blocks) <= i {
+			bi.blocks = append(bi.blocks, blockEntry{})
+			if len(bi.sums) > 0 {
+				bi.sums = append(bi.sums, bi.sums[len(bi.sums)-1])
+			} else {
+				bi.sums = append(bi.sums, blockSums{})
+			}
+		}
+
+		c, ok := changes[i]
+		if !ok {
+			c = &change{}
+			changes[i] = c
+
+			// the stats of a stored block are the difference of the sums
+			if bi.blocks[i].timestamp != 0 {
+				c.removed = bi.sums[i]
+				if i > 0 {
+					c.removed.sub(&bi.sums[i-1])
+				}
+			}
+		}
+		c.added = newBlockSums(b)
+
+		if bi.blocks[i].timestamp == 0 {
+			bi.count++
+		} else {
+			bi.removeBaseFee(bi.blocks[i])
+		}
+		bi.blocks[i] = newBlockEntry(b)
+		bi.addBaseFee(bi.blocks[i])
+		bi.hashes[uint64(b.Number)%hashWindow] = blockHash{uint64(b.Number), b.Hash}
+
+		if firstChange == -1 || i < firstChange {
+			firstChange = i
+		}
+	}
+
+	if firstChange == -1 {
+		return
+	}
+
+	var added, removed blockSums
+	for i := firstChange; i < len(bi.sums); i++ {
+		if c, ok := changes[i]; ok {
+			added.add(&c.added)
+			removed.add(&c.removed)
+		}
+		bi.sums[i].add(&added)
+		bi.sums[i].sub(&removed)
+	}
+}
+
+// isStored returns true if b is stored with the same stats and hash.
+func (bi *BlockIndex) isStored(b sql.BlockStats) bool {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+
+	blockNumber := uint64(b.Number)
+	if blockNumber < bi.first || blockNumber-bi.first >= uint64(len(bi.blocks)) {
+		return false
+	}
+
+	i := blockNumber - bi.first
+	if bi.blocks[i].timestamp == 0 || bi.blocks[i] != newBlockEntry(b) {
+		return false
+	}
+
+	if h := bi.hashes[blockNumber%hashWindow]; h.number == blockNumber && h.hash != b.Hash {
+		return false
+	}
+
+	sums := bi.sums[i]
+	if i > 0 {
+		sums.sub(&bi.sums[i-1])
+	}
+
+	return sums == newBlockSums(b)
+}
+
+// removeBlocksAfter drops every block after blockNumber.
+func (bi *BlockIndex) removeBlocksAfter(blockNumber uint64) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+
+	n := 0
+	if blockNumber >= bi.first {
+		n = int(blockNumber - bi.first + 1)
+	}
+
+	for len(bi.blocks) > n {
+		last := len(bi.blocks) - 1
+		if bi.blocks[last].timestamp != 0 {
+			bi.count--
+			bi.removeBaseFee(bi.blocks[last])
+		}
+		bi.blocks = bi.blocks[:last]
+		bi.sums = bi.sums[:last]
+	}
+
+	// the last block is always stored
+	for len(bi.blocks) > 0 && bi.blocks[len(bi.blocks)-1].timestamp == 0 {
+		bi.blocks = bi.blocks[:len(bi.blocks)-1]
+		bi.sums = bi.sums[:len(bi.sums)-1]
+	}
+}
+
+func (bi *BlockIndex) getEntry(blockNumber uint64) (blockEntry, bool) {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+
+	if blockNumber < bi.first || blockNumber-bi.first >= uint64(len(bi.blocks)) {
+		return blockEntry{}, false
+	}
+
+	entry := bi.blocks[blockNumber-bi.first]
+
+	return entry, entry.timestamp != 0
+}
+
+// getSums returns the sums up to blockNumber, they are zero before london.
+func (bi *BlockIndex) getSums(blockNumber uint64) (blockSums, bool) {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+
+	if blockNumber == bi.first-1 {
+		return blockSums{}, true
+	}
+
+	if blockNumber < bi.first || blockNumber-bi.first >= uint64(len(bi.blocks)) {
+		return blockSums{}, false
+	}
+
+	i := blockNumber - bi.first
+	if bi.blocks[i].timestamp == 0 {
+		return blockSums{}, false
+	}
+
+	return bi.sums[i], true
+}
+
+// getBaseFeeCounts returns how many of the blocks from -> to had each base fee
+// in gwei, false if one of them is not stored. The blocks of the days entirely
+// in the range are counted from the histogram of the day.
+func (bi *BlockIndex) getBaseFeeCounts(from uint64, to uint64) (map[uint64]int, bool) {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+
+	if from < bi.first || from > to || to-bi.first >= uint64(len(bi.blocks)) {
+		return nil, false
+	}
+
+	counts := map[uint64]int{}
+
+	for i := int(from - bi.first); i <= int(to-bi.first); {
+		e := bi.blocks[i]
+		if e.timestamp == 0 {
+			return nil, false
+		}
+
+		// the histogram holds exactly the blocks i -> end when the block
+		// before i is stored on a previous day and the block after end on a
+		// later one, they are all stored then
+		if i > 0 && bi.blocks[i-1].timestamp != 0 && bi.blocks[i-1].day() < e.day() {
+			d := bi.baseFeeDays[e.day()]
+			end := i + d.blocks - 1
+			if end <= int(to-bi.first) && bi.blocks[end].timestamp != 0 && bi.blocks[end].day() == e.day() &&
+				(end+1 == len(bi.blocks) || (bi.blocks[end+1].timestamp != 0 && bi.blocks[end+1].day() > e.day())) {
+				for baseFee, count := range d.counts {
+					counts[baseFee] += count
+				}
+				i = end + 1
+				continue
+			}
+		}
+
+		counts[e.baseFeeGwei()]++
+		i++
+	}
+
+	return counts, true
+}
+
+// searchTimestamp returns the first block produced at or after timestamp, or
+// the block after the last one if there is none. A missing block is searched
+// as if it was produced with the next stored block.
+func (bi *BlockIndex) searchTimestamp(timestamp uint64) uint64 {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+
+	i := sort.Search(len(bi.blocks), func(i int) bool {
+		for bi.blocks[i].timestamp == 0 {
+			i++
+		}
+		return bi.blocks[i].timestamp >= timestamp
+	})
+
+	return bi.first + uint64(i)
+}
+
+// getHash returns the hash of one of the latest blocks, or "" if it is not
+// known.
+func (bi *BlockIndex) getHash(blockNumber uint64) string {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+
+	h := bi.hashes[blockNumber%hashWindow]
+	if h.number != blockNumber || blockNumber-bi.first >= uint64(len(bi.blocks)) {
+		return ""
+	}
+
+	return h.hash
+}
+
+// getMissingBlocks returns the blocks from -> to that are not stored, up to
+// the latest stored block.
+func (bi *BlockIndex) getMissingBlocks(from uint64, to uint64) []uint64 {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+
+	var missingBlockNumbers []uint64
+
+	if from < bi.first {
+		from = bi.first
+	}
+	if last := bi.first + uint64(len(bi.blocks)); to >= last {
+		to = last - 1
+	}
+
+	for n := from; n <= to; n++ {
+		if bi.blocks[n-bi.first].timestamp == 0 {
+			missingBlockNumbers = append(missingBlockNumbers, n)
+		}
+	}
+
+	return missingBlockNumbers
+}
+
+// last returns the latest stored block, or the block before first when none
+// is stored.
+func (bi *BlockIndex) last() uint64 {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+
+	return bi.first + uint64(len(bi.blocks)) - 1
+}
+
+// len returns how many blocks are stored.
+func (bi *BlockIndex) len() int {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+
+	return bi.count
+}
+
+// size returns the bytes allocated for the blocks.
+func (bi *BlockIndex) size() int {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+
+	return cap(bi.blocks)*int(unsafe.Sizeof(blockEntry{})) + cap(bi.sums)*int(unsafe.Sizeof(blockSums{}))
+}
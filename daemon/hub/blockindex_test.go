@@ -0,0 +1,211 @@
+package hub
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+// memoryBlockCount is how many blocks the memory benchmarks hold, run them
+// with: go test ./hub -run '^$' -bench Memory -benchtime 1x
+const memoryBlockCount = 1_000_000
+
+// benchmarkBlock returns the stats of a block with mainnet sized values.
+func benchmarkBlock(blockNumber uint64) sql.BlockStats {
+	return sql.BlockStats{
+		Number:            uint(blockNumber),
+		Timestamp:         1_628_166_822 + blockNumber*12,
+		Hash:              fmt.Sprintf("0x%064x", blockNumber),
+		ParentHash:        fmt.Sprintf("0x%064x", blockNumber-1),
+		BaseFee:           sql.NewBig(big.NewInt(31_000_000_000 + int64(blockNumber))),
+		BlobBaseFee:       sql.NewBig(big.NewInt(1)),
+		BlobBurned:        sql.NewBig(big.NewInt(131_072)),
+		Burned:            sql.NewBig(big.NewInt(900_000_000_000_000_000 + int64(blockNumber))),
+		GasTarget:         15_000_000,
+		GasUsed:           14_000_000,
+		PriorityFee:       sql.NewBig(big.NewInt(1_500_000_000)),
+		Rewards:           sql.NewBig(big.NewInt(2_000_000_000_000_000_000)),
+		Tips:              sql.NewBig(big.NewInt(70_000_000_000_000_000 + int64(blockNumber))),
+		Transactions:      200,
+		Type2Transactions: 150,
+		USDPrice:          3000,
+	}
+}
+
+// sortedBaseFees returns the base fees in gwei of the blocks from -> to
+// sorted, false if one of them is not stored.
+func sortedBaseFees(bi *BlockIndex, from uint64, to uint64) ([]uint64, bool) {
+	var baseFees []uint64
+	for i := from; i <= to; i++ {
+		entry, ok := bi.getEntry(i)
+		if !ok {
+			return nil, false
+		}
+		baseFees = append(baseFees, entry.baseFeeGwei())
+	}
+	sort.Slice(baseFees, func(i, j int) bool { return baseFees[i] < baseFees[j] })
+
+	return baseFees, true
+}
+
+func TestBlockIndexBaseFeeCounts(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	first := uint64(testLondonBlock)
+	last := first + 40_000
+
+	// blocks 6 hours apart on average, so days have from 0 to a dozen blocks
+	block := func(blockNumber uint64, timestamp uint64) sql.BlockStats {
+		b := benchmarkBlock(blockNumber)
+		b.Timestamp = timestamp
+		b.BaseFee = sql.NewBig(big.NewInt(r.Int63n(200) * 1_000_000_000))
+		return b
+	}
+
+	bi := newBlockIndex(first)
+	timestamps := map[uint64]uint64{}
+	timestamp := uint64(1_628_166_822)
+	for i := first; i <= last; i++ {
+		timestamp += uint64(r.Int63n(2 * 21600))
+		timestamps[i] = timestamp
+		bi.addBlocks(block(i, timestamp))
+	}
+
+	// replaced blocks move between histograms, dropped ones leave them
+	for n := 0; n < 1000; n++ {
+		i := first + uint64(r.Int63n(int64(last-first)))
+		bi.addBlocks(block(i, timestamps[i]))
+	}
+	bi.removeBlocksAfter(last - 1000)
+	last -= 1000
+
+	checkRange := func(from uint64, to uint64) {
+		t.Helper()
+
+		baseFees, stored := sortedBaseFees(bi, from, to)
+		counts, ok := bi.getBaseFeeCounts(from, to)
+		if ok != stored {
+			t.Fatalf("getBaseFeeCounts(%d, %d) ok is %t, want %t", from, to, ok, stored)
+		}
+		if !ok {
+			return
+		}
+
+		for _, perc := range []int{0, 10, 50, 90, 99, 100} {
+			want := getPercentileSortedUint64(baseFees, perc)
+			if got := getPercentileCounts(counts, perc); got != want {
+				t.Fatalf("percentile %d of %d -> %d is %d, want %d", perc, from, to, got, want)
+			}
+		}
+	}
+
+	for n := 0; n < 2000; n++ {
+		from := first + uint64(r.Int63n(int64(last-first)))
+		to := from + uint64(r.Int63n(int64(last-from+1)))
+		checkRange(from, to)
+	}
+	checkRange(first, last)
+
+	// a missing block fails every range containing it
+	missing := first + 20_000
+	bi.removeBlocksAfter(missing - 1)
+	for i := missing + 1; i <= last; i++ {
+		bi.addBlocks(block(i, timestamps[i]))
+	}
+	if _, ok := bi.getBaseFeeCounts(first, last); ok {
+		t.Errorf("getBaseFeeCounts(%d, %d) is ok with block %d missing", first, last, missing)
+	}
+	checkRange(first, missing-1)
+	checkRange(missing+1, last)
+}
+
+// heapAfterGC returns the bytes of the heap still in use after a collection.
+func heapAfterGC() uint64 {
+	runtime.GC()
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return m.HeapAlloc
+}
+
+func reportMemory(b *testing.B, before uint64, after uint64) {
+	b.ReportMetric(float64(after-before)/1e6, "MB")
+	b.ReportMetric(float64(after-before)/memoryBlockCount, "B/block")
+}
+
+// BenchmarkBlockIndexMemory measures the heap held by the index of
+// memoryBlockCount blocks.
+func BenchmarkBlockIndexMemory(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		before := heapAfterGC()
+
+		bi := newBlockIndex(testLondonBlock)
+		batch := make([]sql.BlockStats, 0, 10_000)
+		for i := uint64(testLondonBlock); i < testLondonBlock+memoryBlockCount; i++ {
+			batch = append(batch, benchmarkBlock(i))
+			if len(batch) == cap(batch) {
+				bi.addBlocks(batch...)
+				batch = batch[:0]
+			}
+		}
+		bi.addBlocks(batch...)
+		batch = nil
+
+		reportMemory(b, before, heapAfterGC())
+		runtime.KeepAlive(bi)
+	}
+}
+
+// mapTotals are the totals the maps kept for every block before the index,
+// as hex strings.
+type mapTotals struct {
+	ID                 string
+	BaseFee            uint
+	BaseFeePercentiles BaseFeePercentiles
+	BlobBurned         string
+	Burned             string
+	Duration           uint64
+	Issuance           string
+	Rewards            string
+	Tips               string
+}
+
+// BenchmarkBlockMapsMemory measures the heap held by the maps of the stats
+// and the totals of memoryBlockCount blocks the index replaced.
+func BenchmarkBlockMapsMemory(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		before := heapAfterGC()
+
+		statsByBlock := map[uint64]sql.BlockStats{}
+		totalsByBlock := map[uint64]mapTotals{}
+		burned := big.NewInt(0)
+		rewards := big.NewInt(0)
+		tips := big.NewInt(0)
+		for i := uint64(testLondonBlock); i < testLondonBlock+memoryBlockCount; i++ {
+			block := benchmarkBlock(i)
+			statsByBlock[i] = block
+
+			burned.Add(burned, block.Burned.ToInt())
+			rewards.Add(rewards, block.Rewards.ToInt())
+			tips.Add(tips, block.Tips.ToInt())
+			totalsByBlock[i] = mapTotals{
+				BlobBurned: hexutil.EncodeBig(block.BlobBurned.ToInt()),
+				Burned:     hexutil.EncodeBig(burned),
+				Duration:   block.Timestamp,
+				Issuance:   hexutil.EncodeBig(new(big.Int).Sub(rewards, burned)),
+				Rewards:    hexutil.EncodeBig(rewards),
+				Tips:       hexutil.EncodeBig(tips),
+			}
+		}
+
+		reportMemory(b, before, heapAfterGC())
+		runtime.KeepAlive(statsByBlock)
+		runtime.KeepAlive(totalsByBlock)
+	}
+}
@@ -20,8 +20,11 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Maximum message size allowed from peer, it fits a batch of requests.
+	maxMessageSize = 16 * 1024
+
+	// Maximum number of requests in a batch.
+	maxBatchRequests = 100
 )
 
 var (
@@ -41,6 +44,17 @@ type Client struct {
 	send chan []byte
 
 	subscriptions map[string]*big.Int
+
+	// currencies are the quote currencies picked by the subscriptions.
+	currencies map[string]string
+
+	// closed is set once the client is removed from the hub, its send
+	// channel is closed and its subscriptions are not counted anymore.
+	closed bool
+
+	// dropped is set when a response does not fit in the send channel, the
+	// client stops reading and the hub removes it.
+	dropped bool
 }
 
 // NewClient creates a new client.
@@ -53,6 +67,7 @@ func NewClient(
 		conn:          conn,
 		send:          make(chan []byte, 256),
 		subscriptions: map[string]*big.Int{},
+		currencies:    map[string]string{},
 	}
 }
 
@@ -63,7 +78,16 @@ func (c *Client) isSubscribedTo(subscription string) *big.Int {
 	return c.subscriptions[subscription]
 }
 
-func (c *Client) subscribeTo(subscription string) (*big.Int, error) {
+// subscriptionCurrency returns the quote currency picked by a subscription, ""
+// if it has none.
+func (c *Client) subscriptionCurrency(subscription string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.currencies[subscription]
+}
+
+func (c *Client) subscribeTo(subscription string, currency string) (*big.Int, error) {
 	max := new(big.Int)
 	max.Exp(big.NewInt(2), big.NewInt(130), nil).Sub(max, big.NewInt(1))
 
@@ -76,7 +100,15 @@ func (c *Client) subscribeTo(subscription string) (*big.Int, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if _, ok := c.subscriptions[subscription]; !ok && !c.closed {
+		metrics.subscriptions.WithLabelValues(subscription).Inc()
+	}
 	c.subscriptions[subscription] = n
+	if currency != "" {
+		c.currencies[subscription] = currency
+	} else {
+		delete(c.currencies, subscription)
+	}
 
 	return n, nil
 }
@@ -88,6 +120,10 @@ func (c *Client) unsubscribeTo(subscriptionID *big.Int) (*big.Int, error) {
 	for subscription, n := range c.subscriptions {
 		if n.Cmp(subscriptionID) == 0 {
 			delete(c.subscriptions, subscription)
+			delete(c.currencies, subscription)
+			if !c.closed {
+				metrics.subscriptions.WithLabelValues(subscription).Dec()
+			}
 			break
 		}
 	}
@@ -95,6 +131,23 @@ func (c *Client) unsubscribeTo(subscriptionID *big.Int) (*big.Int, error) {
 	return big.NewInt(0), nil
 }
 
+// close closes the send channel of a client removed from the hub and stops
+// counting its subscriptions, only the hub calls it.
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.send)
+
+	for subscription := range c.subscriptions {
+		metrics.subscriptions.WithLabelValues(subscription).Dec()
+	}
+}
+
 // readPump pumps messages from the websocket connection to the hub.
 //
 // The application runs readPump in a per-connection goroutine. The application
@@ -110,8 +163,11 @@ func (c *Client) readPump() {
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
 	for {
-		message := jsonrpcMessage{}
-		err := c.conn.ReadJSON(&message)
+		if c.isDropped() {
+			break
+		}
+
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Errorf("error: %v\n", err)
@@ -119,47 +175,139 @@ func (c *Client) readPump() {
 			break
 		}
 
-		b, err := json.Marshal(message)
-		if err != nil {
-			log.Error(err)
+		if isBatch(data) {
+			c.handleBatch(data)
 			continue
 		}
 
-		function, ok := c.hub.handlers[message.Method]
-		if !ok {
-			log.Errorf("Could not find handler for '%s'", message.Method)
+		message := jsonrpcMessage{}
+		err = json.Unmarshal(data, &message)
+		if err != nil {
+			c.sendMessage(errorMessage(nil, parseErrorf("parse error: %v", err)))
 			continue
 		}
 
-		result, err := function(c, message)
-		if err != nil {
-			log.Error(err)
-			continue
+		// notifications without an id get no response
+		response := c.handleMessage(message)
+		if len(message.ID) > 0 {
+			c.sendMessage(response)
 		}
+	}
+}
+
+// handleBatch runs the requests of a batch in order and sends their responses
+// in a single batch, notifications without an id get no response.
+func (c *Client) handleBatch(data []byte) {
+	var messages []json.RawMessage
+	err := json.Unmarshal(data, &messages)
+	if err != nil {
+		c.sendMessage(errorMessage(nil, parseErrorf("parse error: %v", err)))
+		return
+	}
+
+	if len(messages) == 0 {
+		c.sendMessage(errorMessage(nil, invalidRequestErrorf("empty batch")))
+		return
+	}
+
+	if len(messages) > maxBatchRequests {
+		c.sendMessage(errorMessage(nil, invalidRequestErrorf("batch of %d requests is larger than %d", len(messages), maxBatchRequests)))
+		return
+	}
 
-		b, err = json.Marshal(
-			jsonrpcMessage{
-				Version: message.Version,
-				ID:      message.ID,
-				Result:  result,
-			},
-		)
+	responses := []jsonrpcMessage{}
+	for _, raw := range messages {
+		message := jsonrpcMessage{}
+		err := json.Unmarshal(raw, &message)
 		if err != nil {
-			log.Error(err)
+			responses = append(responses, errorMessage(nil, invalidRequestErrorf("invalid request: %v", err)))
 			continue
 		}
 
-		select {
-		case c.send <- b:
-		default:
-			close(c.send)
-			delete(c.hub.clients, c)
+		response := c.handleMessage(message)
+		if len(message.ID) > 0 {
+			responses = append(responses, response)
 		}
+	}
+
+	if len(responses) == 0 {
+		return
+	}
+
+	b, err := json.Marshal(responses)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	c.sendBytes(b)
+}
+
+// handleMessage calls the handler of a request and returns its response.
+func (c *Client) handleMessage(message jsonrpcMessage) jsonrpcMessage {
+	if message.Method == "" {
+		return errorMessage(message.ID, invalidRequestErrorf("invalid request, method is missing"))
+	}
+
+	function, ok := c.hub.handlers[message.Method]
+	if !ok {
+		log.Errorf("Could not find handler for '%s'", message.Method)
+		return errorMessage(message.ID, methodNotFoundError(message.Method))
+	}
+
+	result, err := function(c, message)
+	if err != nil {
+		if _, ok := err.(rpcError); ok {
+			log.Debugf("%s: %v", message.Method, err)
+		} else {
+			log.Errorf("%s: %v", message.Method, err)
+		}
+		return errorMessage(message.ID, err)
+	}
 
-		continue
+	return jsonrpcMessage{
+		Version: message.Version,
+		ID:      message.ID,
+		Result:  result,
 	}
 }
 
+// sendMessage queues a response to the client.
+func (c *Client) sendMessage(message jsonrpcMessage) {
+	b, err := json.Marshal(message)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	c.sendBytes(b)
+}
+
+// sendBytes queues a response to the client, a client too slow to read its
+// responses is dropped.
+func (c *Client) sendBytes(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || c.dropped {
+		return
+	}
+
+	select {
+	case c.send <- b:
+	default:
+		c.dropped = true
+		metrics.droppedClients.Inc()
+	}
+}
+
+func (c *Client) isDropped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.dropped
+}
+
 // writePump pumps messages from the hub to the websocket connection.
 //
 // A goroutine running writePump is started for each connection. The
@@ -0,0 +1,300 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestHub returns a hub listening for its clients and subscriptions.
+func newTestHub() *Hub {
+	h := &Hub{
+		subscription: make(chan map[string]interface{}),
+		register:     make(chan *Client),
+		unregister:   make(chan *Client),
+		clients:      map[*Client]bool{},
+	}
+	go h.listen()
+
+	return h
+}
+
+func TestClientSendBytesDropsSlowClient(t *testing.T) {
+	h := newTestHub()
+	c := NewClient(h, nil)
+	h.register <- c
+
+	_, err := c.subscribeTo("newHeads", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the responses and the broadcasts fill the send channel concurrently,
+	// only the hub removes the client and closes it
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 2*cap(c.send); i++ {
+			c.sendBytes([]byte("{}"))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 2*cap(c.send); i++ {
+			h.subscription <- map[string]interface{}{"newHeads": i}
+		}
+	}()
+	wg.Wait()
+
+	if !c.isDropped() {
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		if !closed {
+			t.Fatal("client is neither dropped nor removed with a full send channel")
+		}
+	}
+
+	// readPump stops reading and unregisters a dropped client, sending to it
+	// afterwards is a no-op, registering another client waits for the hub to
+	// be done with the unregistration
+	h.unregister <- c
+	h.register <- NewClient(h, nil)
+	c.sendBytes([]byte("{}"))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		t.Error("unregistered client is not closed")
+	}
+}
+
+// dialTestHub serves the websocket of a hub answering with the handlers of s
+// and returns a connection to it.
+func dialTestHub(t *testing.T, s *Stats) (*Hub, *websocket.Conn) {
+	t.Helper()
+
+	h := newTestHub()
+	h.upgrader = &websocket.Upgrader{}
+	h.s = s
+	h.initializeWebSocketHandlers()
+
+	server := httptest.NewServer(http.HandlerFunc(h.serveWebSocket))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return h, conn
+}
+
+// writeRequests sends each request in its own frame.
+func writeRequests(t *testing.T, conn *websocket.Conn, requests ...string) {
+	t.Helper()
+
+	for _, request := range requests {
+		err := conn.WriteMessage(websocket.TextMessage, []byte(request))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readResponse returns the next frame sent by the hub.
+func readResponse(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, response, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(response)
+}
+
+func TestClientNotificationGetsNoResponse(t *testing.T) {
+	_, conn := dialTestHub(t, &Stats{})
+
+	// the notifications are handled in order, so the first response is the
+	// one of the request
+	writeRequests(t, conn,
+		`{"jsonrpc":"2.0","method":"eth_syncing"}`,
+		`{"jsonrpc":"2.0","method":"eth_unknown"}`,
+		`{"jsonrpc":"2.0","id":7,"method":"eth_syncing"}`,
+	)
+
+	if response := readResponse(t, conn); response != `{"jsonrpc":"2.0","id":7,"result":false}` {
+		t.Errorf("first response is %s, want the one of the request with id 7", response)
+	}
+}
+
+func TestClientErrorCodes(t *testing.T) {
+	// no block is processed yet
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 110)
+	h, conn := dialTestHub(t, newTestStats(t, node))
+	h.handlers["test_fail"] = func(c *Client, message jsonrpcMessage) (json.RawMessage, error) {
+		return nil, fmt.Errorf("database is gone")
+	}
+
+	tests := []struct {
+		name    string
+		request string
+		id      string
+		code    int
+	}{
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"eth_unknown"}`, `1`, errcodeMethodNotFound},
+		{"missing method", `{"jsonrpc":"2.0","id":2}`, `2`, errcodeInvalidRequest},
+		{"bad params", `{"jsonrpc":"2.0","id":"a","method":"internal_getBlockStats","params":["0xzz"]}`, `"a"`, errcodeInvalidParams},
+		{"no params", `{"jsonrpc":"2.0","id":3,"method":"internal_getTotalsRange","params":[1]}`, `3`, errcodeInvalidParams},
+		{"not found", `{"jsonrpc":"2.0","id":4,"method":"internal_getBlockStats","params":[200]}`, `4`, errcodeNotFound},
+		{"not ready", `{"jsonrpc":"2.0","id":5,"method":"internal_getTotalsRange","params":[0,"latest","time"]}`, `5`, errcodeNotReady},
+		{"handler failure", `{"jsonrpc":"2.0","id":6,"method":"test_fail"}`, `6`, errcodeInternal},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writeRequests(t, conn, test.request)
+
+			var response jsonrpcMessage
+			err := json.Unmarshal([]byte(readResponse(t, conn)), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(response.ID) != test.id {
+				t.Errorf("id is %s, want %s", response.ID, test.id)
+			}
+			if response.Error == nil {
+				t.Fatalf("result is %s, want error %d", response.Result, test.code)
+			}
+			if response.Error.Code != test.code {
+				t.Errorf("error is %d '%s', want %d", response.Error.Code, response.Error.Message, test.code)
+			}
+		})
+	}
+
+	// a message that is not JSON cannot echo an id
+	writeRequests(t, conn, `{"jsonrpc":`)
+	if response := readResponse(t, conn); !strings.HasPrefix(response, `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,`) {
+		t.Errorf("response to a parse error is %s", response)
+	}
+}
+
+// readBatch returns the responses of the next frame, which must be a batch.
+func readBatch(t *testing.T, conn *websocket.Conn) []jsonrpcMessage {
+	t.Helper()
+
+	response := readResponse(t, conn)
+
+	var responses []jsonrpcMessage
+	err := json.Unmarshal([]byte(response), &responses)
+	if err != nil {
+		t.Fatalf("response %s is not a batch: %v", response, err)
+	}
+
+	return responses
+}
+
+// readError returns the error of the next frame, which must be a single
+// error response.
+func readError(t *testing.T, conn *websocket.Conn) *jsonError {
+	t.Helper()
+
+	response := readResponse(t, conn)
+
+	var message jsonrpcMessage
+	err := json.Unmarshal([]byte(response), &message)
+	if err != nil || message.Error == nil {
+		t.Fatalf("response %s is not a single error: %v", response, err)
+	}
+
+	return message.Error
+}
+
+func TestClientBatch(t *testing.T) {
+	_, conn := dialTestHub(t, &Stats{})
+
+	// responses are in the order of the requests, without the notifications
+	writeRequests(t, conn, `[
+		{"jsonrpc":"2.0","id":1,"method":"eth_syncing"},
+		{"jsonrpc":"2.0","method":"eth_syncing"},
+		{"jsonrpc":"2.0","id":"b","method":"eth_unknown"},
+		{"jsonrpc":"2.0","method":"eth_unknown"},
+		{"jsonrpc":"2.0","id":3,"method":"eth_syncing"}
+	]`)
+
+	responses := readBatch(t, conn)
+	if len(responses) != 3 {
+		t.Fatalf("batch has %d responses, want 3", len(responses))
+	}
+	for i, id := range []string{`1`, `"b"`, `3`} {
+		if string(responses[i].ID) != id {
+			t.Errorf("response %d has id %s, want %s", i, responses[i].ID, id)
+		}
+	}
+	if string(responses[0].Result) != "false" || responses[0].Error != nil {
+		t.Errorf("response 0 is %s %v, want false", responses[0].Result, responses[0].Error)
+	}
+	if responses[1].Error == nil || responses[1].Error.Code != errcodeMethodNotFound {
+		t.Errorf("response 1 is %v, want error %d", responses[1].Error, errcodeMethodNotFound)
+	}
+}
+
+func TestClientBatchOfNotifications(t *testing.T) {
+	_, conn := dialTestHub(t, &Stats{})
+
+	// no frame is sent for the batch, so the next one answers the request
+	writeRequests(t, conn,
+		`[{"jsonrpc":"2.0","method":"eth_syncing"},{"jsonrpc":"2.0","method":"eth_unknown"}]`,
+		`{"jsonrpc":"2.0","id":7,"method":"eth_syncing"}`,
+	)
+
+	if response := readResponse(t, conn); response != `{"jsonrpc":"2.0","id":7,"result":false}` {
+		t.Errorf("first response is %s, want the one of the request with id 7", response)
+	}
+}
+
+func TestClientInvalidBatch(t *testing.T) {
+	_, conn := dialTestHub(t, &Stats{})
+
+	requests := make([]string, maxBatchRequests+1)
+	for i := range requests {
+		requests[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_syncing"}`, i)
+	}
+
+	tests := []struct {
+		name  string
+		batch string
+	}{
+		{"empty", `[]`},
+		{"too large", "[" + strings.Join(requests, ",") + "]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writeRequests(t, conn, test.batch)
+
+			if jsonErr := readError(t, conn); jsonErr.Code != errcodeInvalidRequest {
+				t.Errorf("error is %d '%s', want %d", jsonErr.Code, jsonErr.Message, errcodeInvalidRequest)
+			}
+		})
+	}
+
+	// a batch of exactly maxBatchRequests is answered
+	writeRequests(t, conn, "["+strings.Join(requests[:maxBatchRequests], ",")+"]")
+	if responses := readBatch(t, conn); len(responses) != maxBatchRequests {
+		t.Errorf("batch has %d responses, want %d", len(responses), maxBatchRequests)
+	}
+}
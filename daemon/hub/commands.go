@@ -0,0 +1,242 @@
+package hub
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/network"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+// NewStats connects to the node and the database and loads the stored blocks,
+// for commands that write blocks to the database and exit without serving.
+func NewStats(
+	gethEndpointHTTP string,
+	dbPath string,
+	networkConfig *network.Config,
+	workerCount int,
+	beaconEndpoint string,
+) (*Stats, error) {
+	s := &Stats{}
+
+	err := s.initializeClients(gethEndpointHTTP, dbPath, networkConfig, workerCount)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.initGetBlocksFromDB()
+	if err != nil {
+		return nil, err
+	}
+
+	if beaconEndpoint != "" {
+		err = s.initBeaconEndpoint(beaconEndpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// getBlockRange defaults from to the london block and to to the latest block.
+func (s *Stats) getBlockRange(from uint64, to uint64) (uint64, uint64, error) {
+	if from < s.londonBlock {
+		from = s.londonBlock
+	}
+
+	latestBlock := s.latestBlock.getBlockNumber()
+	if to == 0 || to > latestBlock {
+		to = latestBlock
+	}
+
+	if from > to {
+		return 0, 0, fmt.Errorf("invalid block range %d -> %d", from, to)
+	}
+
+	return from, to, nil
+}
+
+// Backfill fetches the blocks from -> to that are not stored in the database.
+func (s *Stats) Backfill(from uint64, to uint64) error {
+	from, to, err := s.getBlockRange(from, to)
+	if err != nil {
+		return err
+	}
+
+	missingBlockNumbers := s.blocks.getMissingBlocks(from, to)
+	for n := s.blocks.last() + 1; n <= to; n++ {
+		if n >= from {
+			missingBlockNumbers = append(missingBlockNumbers, n)
+		}
+	}
+
+	log.Infof("backfill: %d of %d blocks missing (%d -> %d)", len(missingBlockNumbers), to-from+1, from, to)
+
+	if len(missingBlockNumbers) == 0 {
+		return nil
+	}
+
+	// backfill every run of consecutive missing blocks at once
+	start := missingBlockNumbers[0]
+	for i, n := range missingBlockNumbers {
+		if i+1 < len(missingBlockNumbers) && missingBlockNumbers[i+1] == n+1 {
+			continue
+		}
+
+		err = s.backfillBlocks("backfill", start, n, false)
+		if err != nil {
+			return err
+		}
+
+		if i+1 < len(missingBlockNumbers) {
+			start = missingBlockNumbers[i+1]
+		}
+	}
+
+	return nil
+}
+
+// Reprocess fetches the blocks from -> to again and overwrites the stored
+// ones. With force the responses cached by the proxy are refreshed as well.
+func (s *Stats) Reprocess(from uint64, to uint64, force bool) error {
+	from, to, err := s.getBlockRange(from, to)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("reprocess: %d blocks (%d -> %d)", to-from+1, from, to)
+
+	return s.backfillBlocks("reprocess", from, to, force)
+}
+
+// RebuildTotals recomputes and stores the aggregates of the blocks written
+// from the block from, up to the highest stored block or the first one missing
+// after from. The blocks after a missing one are rebuilt once it is
+// backfilled.
+func (s *Stats) RebuildTotals(from uint64) error {
+	highestBlockInDB, err := s.db.GetHighestBlockNumber()
+	if err != nil {
+		return err
+	}
+
+	if from < s.londonBlock {
+		from = s.londonBlock
+	}
+
+	if highestBlockInDB < from {
+		return nil
+	}
+
+	err = s.rewindAggregatesCheckpoint(from - 1)
+	if err != nil {
+		return err
+	}
+
+	// the aggregates before from that were out of date are rebuilt as well
+	checkpoint, err := s.getTotalsCheckpoint(aggregatesCheckpoint)
+	if err != nil {
+		return err
+	}
+	if checkpoint+1 < from {
+		from = checkpoint + 1
+	}
+
+	to := highestBlockInDB
+	missingBlockNumbers := s.blocks.getMissingBlocks(from, to)
+	if len(missingBlockNumbers) > 0 {
+		to = missingBlockNumbers[0] - 1
+		log.Warnf("rebuild-totals: block %d is missing, only rebuilding the totals of blocks %d -> %d", missingBlockNumbers[0], from, to)
+	}
+
+	if to < from {
+		return nil
+	}
+
+	log.Infof("rebuild-totals: %d blocks (%d -> %d)", to-from+1, from, to)
+
+	return s.loadTotals(to)
+}
+
+// ImportUSDPrices stores the candles of a CSV file of ETH/USD prices, and
+// records their price in the blocks from -> to produced during them that
+// have none, or in every one of them with overwrite. Every candle lasts
+// duration seconds, or the shortest time between two of them when it is 0.
+func (s *Stats) ImportUSDPrices(r io.Reader, source string, duration uint64, from uint64, to uint64, overwrite bool) error {
+	usdPrices, err := readUSDPriceCandles(r, source, duration)
+	if err != nil {
+		return fmt.Errorf("error reading candles: %v", err)
+	}
+
+	err = s.db.AddUSDPrices(usdPrices)
+	if err != nil {
+		return fmt.Errorf("error adding usd prices to database: %v", err)
+	}
+	s.usdPrices.addPrices(usdPrices...)
+
+	first, last := usdPrices[0], usdPrices[len(usdPrices)-1]
+	log.Infof("import-prices: %d candles of %ds (%d -> %d)", len(usdPrices), first.Duration, first.Timestamp, last.Timestamp+last.Duration)
+
+	from, to, err = s.getBlockRange(from, to)
+	if err != nil {
+		return err
+	}
+
+	// the blocks before the candles can not change
+	if start := s.blocks.searchTimestamp(first.Timestamp); start > from {
+		from = start
+	}
+
+	firstChange := uint64(0)
+	changeCount := 0
+	for start := from; start <= to; start += totalsStoreSize {
+		end := start + totalsStoreSize - 1
+		if end > to {
+			end = to
+		}
+
+		allBlockStats, err := s.db.GetBlockStatsRange(start, end)
+		if err != nil {
+			return fmt.Errorf("error getting blocks from database: %v", err)
+		}
+
+		var changedBlockStats []sql.BlockStats
+		for _, b := range allBlockStats {
+			price, ok := s.usdPrices.getPrice(b.Timestamp)
+			if !ok || price == b.USDPrice || (b.USDPrice != 0 && !overwrite) {
+				continue
+			}
+
+			b.USDPrice = price
+			changedBlockStats = append(changedBlockStats, b)
+		}
+
+		if len(changedBlockStats) == 0 {
+			continue
+		}
+
+		err = s.db.SetBlockUSDPrices(changedBlockStats)
+		if err != nil {
+			return fmt.Errorf("error setting usd prices of blocks %d -> %d: %v", start, end, err)
+		}
+		s.blocks.addBlocks(changedBlockStats...)
+
+		if changeCount == 0 {
+			firstChange = uint64(changedBlockStats[0].Number)
+		}
+		changeCount += len(changedBlockStats)
+	}
+
+	log.Infof("import-prices: %d blocks priced (%d -> %d)", changeCount, from, to)
+
+	if changeCount == 0 {
+		return nil
+	}
+
+	// the epochs are valued at the price of the block they are credited to
+	if s.consensusIssuance != nil {
+		s.consensusIssuance.setUSDPrices(s.getEpochUSDPrice)
+	}
+
+	return s.rewindAggregatesCheckpoint(firstChange - 1)
+}
@@ -0,0 +1,68 @@
+package hub
+
+import (
+	"testing"
+)
+
+// checkAggregatesCheckpoint checks the last block included in the stored
+// aggregates.
+func checkAggregatesCheckpoint(t *testing.T, s *Stats, want uint64) {
+	t.Helper()
+
+	checkpoint, ok, err := s.db.GetCheckpoint(aggregatesCheckpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || checkpoint != want {
+		t.Errorf("aggregates checkpoint is %d, want %d", checkpoint, want)
+	}
+}
+
+func TestRebuildTotalsStopsAtGap(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 140)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 120)
+
+	err := s.loadTotals(120)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the commands run up to the latest block of the node, the blocks 121 ->
+	// 129 are missing above the reprocessed range
+	s.latestBlock.updateBlockNumber(140)
+	err = s.Backfill(130, 140)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Reprocess(110, 115, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAggregatesCheckpoint(t, s, 109)
+
+	err = s.RebuildTotals(110)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAggregatesCheckpoint(t, s, 120)
+
+	// nothing is rebuilt from a missing block
+	err = s.RebuildTotals(125)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAggregatesCheckpoint(t, s, 120)
+
+	// the blocks after the gap are rebuilt once it is backfilled
+	err = s.Backfill(121, 140)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.RebuildTotals(121)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAggregatesCheckpoint(t, s, 140)
+}
@@ -0,0 +1,323 @@
+package hub
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+// epochsPerStore is how many epochs are fetched while catching up before they
+// are stored.
+const epochsPerStore = 1000
+
+// ConsensusIssuance defines a mutexed list of the cumulative consensus layer
+// issuance at the end of every fetched epoch, and of its value in millionths
+// of a dollar at the price of the block each epoch is credited to.
+type ConsensusIssuance struct {
+	mu            sync.Mutex
+	epochs        []uint64
+	endTimestamps []uint64
+	cumulative    []*big.Int
+	cumulativeUSD []int64
+
+	// refreshFrom is the end timestamp of the first epoch added since the
+	// totals were last refreshed, 0 when they are up to date
+	refreshFrom uint64
+}
+
+func newConsensusIssuance() *ConsensusIssuance {
+	return &ConsensusIssuance{}
+}
+
+// addEpoch appends an epoch, epochs must be added in order.
+func (ci *ConsensusIssuance) addEpoch(epoch uint64, endTimestamp uint64, issuance *big.Int, usdPrice float64) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	cumulative := new(big.Int).Set(issuance)
+	cumulativeUSD := usdMicros(issuance, usdPrice)
+	if len(ci.cumulative) > 0 {
+		cumulative.Add(cumulative, ci.cumulative[len(ci.cumulative)-1])
+		cumulativeUSD += ci.cumulativeUSD[len(ci.cumulativeUSD)-1]
+	}
+
+	ci.epochs = append(ci.epochs, epoch)
+	ci.endTimestamps = append(ci.endTimestamps, endTimestamp)
+	ci.cumulative = append(ci.cumulative, cumulative)
+	ci.cumulativeUSD = append(ci.cumulativeUSD, cumulativeUSD)
+}
+
+// setUSDPrices values the issuance of every epoch again at the price returned
+// by usdPrice for its end timestamp.
+func (ci *ConsensusIssuance) setUSDPrices(usdPrice func(endTimestamp uint64) float64) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	previous := big.NewInt(0)
+	cumulativeUSD := int64(0)
+	for i, cumulative := range ci.cumulative {
+		issuance := new(big.Int).Sub(cumulative, previous)
+		cumulativeUSD += usdMicros(issuance, usdPrice(ci.endTimestamps[i]))
+		ci.cumulativeUSD[i] = cumulativeUSD
+		previous = cumulative
+	}
+}
+
+// requestRefresh marks the totals of the blocks produced at or after
+// timestamp as out of date.
+func (ci *ConsensusIssuance) requestRefresh(timestamp uint64) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	if ci.refreshFrom == 0 || timestamp < ci.refreshFrom {
+		ci.refreshFrom = timestamp
+	}
+}
+
+// takeRefresh returns the timestamp the totals are out of date from, false
+// if they are up to date, and marks them as up to date.
+func (ci *ConsensusIssuance) takeRefresh() (uint64, bool) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	timestamp := ci.refreshFrom
+	ci.refreshFrom = 0
+
+	return timestamp, timestamp != 0
+}
+
+// nextEpoch returns the epoch after the last one added.
+func (ci *ConsensusIssuance) nextEpoch() (uint64, bool) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	if len(ci.epochs) == 0 {
+		return 0, false
+	}
+
+	return ci.epochs[len(ci.epochs)-1] + 1, true
+}
+
+// getCumulative returns the issuance of every epoch that ended at or before
+// timestamp, and its value in millionths of a dollar.
+func (ci *ConsensusIssuance) getCumulative(timestamp uint64) (*big.Int, int64) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	i := sort.Search(len(ci.endTimestamps), func(i int) bool { return ci.endTimestamps[i] > timestamp })
+	if i == 0 {
+		return big.NewInt(0), 0
+	}
+
+	return new(big.Int).Set(ci.cumulative[i-1]), ci.cumulativeUSD[i-1]
+}
+
+// getIssuance returns the issuance of the epochs that ended after startTime
+// and at or before endTime, and its value in millionths of a dollar.
+func (ci *ConsensusIssuance) getIssuance(startTime uint64, endTime uint64) (*big.Int, int64) {
+	issuance, issuanceUSD := ci.getCumulative(endTime)
+	startIssuance, startIssuanceUSD := ci.getCumulative(startTime)
+
+	return issuance.Sub(issuance, startIssuance), issuanceUSD - startIssuanceUSD
+}
+
+// getConsensusIssuance returns the consensus layer issuance credited to a
+// block produced at endTime whose parent was produced at startTime, and its
+// value in millionths of a dollar.
+func (s *Stats) getConsensusIssuance(startTime uint64, endTime uint64) (*big.Int, int64) {
+	if s.consensusIssuance == nil {
+		return big.NewInt(0), 0
+	}
+
+	return s.consensusIssuance.getIssuance(startTime, endTime)
+}
+
+func (s *Stats) getEpochEndTimestamp(epoch uint64) uint64 {
+	return s.beaconGenesisTime + (epoch+1)*slotsPerEpoch*secondsPerSlot
+}
+
+func (s *Stats) initConsensusIssuance(beaconEndpoint string) error {
+	log.Infof("Initialize beaconClient '%s'", beaconEndpoint)
+
+	s.beaconClient = &BeaconClient{
+		endpoint:   beaconEndpoint,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+
+	genesisTime, err := s.beaconClient.getGenesisTime()
+	if err != nil {
+		return fmt.Errorf("failed to get genesis time from beacon node: %v", err)
+	}
+	s.beaconGenesisTime = genesisTime
+
+	s.consensusIssuance = newConsensusIssuance()
+
+	allEpochStats, err := s.db.GetAllEpochStats()
+	if err != nil {
+		return fmt.Errorf("error getting epochs from database: %v", err)
+	}
+
+	err = s.addEpochStats(allEpochStats)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("init: ConsensusIssuance - Imported %d epochs", len(allEpochStats))
+
+	return nil
+}
+
+// addEpochStats adds the issuance of epochs read from the database.
+func (s *Stats) addEpochStats(allEpochStats []sql.EpochStats) error {
+	for _, e := range allEpochStats {
+		s.consensusIssuance.addEpoch(uint64(e.Epoch), e.Timestamp, e.Issuance.ToInt(), s.getEpochUSDPrice(e.Timestamp))
+	}
+
+	return nil
+}
+
+// watchConsensusIssuance fetches the issuance of every finalized epoch since
+// the merge, the totals of the blocks they are credited to are refreshed
+// when the next head is processed.
+func (s *Stats) watchConsensusIssuance() {
+	for {
+		err := s.updateConsensusIssuance()
+		if err != nil {
+			log.Errorf("error updating consensus issuance: %v", err)
+		}
+
+		time.Sleep(slotsPerEpoch * secondsPerSlot * time.Second)
+	}
+}
+
+func (s *Stats) updateConsensusIssuance() error {
+	finalizedEpoch, err := s.beaconClient.getFinalizedEpoch()
+	if err != nil {
+		return fmt.Errorf("failed to get finalized epoch from beacon node: %v", err)
+	}
+
+	nextEpoch, ok := s.consensusIssuance.nextEpoch()
+	if !ok {
+		nextEpoch = (s.parisTimestamp - s.beaconGenesisTime) / (slotsPerEpoch * secondsPerSlot)
+	}
+
+	// the totals are refreshed once after catching up, even if fetching an
+	// epoch failed after others were added
+	epochCount, err := s.fetchEpochs(nextEpoch, finalizedEpoch)
+	if epochCount > 0 {
+		s.consensusIssuance.requestRefresh(s.getEpochEndTimestamp(nextEpoch))
+	}
+
+	return err
+}
+
+// fetchEpochs adds and stores the issuance of the epochs from -> to - 1, and
+// returns how many were added.
+func (s *Stats) fetchEpochs(from uint64, to uint64) (int, error) {
+	epochCount := 0
+
+	// attestation rewards of an epoch are only final once the next epoch is
+	var batchEpochStats []sql.EpochStats
+	for epoch := from; epoch < to; epoch++ {
+		start := time.Now()
+
+		issuance, err := s.beaconClient.getEpochIssuance(epoch)
+		if err != nil {
+			// the epochs added are stored so they are not fetched again
+			if storeErr := s.storeEpochs(batchEpochStats); storeErr != nil {
+				log.Errorf("error storing epochs: %v", storeErr)
+			}
+			return epochCount, err
+		}
+
+		endTimestamp := s.getEpochEndTimestamp(epoch)
+		s.consensusIssuance.addEpoch(epoch, endTimestamp, issuance, s.getEpochUSDPrice(endTimestamp))
+		epochCount++
+		batchEpochStats = append(batchEpochStats, sql.EpochStats{
+			Epoch:     uint(epoch),
+			Timestamp: endTimestamp,
+			Issuance:  sql.NewBig(issuance),
+		})
+
+		duration := time.Since(start) / time.Millisecond
+		log.Debugf("epoch: %d, issuance: %s gwei, ptime: %dms", epoch, new(big.Int).Div(issuance, big.NewInt(1_000_000_000)).String(), duration)
+
+		if len(batchEpochStats) == epochsPerStore || epoch == to-1 {
+			err = s.storeEpochs(batchEpochStats)
+			if err != nil {
+				return epochCount, err
+			}
+
+			log.Infof("consensus issuance fetched up to epoch %d of %d", epoch, to-1)
+			batchEpochStats = nil
+		}
+	}
+
+	return epochCount, nil
+}
+
+// storeEpochs stores the issuance of consecutive epochs.
+func (s *Stats) storeEpochs(allEpochStats []sql.EpochStats) error {
+	if len(allEpochStats) == 0 {
+		return nil
+	}
+
+	// the stored aggregates do not include the epochs until the totals are
+	// refreshed, so they are computed again on the next start if they are not
+	blockNumber := s.blocks.searchTimestamp(allEpochStats[0].Timestamp)
+	err := s.rewindAggregatesCheckpoint(blockNumber - 1)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.AddEpochs(allEpochStats)
+	if err != nil {
+		return fmt.Errorf("error adding epochs to database: %v", err)
+	}
+
+	return nil
+}
+
+// refreshConsensusIssuance refreshes the totals of the blocks the epochs added
+// since the last refresh are credited to. It is called before processing a
+// head, so the totals are never refreshed while a block is processed.
+func (s *Stats) refreshConsensusIssuance() {
+	if s.consensusIssuance == nil {
+		return
+	}
+
+	timestamp, ok := s.consensusIssuance.takeRefresh()
+	if !ok {
+		return
+	}
+
+	err := s.refreshTotalsFromTimestamp(timestamp)
+	if err != nil {
+		log.Errorf("error refreshing totals with the consensus issuance: %v", err)
+		s.consensusIssuance.requestRefresh(timestamp)
+	}
+}
+
+// refreshTotalsFromTimestamp recomputes the aggregates of every block
+// produced at or after timestamp.
+func (s *Stats) refreshTotalsFromTimestamp(timestamp uint64) error {
+	latestBlockNumber := s.latestBlock.getBlockNumber()
+
+	blockNumber := s.blocks.searchTimestamp(timestamp)
+	if blockNumber > latestBlockNumber {
+		// no block has been produced since timestamp yet
+		return nil
+	}
+
+	err := s.refreshAggregateTotals(blockNumber)
+	if err != nil {
+		return fmt.Errorf("error refreshing aggregate totals from block %d: %v", blockNumber, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// fakeBeacon is a beacon node whose slots are all missed and whose epochs
+// issue epoch+1 gwei of attestation rewards.
+type fakeBeacon struct {
+	mu             sync.Mutex
+	finalizedEpoch uint64
+
+	// failedEpoch is the epoch whose rewards can not be fetched, 0 if none
+	failedEpoch uint64
+}
+
+func (b *fakeBeacon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/eth/v1/beacon/states/head/finality_checkpoints":
+		fmt.Fprintf(w, `{"data":{"finalized":{"epoch":"%d"}}}`, b.finalizedEpoch)
+	case strings.HasPrefix(r.URL.Path, "/eth/v1/beacon/rewards/attestations/"):
+		var epoch uint64
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/eth/v1/beacon/rewards/attestations/"), "%d", &epoch)
+		if epoch == b.failedEpoch && epoch != 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"total_rewards": []map[string]string{{"head": fmt.Sprint(epoch + 1)}},
+			},
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (b *fakeBeacon) set(finalizedEpoch uint64, failedEpoch uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.finalizedEpoch = finalizedEpoch
+	b.failedEpoch = failedEpoch
+}
+
+// dayRewards returns the rewards of the latest UTC day.
+func dayRewards(t *testing.T, s *Stats) *big.Int {
+	t.Helper()
+
+	days := s.aggregates["day"].getTotals(1)
+	if len(days) != 1 {
+		t.Fatalf("%d days, want 1", len(days))
+	}
+	rewards, err := hexutil.DecodeBig(days[0].Rewards)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rewards
+}
+
+func TestUpdateConsensusIssuance(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 260)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 250)
+
+	// the blocks 100 -> 250 are all produced on the same day
+	err := s.loadTotals(250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewards := dayRewards(t, s)
+
+	// epoch 0 ends when block 100 is produced, and every epoch lasts 32
+	// blocks
+	beacon := &fakeBeacon{}
+	server := httptest.NewServer(beacon)
+	t.Cleanup(server.Close)
+	s.beaconClient = &BeaconClient{endpoint: server.URL, httpClient: server.Client()}
+	s.beaconGenesisTime = fakeTimestamp(testLondonBlock) - slotsPerEpoch*secondsPerSlot
+	s.parisTimestamp = s.beaconGenesisTime
+	s.consensusIssuance = newConsensusIssuance()
+
+	// fetching epoch 2 fails after epoch 0 and 1 are added, they are stored
+	// and refreshed anyway
+	beacon.set(4, 2)
+	if s.updateConsensusIssuance() == nil {
+		t.Fatal("epoch 2 is fetched")
+	}
+	if nextEpoch, _ := s.consensusIssuance.nextEpoch(); nextEpoch != 2 {
+		t.Fatalf("next epoch is %d, want 2", nextEpoch)
+	}
+	if timestamp := s.consensusIssuance.refreshFrom; timestamp != s.getEpochEndTimestamp(0) {
+		t.Errorf("refresh is from %d, want %d", timestamp, s.getEpochEndTimestamp(0))
+	}
+
+	beacon.set(4, 0)
+	err = s.updateConsensusIssuance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allEpochStats, err := s.db.GetAllEpochStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allEpochStats) != 4 {
+		t.Errorf("%d epochs are stored, want 4", len(allEpochStats))
+	}
+
+	// the stored aggregates are out of date until the refresh
+	checkpoint, _, err := s.db.GetCheckpoint(aggregatesCheckpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint != testLondonBlock-1 {
+		t.Errorf("aggregates checkpoint is %d, want %d", checkpoint, testLondonBlock-1)
+	}
+
+	// the epochs are not in the aggregates until the next head is processed,
+	// which refreshes them once from the first epoch added
+	if dayRewards(t, s).Cmp(rewards) != 0 {
+		t.Errorf("aggregates are refreshed before the next head")
+	}
+	if timestamp := s.consensusIssuance.refreshFrom; timestamp != s.getEpochEndTimestamp(0) {
+		t.Errorf("refresh is from %d, want %d", timestamp, s.getEpochEndTimestamp(0))
+	}
+
+	processBlocks(t, s, 251, 251)
+	if _, ok := s.consensusIssuance.takeRefresh(); ok {
+		t.Error("refresh is still pending after the head")
+	}
+	checkpoint, _, err = s.db.GetCheckpoint(aggregatesCheckpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint != 250 {
+		t.Errorf("aggregates checkpoint after the refresh is %d, want 250", checkpoint)
+	}
+
+	// 1 + 2 + 3 + 4 gwei, the blocks have no reward
+	rewards.Add(rewards, big.NewInt(10_000_000_000))
+	err = s.updateAggregateTotals(251)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dayRewards := dayRewards(t, s); dayRewards.Cmp(rewards) != 0 {
+		t.Errorf("day rewards are %s, want %s", dayRewards, rewards)
+	}
+
+	// nothing is refreshed when no epoch was finalized
+	err = s.updateConsensusIssuance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.consensusIssuance.takeRefresh(); ok {
+		t.Error("refresh is requested without new epochs")
+	}
+}
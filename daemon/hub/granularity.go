@@ -0,0 +1,140 @@
+package hub
+
+import (
+	"strings"
+	"time"
+)
+
+// Granularity defines a length of period the totals are aggregated over.
+type Granularity struct {
+	Name string
+
+	// start returns the beginning of the period containing t, in the
+	// location of t. Days are 23 or 25 hours long when the clock changes.
+	start func(t time.Time) time.Time
+
+	// next returns the beginning of the period after the one beginning at t.
+	next func(t time.Time) time.Time
+}
+
+// granularities are the registered granularities, from the shortest to the
+// longest.
+var granularities = []Granularity{
+	{
+		// the wall clock hour, so it is not ambiguous when the clock is set
+		// back and follows offsets that are not whole hours. An hour the
+		// clock changes in by less than an hour starts or ends at the change.
+		Name:  "hour",
+		start: getHourStart,
+		next:  func(t time.Time) time.Time { return getHourStart(t.Add(1 * time.Hour)) },
+	},
+	{
+		Name: "day",
+		start: func(t time.Time) time.Time {
+			year, month, day := t.Date()
+			return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+		},
+		next: func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+	},
+	{
+		// ISO 8601 weeks start on monday
+		Name: "week",
+		start: func(t time.Time) time.Time {
+			year, month, day := t.Date()
+			daysSinceMonday := (int(t.Weekday()) + 6) % 7
+			return time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, t.Location())
+		},
+		next: func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+	},
+	{
+		Name: "month",
+		start: func(t time.Time) time.Time {
+			year, month, _ := t.Date()
+			return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+		},
+		next: func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+	},
+	{
+		Name: "year",
+		start: func(t time.Time) time.Time {
+			return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+		},
+		next: func(t time.Time) time.Time { return t.AddDate(1, 0, 0) },
+	},
+}
+
+// getHourStart returns the beginning of the wall clock hour containing t, or
+// the time the clock changed at if it changed later in that hour.
+func getHourStart(t time.Time) time.Time {
+	_, minute, second := t.Clock()
+	start := t.Add(-time.Duration(minute*60+second)*time.Second - time.Duration(t.Nanosecond()))
+
+	_, offset := t.Zone()
+	if _, startOffset := start.Zone(); startOffset != offset {
+		return getZoneChange(start, t)
+	}
+
+	return start
+}
+
+// getZoneChange returns the time the offset of the location of to changed
+// at, after from and at or before to, from must have another offset.
+func getZoneChange(from time.Time, to time.Time) time.Time {
+	_, offset := to.Zone()
+	for to.Sub(from) > time.Second {
+		middle := from.Add(to.Sub(from) / 2)
+		if _, middleOffset := middle.Zone(); middleOffset == offset {
+			to = middle
+		} else {
+			from = middle
+		}
+	}
+
+	// the offsets change on whole seconds
+	return to.Truncate(time.Second)
+}
+
+func getGranularity(name string) (Granularity, bool) {
+	for _, g := range granularities {
+		if g.Name == name {
+			return g, true
+		}
+	}
+
+	return Granularity{}, false
+}
+
+func getGranularityNames() []string {
+	names := make([]string, len(granularities))
+	for i, g := range granularities {
+		names[i] = g.Name
+	}
+
+	return names
+}
+
+// startFromEpoch returns the beginning of the period containing epoch.
+func (g Granularity) startFromEpoch(epoch uint64) time.Time {
+	return g.start(time.Unix(int64(epoch), 0).UTC())
+}
+
+// key returns the name of the series in AggregatesData, like totalsPerDay.
+func (g Granularity) key() string {
+	return "totalsPer" + strings.ToUpper(g.Name[:1]) + g.Name[1:]
+}
+
+// subscription returns the name of the subscription to the updates of the
+// latest period.
+func (g Granularity) subscription() string {
+	return "aggregatesData:" + g.Name
+}
+
+func isGranularitySubscription(subscription string) bool {
+	for _, g := range granularities {
+		if g.subscription() == subscription {
+			return true
+		}
+	}
+
+	return false
+}
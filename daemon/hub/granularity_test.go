@@ -0,0 +1,179 @@
+package hub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// mustParseUTC returns the time of value, formatted like 2021-11-07T05:30,
+// in UTC.
+func mustParseUTC(t *testing.T, value string) time.Time {
+	t.Helper()
+
+	parsed, err := time.Parse("2006-01-02T15:04", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parsed
+}
+
+func TestGranularityDaylightSaving(t *testing.T) {
+	// the times are in UTC, as the wall clock is ambiguous when it is set back
+	tests := []struct {
+		name        string
+		zone        string
+		granularity string
+		time        string
+		start       string
+		next        string
+		length      time.Duration
+	}{
+		// new york moves from EST (-5) to EDT (-4) on 2021-03-14 at 02:00,
+		// and back to EST on 2021-11-07 at 02:00
+		{"spring forward day", "America/New_York", "day", "2021-03-14T12:00", "2021-03-14T05:00", "2021-03-15T04:00", 23 * time.Hour},
+		{"fall back day", "America/New_York", "day", "2021-11-07T12:00", "2021-11-07T04:00", "2021-11-08T05:00", 25 * time.Hour},
+		{"hour before spring forward", "America/New_York", "hour", "2021-03-14T06:30", "2021-03-14T06:00", "2021-03-14T07:00", time.Hour},
+		{"hour after spring forward", "America/New_York", "hour", "2021-03-14T07:30", "2021-03-14T07:00", "2021-03-14T08:00", time.Hour},
+		{"first 01:30 when falling back", "America/New_York", "hour", "2021-11-07T05:30", "2021-11-07T05:00", "2021-11-07T06:00", time.Hour},
+		{"second 01:30 when falling back", "America/New_York", "hour", "2021-11-07T06:30", "2021-11-07T06:00", "2021-11-07T07:00", time.Hour},
+		{"spring forward week", "America/New_York", "week", "2021-03-14T12:00", "2021-03-08T05:00", "2021-03-15T04:00", 167 * time.Hour},
+		{"spring forward month", "America/New_York", "month", "2021-03-20T00:00", "2021-03-01T05:00", "2021-04-01T04:00", 743 * time.Hour},
+		{"fall back month", "America/New_York", "month", "2021-11-20T00:00", "2021-11-01T04:00", "2021-12-01T05:00", 721 * time.Hour},
+
+		// lord howe moves from LHDT (+11) to LHST (+10:30) on 2021-04-04 at
+		// 02:00, and back to LHDT on 2021-10-03 at 02:00
+		{"fall back day by half an hour", "Australia/Lord_Howe", "day", "2021-04-04T00:00", "2021-04-03T13:00", "2021-04-04T13:30", 24*time.Hour + 30*time.Minute},
+		{"spring forward day by half an hour", "Australia/Lord_Howe", "day", "2021-10-03T00:00", "2021-10-02T13:30", "2021-10-03T13:00", 23*time.Hour + 30*time.Minute},
+		{"hour before falling back", "Australia/Lord_Howe", "hour", "2021-04-03T14:45", "2021-04-03T14:00", "2021-04-03T15:00", time.Hour},
+		{"half hour after falling back", "Australia/Lord_Howe", "hour", "2021-04-03T15:15", "2021-04-03T15:00", "2021-04-03T15:30", 30 * time.Minute},
+		{"hour after falling back", "Australia/Lord_Howe", "hour", "2021-04-03T15:45", "2021-04-03T15:30", "2021-04-03T16:30", time.Hour},
+		{"hour before springing forward", "Australia/Lord_Howe", "hour", "2021-10-02T15:15", "2021-10-02T14:30", "2021-10-02T15:30", time.Hour},
+		{"half hour after springing forward", "Australia/Lord_Howe", "hour", "2021-10-02T15:45", "2021-10-02T15:30", "2021-10-02T16:00", 30 * time.Minute},
+		{"spring forward month by half an hour", "Australia/Lord_Howe", "month", "2021-10-15T00:00", "2021-09-30T13:30", "2021-10-31T13:00", 743*time.Hour + 30*time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			location, err := time.LoadLocation(test.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g, ok := getGranularity(test.granularity)
+			if !ok {
+				t.Fatalf("granularity %s is not registered", test.granularity)
+			}
+
+			start := g.start(mustParseUTC(t, test.time).In(location))
+			if want := mustParseUTC(t, test.start); !start.Equal(want) {
+				t.Errorf("start is %v, want %v", start.UTC(), want)
+			}
+			if start.Location() != location {
+				t.Errorf("start is in %v, want %v", start.Location(), location)
+			}
+
+			next := g.next(start)
+			if want := mustParseUTC(t, test.next); !next.Equal(want) {
+				t.Errorf("next is %v, want %v", next.UTC(), want)
+			}
+			if length := next.Sub(start); length != test.length {
+				t.Errorf("length is %v, want %v", length, test.length)
+			}
+		})
+	}
+}
+
+func TestGranularityPeriodsTile(t *testing.T) {
+	// every second of the year is in exactly one period
+	for _, zone := range []string{"UTC", "America/New_York", "Australia/Lord_Howe"} {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, g := range granularities {
+			end := time.Date(2022, 1, 1, 0, 0, 0, 0, location)
+			for period := g.start(time.Date(2021, 1, 1, 0, 0, 0, 0, location)); period.Before(end); period = g.next(period) {
+				next := g.next(period)
+				if !next.After(period) {
+					t.Fatalf("%s %s: next of %v is %v", zone, g.Name, period, next)
+				}
+				if start := g.start(period); !start.Equal(period) {
+					t.Fatalf("%s %s: start of %v is %v", zone, g.Name, period, start)
+				}
+				if start := g.start(next.Add(-time.Second)); !start.Equal(period) {
+					t.Fatalf("%s %s: start of %v is %v, want %v", zone, g.Name, next.Add(-time.Second), start, period)
+				}
+			}
+		}
+	}
+}
+
+func TestGranularityWeeksAndYears(t *testing.T) {
+	tests := []struct {
+		granularity string
+		time        string
+		start       string
+		next        string
+	}{
+		// ISO 8601 weeks start on monday, 2021-01-01 is a friday in the
+		// last week of 2020
+		{"week", "2020-12-28T00:00", "2020-12-28T00:00", "2021-01-04T00:00"},
+		{"week", "2020-12-31T12:00", "2020-12-28T00:00", "2021-01-04T00:00"},
+		{"week", "2021-01-01T00:00", "2020-12-28T00:00", "2021-01-04T00:00"},
+		{"week", "2021-01-03T23:59", "2020-12-28T00:00", "2021-01-04T00:00"},
+		{"week", "2021-01-04T00:00", "2021-01-04T00:00", "2021-01-11T00:00"},
+
+		// 2020 is a leap year
+		{"year", "2020-02-29T12:00", "2020-01-01T00:00", "2021-01-01T00:00"},
+		{"year", "2020-12-31T23:59", "2020-01-01T00:00", "2021-01-01T00:00"},
+		{"year", "2021-01-01T00:00", "2021-01-01T00:00", "2022-01-01T00:00"},
+	}
+
+	for _, test := range tests {
+		g, ok := getGranularity(test.granularity)
+		if !ok {
+			t.Fatalf("granularity %s is not registered", test.granularity)
+		}
+
+		start := g.start(mustParseUTC(t, test.time))
+		if want := mustParseUTC(t, test.start); !start.Equal(want) {
+			t.Errorf("%s of %s starts at %v, want %v", test.granularity, test.time, start, want)
+		}
+		if next, want := g.next(start), mustParseUTC(t, test.next); !next.Equal(want) {
+			t.Errorf("%s after %v starts at %v, want %v", test.granularity, start, next, want)
+		}
+	}
+
+	week, _ := getGranularity("week")
+	if year, number := week.start(mustParseUTC(t, "2021-01-01T00:00")).ISOWeek(); year != 2020 || number != 53 {
+		t.Errorf("week of 2021-01-01 is week %d of %d, want week 53 of 2020", number, year)
+	}
+
+	year, _ := getGranularity("year")
+	if length := year.next(mustParseUTC(t, "2020-01-01T00:00")).Sub(mustParseUTC(t, "2020-01-01T00:00")); length != 366*24*time.Hour {
+		t.Errorf("2020 is %v long, want 366 days", length)
+	}
+	if key := year.key(); key != "totalsPerYear" {
+		t.Errorf("key of the years is %s, want totalsPerYear", key)
+	}
+	if subscription := year.subscription(); subscription != "aggregatesData:year" {
+		t.Errorf("subscription to the years is %s, want aggregatesData:year", subscription)
+	}
+}
+
+func TestInitialAggregatesDataUnknownGranularity(t *testing.T) {
+	h := &Hub{}
+
+	for _, params := range []string{`[10,["day","fortnight"]]`, `[10,[7]]`, `[10,"day"]`} {
+		_, err := h.handleInitialAggregatesData()(nil, jsonrpcMessage{Params: json.RawMessage(params)})
+		if err == nil {
+			t.Errorf("granularities of %s are accepted", params)
+			continue
+		}
+		if rpcErr, ok := err.(rpcError); !ok || rpcErr.ErrorCode() != errcodeInvalidParams {
+			t.Errorf("error of %s is %v, want invalid params", params, err)
+		}
+	}
+}
@@ -6,13 +6,19 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	gethRPC "github.com/ethereum/go-ethereum/rpc"
 	"github.com/gorilla/websocket"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/network"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
 	"github.com/mohamedmansour/ethereum-burn-stats/daemon/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 )
 
@@ -21,6 +27,7 @@ var log = logrus.StandardLogger()
 var allowedEthSubscriptions = map[string]bool{
 	"data":           true,
 	"aggregatesData": true,
+	"reorg":          true,
 }
 
 // Hub maintains the set of active clients and subscriptions messages to the
@@ -45,18 +52,29 @@ type Hub struct {
 	// block stats and totals
 	s *Stats
 
-	usd *USDPriceWatcher
+	prices *PriceWatcher
+
+	health HealthConfig
+
+	// initialize connects to the node or the database and loads the blocks,
+	// it runs while the health checks are served.
+	initialize func() error
 }
 
-// New initializes a Hub instance.
+// New creates a Hub instance, it is initialized by ListenAndServe.
 func New(
 	debug bool,
 	development bool,
 	gethEndpointHTTP string,
 	gethEndpointWebsocket string,
 	dbPath string,
-	ropsten bool,
+	networkConfig *network.Config,
 	workerCount int,
+	beaconEndpoint string,
+	readOnly bool,
+	health HealthConfig,
+	priceSources []PriceSource,
+	currencies []string,
 ) (*Hub, error) {
 	upgrader := &websocket.Upgrader{
 		ReadBufferSize:    1024,
@@ -76,8 +94,11 @@ func New(
 	subscription := make(chan map[string]interface{})
 	clients := make(map[*Client]bool)
 
-	s := &Stats{}
-	usd := &USDPriceWatcher{}
+	prices, err := NewPriceWatcher(priceSources, currencies)
+	if err != nil {
+		return nil, err
+	}
+	s := &Stats{prices: prices}
 
 	h := &Hub{
 		upgrader: upgrader,
@@ -87,19 +108,40 @@ func New(
 		unregister:   make(chan *Client),
 		clients:      clients,
 		s:            s,
-		usd:          usd,
+		prices:       prices,
+		health:       health,
 	}
+	prometheus.MustRegister(hubCollector{h})
+
+	h.initialize = func() error {
+		if readOnly {
+			err := s.initializeReadOnly(dbPath, networkConfig)
+			if err != nil {
+				return err
+			}
 
-	s.initialize(gethEndpointHTTP, dbPath, ropsten, workerCount)
+			h.initializeWebSocketHandlers()
+			go h.followDatabase()
+		} else {
+			err := s.initialize(gethEndpointHTTP, dbPath, networkConfig, workerCount, beaconEndpoint)
+			if err != nil {
+				return err
+			}
 
-	h.initializeWebSocketHandlers()
-	err := h.initializeGrpcWebSocket(gethEndpointWebsocket)
-	if err != nil {
-		return nil, err
+			h.initializeWebSocketHandlers()
+			err = h.initializeGrpcWebSocket(gethEndpointWebsocket)
+			if err != nil {
+				return err
+			}
+		}
+
+		s.health.setInitialized()
+
+		return nil
 	}
 
 	// Run this in a goroutine so it doesn't block the websocket from working.
-	go usd.StartWatching()
+	go prices.StartWatching()
 
 	return h, nil
 }
@@ -110,6 +152,9 @@ func (h *Hub) initializeWebSocketHandlers() {
 		// internal custom geth commands.
 		"internal_getInitialData":           h.handleInitialData(),
 		"internal_getInitialAggregatesData": h.handleInitialAggregatesData(),
+		"internal_getTotalsRange":           h.handleTotalsRange(),
+		"internal_getBlockStats":            h.s.getBlockStats(),
+		"internal_getBlockStatsRange":       h.s.getBlockStatsPage(),
 		"eth_syncing":                       h.ethSyncing(),
 
 		// proxy to geth
@@ -132,6 +177,7 @@ func (h *Hub) initializeGrpcWebSocket(gethEndpointWebsocket string) error {
 	if err != nil {
 		return fmt.Errorf("WebSocket cannot subscribe to newHeads: %v", err)
 	}
+	h.s.health.setSubscribed(true)
 
 	error_chan := make(chan bool)
 
@@ -140,13 +186,13 @@ func (h *Hub) initializeGrpcWebSocket(gethEndpointWebsocket string) error {
 			select {
 			case err := <-sub.Err():
 				log.Errorln("Geth WS Error: ", err)
+				h.s.health.setSubscribed(false)
 				time.Sleep(12 * time.Second)
 				error_chan <- true
 				return
 				
 			case header := <-headers:
-				// clientsCount is quantity of active subscriptions/users
-				clientsCount := len(h.clients)
+				atomic.StoreInt64(&metrics.nodeHead, header.Number.Int64())
 
 				// latestBlockNumber is highest processed block to date
 				latestBlockNumber := h.s.latestBlock.getBlockNumber()
@@ -155,89 +201,28 @@ func (h *Hub) initializeGrpcWebSocket(gethEndpointWebsocket string) error {
 				// This will make the hub discover the block slower but it will prevent
 				// the hub from processing the same block twice.
 				blockNumber := header.Number.Uint64() - 1
+				blockRepeated := blockNumber <= latestBlockNumber
 
-				if blockNumber <= latestBlockNumber {
+				// A repeated block is only processed again when the new head
+				// builds on a different parent than the one already stored.
+				if blockRepeated && !h.s.isOrphaned(blockNumber, header.ParentHash.Hex()) {
 					log.Warnf("block %s repeated", header.Number.String())
 					continue
 				}
 
 				// fetch current block, process stats, and update stats
-				blockStats, err := h.s.processBlock(blockNumber, false)
-				if err != nil {
-					log.Errorf("processBlock(%d, true): %v", blockNumber, err)
-					continue
-				}
-
-				// get totals stats for current block
-				totals, err := h.s.getTotals(blockNumber)
-				if err != nil {
-					log.Errorf("getTotals(%d): %v", blockNumber, err)
-					continue
-				}
-				
-				blockTime, err := h.s.getBlockTimestamp(blockNumber)
+				blockStats, reorg, err := h.s.processBlock(blockNumber, blockRepeated)
 				if err != nil {
-					log.Errorf("getBlockTimestamp(%d): %v", blockNumber, err)
+					log.Errorf("processBlock(%d, %t): %v", blockNumber, blockRepeated, err)
 					continue
 				}
 
-				// get totals stats for current block from 30 days prior
-				totalsMonth, err := h.s.getTotalsTimeDelta(blockTime-30*86400, blockTime)
-				if err != nil {
-					log.Errorf("getTotalsTimeDelta(%d,%d): %v", blockTime-30*86400, blockTime, err)
-					continue
-				}
-
-				// get totals stats for current block from 7 days prior
-				totalsWeek, err := h.s.getTotalsTimeDelta(blockTime-7*86400, blockTime)
-				if err != nil {
-					log.Errorf("getTotalsTimeDelta(%d,%d): %v", blockTime-7*86400, blockTime, err)
-					continue
+				// a reorg can replay blocks past the one of this head
+				if reorg != nil {
+					blockNumber = uint64(blockStats.Number)
 				}
 
-				// get totals stats for current block from 24 hours prior
-				totalsDay, err := h.s.getTotalsTimeDelta(blockTime-86400, blockTime)
-				if err != nil {
-					log.Errorf("getTotalsTimeDelta(%d,%d): %v", blockTime-86400, blockTime, err)
-					continue
-				}
-
-				// get totals stats for current block from 1 hour prior
-				totalsHour, err := h.s.getTotalsTimeDelta(blockTime-3600, blockTime)
-				if err != nil {
-					log.Errorf("getTotalsTimeDelta(%d,%d): %v", blockTime-3600, blockTime, err)
-					continue
-				}
-
-				// get baseFeeNext for current block
-				baseFeeNext, err := h.s.getBaseFeeNext(blockNumber)
-				if err != nil {
-					log.Errorf("getBaseFeeNext(%d): %v", blockNumber, err)
-					continue
-				}
-
-				h.s.updateAggregateTotals(blockNumber)
-
-				// broadcast new block to subscribers
-				h.subscription <- map[string]interface{}{
-					"data": &BlockData{
-						BaseFeeNext: baseFeeNext,
-						Block:       blockStats,
-						Clients:     int16(clientsCount),
-						Totals:      totals,
-						TotalsDay:   totalsDay,
-						TotalsHour:  totalsHour,
-						TotalsMonth: totalsMonth,
-						TotalsWeek:  totalsWeek,
-						Version:     version.Version,
-						USDPrice:    h.usd.GetPrice(),
-					},
-					"aggregatesData": &AggregatesData{
-						TotalsPerDay:   h.s.totalsPerDay.getTotals(1),
-						TotalsPerHour:  h.s.totalsPerHour.getTotals(1),
-						TotalsPerMonth: h.s.totalsPerMonth.getTotals(1),
-					},
-				}
+				h.broadcastBlock(blockNumber, blockStats, reorg)
 			}
 		}
 	}()
@@ -251,16 +236,149 @@ func (h *Hub) initializeGrpcWebSocket(gethEndpointWebsocket string) error {
 	return nil
 }
 
+// followDatabase broadcasts the blocks another daemon writes to the database.
+func (h *Hub) followDatabase() {
+	for {
+		time.Sleep(followInterval)
+
+		allBlockStats, reorg, err := h.s.pollDatabase()
+		h.s.health.setDBResult(err)
+		if err != nil {
+			log.Errorf("pollDatabase(): %v", err)
+			continue
+		}
+
+		// subscribers get the reorg once, before the data of the new blocks
+		for i, blockStats := range allBlockStats {
+			if i > 0 {
+				reorg = nil
+			}
+
+			h.broadcastBlock(uint64(blockStats.Number), blockStats, reorg)
+		}
+
+		if len(allBlockStats) == 0 && reorg != nil {
+			h.subscription <- map[string]interface{}{
+				"reorg": reorg,
+			}
+		}
+	}
+}
+
+// broadcastBlock sends the data of a processed block to the subscribers.
+func (h *Hub) broadcastBlock(blockNumber uint64, blockStats sql.BlockStats, reorg *ReorgData) {
+	// clientsCount is quantity of active subscriptions/users
+	clientsCount := len(h.clients)
+
+	// let subscribers drop the orphaned blocks before the new data
+	if reorg != nil {
+		h.subscription <- map[string]interface{}{
+			"reorg": reorg,
+		}
+	}
+
+	// get totals stats for current block
+	totals, err := h.s.getTotals(blockNumber)
+	if err != nil {
+		log.Errorf("getTotals(%d): %v", blockNumber, err)
+		return
+	}
+
+	blockTime, err := h.s.getBlockTimestamp(blockNumber)
+	if err != nil {
+		log.Errorf("getBlockTimestamp(%d): %v", blockNumber, err)
+		return
+	}
+
+	// the windows include the current block
+	windowEnd := blockTime + 1
+
+	// get totals stats for current block from 30 days prior
+	totalsMonth, err := h.s.getTotalsTimeDelta(windowEnd-30*86400, windowEnd)
+	if err != nil {
+		log.Errorf("getTotalsTimeDelta(%d,%d): %v", windowEnd-30*86400, windowEnd, err)
+		return
+	}
+
+	// get totals stats for current block from 7 days prior
+	totalsWeek, err := h.s.getTotalsTimeDelta(windowEnd-7*86400, windowEnd)
+	if err != nil {
+		log.Errorf("getTotalsTimeDelta(%d,%d): %v", windowEnd-7*86400, windowEnd, err)
+		return
+	}
+
+	// get totals stats for current block from 24 hours prior
+	totalsDay, err := h.s.getTotalsTimeDelta(windowEnd-86400, windowEnd)
+	if err != nil {
+		log.Errorf("getTotalsTimeDelta(%d,%d): %v", windowEnd-86400, windowEnd, err)
+		return
+	}
+
+	// get totals stats for current block from 1 hour prior
+	totalsHour, err := h.s.getTotalsTimeDelta(windowEnd-3600, windowEnd)
+	if err != nil {
+		log.Errorf("getTotalsTimeDelta(%d,%d): %v", windowEnd-3600, windowEnd, err)
+		return
+	}
+
+	// get baseFeeNext for current block
+	baseFeeNext, err := h.s.getBaseFeeNext(blockNumber)
+	if err != nil {
+		log.Errorf("getBaseFeeNext(%d): %v", blockNumber, err)
+		return
+	}
+
+	h.s.updateAggregateTotals(blockNumber)
+	h.s.health.setHeadProcessed()
+
+	// broadcast new block to subscribers
+	subscriptionMessage := map[string]interface{}{
+		"data": &BlockData{
+			BaseFeeNext:       baseFeeNext,
+			Block:             blockStats,
+			Clients:           int16(clientsCount),
+			Totals:            totals,
+			TotalsDay:         totalsDay,
+			TotalsHour:        totalsHour,
+			TotalsMonth:       totalsMonth,
+			TotalsWeek:        totalsWeek,
+			Version:           version.Version,
+			USDPrice:          h.prices.GetPrice(usdCurrency),
+			USDPriceTimestamp: h.prices.GetPriceTimestamp(usdCurrency),
+			Prices:            h.prices.GetPrices(),
+			PriceTimestamps:   h.prices.GetPriceTimestamps(),
+		},
+		"aggregatesData": h.getAggregatesData(granularities, 1),
+	}
+	for _, g := range granularities {
+		subscriptionMessage[g.subscription()] = h.getAggregatesData([]Granularity{g}, 1)
+	}
+	h.subscription <- subscriptionMessage
+}
+
+// getAggregatesData returns the latest periodCount periods of every
+// granularity.
+func (h *Hub) getAggregatesData(granularities []Granularity, periodCount int) AggregatesData {
+	data := AggregatesData{}
+	for _, g := range granularities {
+		data[g.key()] = h.s.aggregates[g.Name].getTotals(periodCount)
+	}
+
+	return data
+}
+
 func (h *Hub) listen() {
 	for {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
+			metrics.clients.Inc()
 
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				close(client.send)
+				client.close()
+				metrics.clients.Dec()
 			}
 
 		case subscriptionMessage := <-h.subscription:
@@ -272,6 +390,12 @@ func (h *Hub) listen() {
 						continue
 					}
 
+					if data, ok := message.(*BlockData); ok {
+						if currency := client.subscriptionCurrency(subscription); currency != "" {
+							message = data.withCurrency(currency)
+						}
+					}
+
 					b, err := json.Marshal(
 						map[string]interface{}{
 							"subscription": toBlockNumArg(subscriptionID),
@@ -305,8 +429,10 @@ func (h *Hub) listen() {
 					select {
 					case client.send <- b:
 					default:
-						close(client.send)
 						delete(h.clients, client)
+						client.close()
+						metrics.clients.Dec()
+						metrics.droppedClients.Inc()
 					}
 				}
 			}
@@ -314,19 +440,52 @@ func (h *Hub) listen() {
 	}
 }
 
-// ListenAndServe serves the hub on the given network address.
+// ListenAndServe initializes the hub and serves it on the given network
+// address, only the health checks and the metrics are served until it is
+// initialized.
 func (h *Hub) ListenAndServe(addr string) error {
 	go h.listen()
 
-	http.HandleFunc("/health", h.serveHealth)
-	http.HandleFunc("/", h.serveWebSocket)
+	http.HandleFunc("/health", h.whenInitialized(h.serveHealth))
+	http.HandleFunc("/livez", h.serveLivez)
+	http.HandleFunc("/readyz", h.serveReadyz)
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc(apiV1Prefix, h.whenInitialized(h.serveAPIV1))
+	http.HandleFunc("/", h.whenInitialized(h.serveWebSocket))
 
-	err := http.ListenAndServe(addr, nil)
-	if err != nil {
-		return err
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- http.ListenAndServe(addr, nil)
+	}()
+
+	initErr := make(chan error, 1)
+	go func() {
+		initErr <- h.initialize()
+	}()
+
+	for {
+		select {
+		case err := <-serveErr:
+			return err
+		case err := <-initErr:
+			if err != nil {
+				return err
+			}
+		}
 	}
+}
 
-	return nil
+// whenInitialized answers 503 to the requests made before the hub is
+// initialized.
+func (h *Hub) whenInitialized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.s.health.isInitialized() {
+			http.Error(w, "initializing", http.StatusServiceUnavailable)
+			return
+		}
+
+		handler(w, r)
+	}
 }
 
 func (h *Hub) serveWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -369,23 +528,32 @@ func (h *Hub) ethSubscribe() func(c *Client, message jsonrpcMessage) (json.RawMe
 		var params []interface{}
 		err = json.Unmarshal(b, &params)
 		if err != nil {
-			return nil, err
+			return nil, invalidParamsErrorf("invalid params: %v", err)
 		}
 
 		if len(params) == 0 {
-			return nil, fmt.Errorf("no parameters provided %s", message.Method)
+			return nil, invalidParamsErrorf("no parameters provided %s", message.Method)
 		}
 
 		subscription, ok := params[0].(string)
 		if !ok {
-			return nil, fmt.Errorf("subscription name is not a string - %s", params[0])
+			return nil, invalidParamsErrorf("subscription name is not a string - %s", params[0])
+		}
+
+		if !allowedEthSubscriptions[subscription] && !isGranularitySubscription(subscription) {
+			return nil, invalidParamsErrorf("subscription '%s' is not allowed", subscription)
 		}
 
-		if !allowedEthSubscriptions[subscription] {
-			return nil, fmt.Errorf("subscription '%s' is not allowed", subscription)
+		// the data subscription can pick a quote currency to get the price in
+		var currency string
+		if len(params) > 1 && subscription == "data" {
+			currency, err = h.parseCurrency(params[1])
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		subscrptionID, err := c.subscribeTo(subscription)
+		subscrptionID, err := c.subscribeTo(subscription, currency)
 		if err != nil {
 			return nil, err
 		}
@@ -394,6 +562,22 @@ func (h *Hub) ethSubscribe() func(c *Client, message jsonrpcMessage) (json.RawMe
 	}
 }
 
+// parseCurrency returns the quote currency of a request parameter, it must be
+// one of the watched currencies.
+func (h *Hub) parseCurrency(param interface{}) (string, error) {
+	currency, ok := param.(string)
+	if !ok {
+		return "", invalidParamsErrorf("currency is not a string - %v", param)
+	}
+
+	currency = strings.ToUpper(currency)
+	if !h.prices.IsWatching(currency) {
+		return "", invalidParamsErrorf("currency '%s' is not one of %v", currency, h.prices.Currencies())
+	}
+
+	return currency, nil
+}
+
 func (h *Hub) ethUnsubscribe() func(c *Client, message jsonrpcMessage) (json.RawMessage, error) {
 	return func(c *Client, message jsonrpcMessage) (json.RawMessage, error) {
 		b, err := message.Params.MarshalJSON()
@@ -404,21 +588,21 @@ func (h *Hub) ethUnsubscribe() func(c *Client, message jsonrpcMessage) (json.Raw
 		var params []interface{}
 		err = json.Unmarshal(b, &params)
 		if err != nil {
-			return nil, err
+			return nil, invalidParamsErrorf("invalid params: %v", err)
 		}
 
 		if len(params) == 0 {
-			return nil, fmt.Errorf("no parameters provided %s", message.Method)
+			return nil, invalidParamsErrorf("no parameters provided %s", message.Method)
 		}
 
 		hexSubscriptionID, ok := params[0].(string)
 		if !ok {
-			return nil, fmt.Errorf("subscription name is not a string - %s", params[0])
+			return nil, invalidParamsErrorf("subscription name is not a string - %s", params[0])
 		}
 
 		subscriptionID, err := hexutil.DecodeBig(hexSubscriptionID)
 		if err != nil {
-			return nil, fmt.Errorf("subscription id was not a hex - %s", hexSubscriptionID)
+			return nil, invalidParamsErrorf("subscription id was not a hex - %s", hexSubscriptionID)
 		}
 		subscrptionID, err := c.unsubscribeTo(subscriptionID)
 		if err != nil {
@@ -452,7 +636,7 @@ func (h *Hub) handleInitialAggregatesData() func(c *Client, message jsonrpcMessa
 		var params []interface{}
 		err = json.Unmarshal(b, &params)
 		if err != nil {
-			return nil, err
+			return nil, invalidParamsErrorf("invalid params: %v", err)
 		}
 
 		var periodCount int
@@ -461,15 +645,47 @@ func (h *Hub) handleInitialAggregatesData() func(c *Client, message jsonrpcMessa
 		} else {
 			periodCountFloat, ok := params[0].(float64)
 			if !ok {
-				return nil, fmt.Errorf("block count is not a number - %s", params[0])
+				return nil, invalidParamsErrorf("block count is not a number - %s", params[0])
 			}
 			periodCount = int(periodCountFloat)
 		}
 
-		data := &AggregatesData{
-			TotalsPerDay:   h.s.totalsPerDay.getTotals(periodCount),
-			TotalsPerHour:  h.s.totalsPerHour.getTotals(periodCount),
-			TotalsPerMonth: h.s.totalsPerMonth.getTotals(periodCount),
+		// every granularity is sent when none is requested
+		requestedGranularities := granularities
+		if len(params) > 1 && params[1] != nil {
+			names, ok := params[1].([]interface{})
+			if !ok {
+				return nil, invalidParamsErrorf("granularities is not a list - %v", params[1])
+			}
+
+			requestedGranularities = nil
+			for _, name := range names {
+				nameString, _ := name.(string)
+				g, ok := getGranularity(nameString)
+				if !ok {
+					return nil, invalidParamsErrorf("granularity '%v' is not one of %v", name, getGranularityNames())
+				}
+				requestedGranularities = append(requestedGranularities, g)
+			}
+		}
+
+		// periods are in UTC unless an IANA timezone is requested
+		var data AggregatesData
+		if len(params) > 2 && params[2] != nil {
+			zone, ok := params[2].(string)
+			if !ok {
+				return nil, invalidParamsErrorf("timezone is not a string - %v", params[2])
+			}
+
+			data = AggregatesData{}
+			for _, g := range requestedGranularities {
+				data[g.key()], err = h.s.getZonedAggregates(g, zone, periodCount)
+				if err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			data = h.getAggregatesData(requestedGranularities, periodCount)
 		}
 
 		dataJSON, err := json.Marshal(data)
@@ -481,7 +697,7 @@ func (h *Hub) handleInitialAggregatesData() func(c *Client, message jsonrpcMessa
 	}
 }
 
-func (h *Hub) handleInitialData() func(c *Client, message jsonrpcMessage) (json.RawMessage, error) {
+func (h *Hub) handleTotalsRange() func(c *Client, message jsonrpcMessage) (json.RawMessage, error) {
 	return func(c *Client, message jsonrpcMessage) (json.RawMessage, error) {
 		b, err := message.Params.MarshalJSON()
 		if err != nil {
@@ -490,21 +706,79 @@ func (h *Hub) handleInitialData() func(c *Client, message jsonrpcMessage) (json.
 
 		var params []interface{}
 		err = json.Unmarshal(b, &params)
+		if err != nil {
+			return nil, invalidParamsErrorf("invalid params: %v", err)
+		}
+
+		if len(params) < 2 {
+			return nil, invalidParamsErrorf("from and to are required %s", message.Method)
+		}
+
+		unit := "block"
+		if len(params) > 2 {
+			var ok bool
+			unit, ok = params[2].(string)
+			if !ok {
+				return nil, invalidParamsErrorf("unit is not a string - %v", params[2])
+			}
+		}
+
+		from, err := h.s.parseRangeParam("from", params[0], unit)
+		if err != nil {
+			return nil, err
+		}
+
+		to, err := h.s.parseRangeParam("to", params[1], unit)
+		if err != nil {
+			return nil, err
+		}
+
+		totals, err := h.s.getTotalsRange(from, to, unit)
 		if err != nil {
 			return nil, err
 		}
 
+		totalsJSON, err := json.Marshal(totals)
+		if err != nil {
+			log.Errorf("Error marshaling totals: %v", err)
+		}
+
+		return json.RawMessage(totalsJSON), nil
+	}
+}
+
+func (h *Hub) handleInitialData() func(c *Client, message jsonrpcMessage) (json.RawMessage, error) {
+	return func(c *Client, message jsonrpcMessage) (json.RawMessage, error) {
+		b, err := message.Params.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		var params []interface{}
+		err = json.Unmarshal(b, &params)
+		if err != nil {
+			return nil, invalidParamsErrorf("invalid params: %v", err)
+		}
+
 		var blockCount int
 		if len(params) == 0 {
 			blockCount = 300
 		} else {
 			blockCountFloat, ok := params[0].(float64)
 			if !ok {
-				return nil, fmt.Errorf("block count is not a number - %s", params[0])
+				return nil, invalidParamsErrorf("block count is not a number - %s", params[0])
 			}
 			blockCount = int(blockCountFloat)
 		}
 
+		var currency string
+		if len(params) > 1 {
+			currency, err = h.parseCurrency(params[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		blockNumber := h.s.latestBlock.getBlockNumber()
 		totals, err := h.s.getTotals(blockNumber)
 		if err != nil {
@@ -516,41 +790,52 @@ func (h *Hub) handleInitialData() func(c *Client, message jsonrpcMessage) (json.
 			log.Errorf("getBlockTimestamp(%d): %v", blockNumber, err)
 		}
 
+		// the windows include the current block
+		windowEnd := blockTimestamp + 1
+
 		// get totals stats for current block from 30 days prior
-		totalsMonth, err := h.s.getTotalsTimeDelta(blockTimestamp-30*86400, blockTimestamp)
+		totalsMonth, err := h.s.getTotalsTimeDelta(windowEnd-30*86400, windowEnd)
 		if err != nil {
-			log.Errorf("getTotalsTimeDelta(%d,%d): %v", blockTimestamp-30*86400, blockTimestamp, err)
+			log.Errorf("getTotalsTimeDelta(%d,%d): %v", windowEnd-30*86400, windowEnd, err)
 		}
 
 		// get totals stats for current block from 7 days prior
-		totalsWeek, err := h.s.getTotalsTimeDelta(blockTimestamp-7*86400, blockTimestamp)
+		totalsWeek, err := h.s.getTotalsTimeDelta(windowEnd-7*86400, windowEnd)
 		if err != nil {
-			log.Errorf("getTotalsTimeDelta(%d,%d): %v", blockTimestamp-7*86400, blockTimestamp, err)
+			log.Errorf("getTotalsTimeDelta(%d,%d): %v", windowEnd-7*86400, windowEnd, err)
 		}
 
 		// get totals stats for current block from 24 hours prior
-		totalsDay, err := h.s.getTotalsTimeDelta(blockTimestamp-86400, blockTimestamp)
+		totalsDay, err := h.s.getTotalsTimeDelta(windowEnd-86400, windowEnd)
 		if err != nil {
-			log.Errorf("getTotalsTimeDelta(%d,%d): %v", blockTimestamp-86400, blockTimestamp, err)
+			log.Errorf("getTotalsTimeDelta(%d,%d): %v", windowEnd-86400, windowEnd, err)
 		}
 
 		// get totals stats for current block from 1 hour prior
-		totalsHour, err := h.s.getTotalsTimeDelta(blockTimestamp-3600, blockTimestamp)
+		totalsHour, err := h.s.getTotalsTimeDelta(windowEnd-3600, windowEnd)
 		if err != nil {
-			log.Errorf("getTotalsTimeDelta(%d,%d): %v", blockTimestamp-3600, blockTimestamp, err)
+			log.Errorf("getTotalsTimeDelta(%d,%d): %v", windowEnd-3600, windowEnd, err)
 		}
 
 		data := &InitialData{
-			BlockNumber: h.s.latestBlock.getBlockNumber(),
-			Blocks:      h.s.latestBlocks.getBlocks(blockCount),
-			Clients:     int16(len(h.clients)),
-			Totals:      totals,
-			TotalsDay:   totalsDay,
-			TotalsHour:  totalsHour,
-			TotalsMonth: totalsMonth,
-			TotalsWeek:  totalsWeek,
-			Version:     version.Version,
-			USDPrice:    h.usd.GetPrice(),
+			BlockNumber:       h.s.latestBlock.getBlockNumber(),
+			Network:           h.s.network,
+			Blocks:            h.s.latestBlocks.getBlocks(blockCount),
+			Clients:           int16(len(h.clients)),
+			Totals:            totals,
+			TotalsDay:         totalsDay,
+			TotalsHour:        totalsHour,
+			TotalsMonth:       totalsMonth,
+			TotalsWeek:        totalsWeek,
+			Version:           version.Version,
+			USDPrice:          h.prices.GetPrice(usdCurrency),
+			USDPriceTimestamp: h.prices.GetPriceTimestamp(usdCurrency),
+			Prices:            h.prices.GetPrices(),
+			PriceTimestamps:   h.prices.GetPriceTimestamps(),
+		}
+		if currency != "" {
+			data.Currency = currency
+			data.Price = data.Prices[currency]
 		}
 
 		dataJSON, err := json.Marshal(data)
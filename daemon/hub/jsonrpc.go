@@ -1,6 +1,24 @@
 package hub
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	errcodeParse          = -32700
+	errcodeInvalidRequest = -32600
+	errcodeMethodNotFound = -32601
+	errcodeInvalidParams  = -32602
+	errcodeInternal       = -32603
+
+	// errcodeNotFound is returned when a requested block is not stored.
+	errcodeNotFound = -32001
+
+	// errcodeNotReady is returned when the data a request needs has not been
+	// processed yet.
+	errcodeNotReady = -32002
+)
 
 type jsonError struct {
 	Code    int         `json:"code"`
@@ -18,3 +36,86 @@ type jsonrpcMessage struct {
 	Error   *jsonError      `json:"error,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
 }
+
+func (err *jsonError) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("json-rpc error %d", err.Code)
+	}
+	return err.Message
+}
+
+// isBatch returns true when the first non-whitespace character of a message
+// is '['.
+func isBatch(data []byte) bool {
+	for _, c := range data {
+		// skip insignificant whitespace (http://www.ietf.org/rfc/rfc4627.txt)
+		if c == 0x20 || c == 0x09 || c == 0x0a || c == 0x0d {
+			continue
+		}
+		return c == '['
+	}
+	return false
+}
+
+// rpcError is an error with a JSON-RPC error code, other errors are internal
+// errors.
+type rpcError interface {
+	Error() string
+	ErrorCode() int
+}
+
+type codedError struct {
+	code    int
+	message string
+}
+
+func (e *codedError) Error() string { return e.message }
+
+func (e *codedError) ErrorCode() int { return e.code }
+
+func parseErrorf(format string, a ...interface{}) error {
+	return &codedError{errcodeParse, fmt.Sprintf(format, a...)}
+}
+
+func invalidRequestErrorf(format string, a ...interface{}) error {
+	return &codedError{errcodeInvalidRequest, fmt.Sprintf(format, a...)}
+}
+
+func methodNotFoundError(method string) error {
+	return &codedError{errcodeMethodNotFound, fmt.Sprintf("the method %s does not exist/is not available", method)}
+}
+
+func invalidParamsErrorf(format string, a ...interface{}) error {
+	return &codedError{errcodeInvalidParams, fmt.Sprintf(format, a...)}
+}
+
+func notFoundErrorf(format string, a ...interface{}) error {
+	return &codedError{errcodeNotFound, fmt.Sprintf(format, a...)}
+}
+
+func notReadyErrorf(format string, a ...interface{}) error {
+	return &codedError{errcodeNotReady, fmt.Sprintf(format, a...)}
+}
+
+// errorMessage returns the error response to the request with id.
+func errorMessage(id json.RawMessage, err error) jsonrpcMessage {
+	jsonErr := &jsonError{
+		Code:    errcodeInternal,
+		Message: err.Error(),
+	}
+
+	if e, ok := err.(rpcError); ok {
+		jsonErr.Code = e.ErrorCode()
+	}
+
+	// the id is null when it could not be read from the request
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+
+	return jsonrpcMessage{
+		Version: "2.0",
+		ID:      id,
+		Error:   jsonErr,
+	}
+}
@@ -41,3 +41,14 @@ func (lb *LatestBlock) updateBlockNumber(newBlockNumber uint64) {
 
 	lb.blockNumber = newBlockNumber
 }
+
+func (lb *LatestBlock) rollbackBlockNumber(blockNumber uint64) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if blockNumber >= lb.blockNumber {
+		return
+	}
+
+	lb.blockNumber = blockNumber
+}
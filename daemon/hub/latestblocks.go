@@ -47,3 +47,26 @@ func (lb *LatestBlocks) addBlock(block sql.BlockStats, duplicateBlock bool) {
 
 	lb.blocks = append([]sql.BlockStats{block}, lb.blocks...)[:sliceEnd]
 }
+
+// getBlock returns the block blockNumber if it is one of the latest blocks.
+func (lb *LatestBlocks) getBlock(blockNumber uint64) (sql.BlockStats, bool) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	for _, block := range lb.blocks {
+		if uint64(block.Number) == blockNumber {
+			return block, true
+		}
+	}
+
+	return sql.BlockStats{}, false
+}
+
+func (lb *LatestBlocks) removeBlocksAfter(blockNumber uint64) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	for len(lb.blocks) > 0 && uint64(lb.blocks[0].Number) > blockNumber {
+		lb.blocks = lb.blocks[1:]
+	}
+}
@@ -0,0 +1,119 @@
+package hub
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// latencyBuckets are the upper bounds in seconds of the latency histograms.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metrics are the counters, gauges and histograms updated by the daemon, the
+// gauges that can be read from its state are collected by hubCollector.
+var metrics = struct {
+	// nodeHead is the number of the latest head announced by the node,
+	// updated atomically.
+	nodeHead int64
+
+	blockProcessing   prometheus.Histogram
+	receiptQueueDepth prometheus.Gauge
+	receiptErrors     prometheus.Counter
+	rpcCalls          *prometheus.HistogramVec
+	clients           prometheus.Gauge
+	subscriptions     *prometheus.GaugeVec
+	droppedClients    prometheus.Counter
+}{
+	blockProcessing: promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "burnstats_block_processing_seconds",
+		Help:    "Time to fetch and compute the stats of a block.",
+		Buckets: latencyBuckets,
+	}),
+	receiptQueueDepth: promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "burnstats_receipt_queue_depth",
+		Help: "Transaction receipt jobs waiting for a worker.",
+	}),
+	receiptErrors: promauto.NewCounter(prometheus.CounterOpts{
+		Name: "burnstats_receipt_errors_total",
+		Help: "Transaction receipts that could not be fetched or processed.",
+	}),
+	rpcCalls: promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "burnstats_rpc_call_duration_seconds",
+		Help:    "Duration of the calls to the node by method.",
+		Buckets: latencyBuckets,
+	}, []string{"method"}),
+	clients: promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "burnstats_websocket_clients",
+		Help: "Connected websocket clients.",
+	}),
+	subscriptions: promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "burnstats_websocket_subscriptions",
+		Help: "Websocket subscriptions by type.",
+	}, []string{"type"}),
+	droppedClients: promauto.NewCounter(prometheus.CounterOpts{
+		Name: "burnstats_websocket_dropped_clients_total",
+		Help: "Websocket clients dropped because they did not read their messages fast enough.",
+	}),
+}
+
+var (
+	latestBlockDesc = prometheus.NewDesc(
+		"burnstats_latest_block",
+		"Latest block processed.",
+		nil, nil,
+	)
+	headLagDesc = prometheus.NewDesc(
+		"burnstats_head_lag_blocks",
+		"Blocks between the parent of the head of the node, the last block the daemon processes, and the latest block processed.",
+		nil, nil,
+	)
+	priceAgeDesc = prometheus.NewDesc(
+		"burnstats_price_age_seconds",
+		"Seconds since the price in a quote currency was last updated.",
+		[]string{"currency"}, nil,
+	)
+)
+
+// hubCollector collects the gauges read from the state of the hub when the
+// metrics are scraped.
+type hubCollector struct {
+	h *Hub
+}
+
+func (c hubCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- latestBlockDesc
+	ch <- headLagDesc
+	ch <- priceAgeDesc
+}
+
+func (c hubCollector) Collect(ch chan<- prometheus.Metric) {
+	// the latest block is only known once the blocks are loaded
+	if c.h.s.health.isInitialized() {
+		latestBlockNumber := c.h.s.latestBlock.getBlockNumber()
+		ch <- prometheus.MustNewConstMetric(latestBlockDesc, prometheus.GaugeValue, float64(latestBlockNumber))
+
+		// the head is only known when following a node, whose head is
+		// processed once the next one is announced, so 0 is caught up. A
+		// reorg can process the head itself, which is reported as 0 too.
+		if nodeHead := atomic.LoadInt64(&metrics.nodeHead); nodeHead > 0 {
+			headLag := math.Max(float64(nodeHead)-1-float64(latestBlockNumber), 0)
+			ch <- prometheus.MustNewConstMetric(headLagDesc, prometheus.GaugeValue, headLag)
+		}
+	}
+
+	for _, currency := range c.h.prices.Currencies() {
+		priceAge := math.NaN()
+		if updatedAt := c.h.prices.GetUpdatedAt(currency); !updatedAt.IsZero() {
+			priceAge = time.Since(updatedAt).Seconds()
+		}
+		ch <- prometheus.MustNewConstMetric(priceAgeDesc, prometheus.GaugeValue, priceAge, currency)
+	}
+}
+
+// observeSince observes the seconds elapsed since start.
+func observeSince(o prometheus.Observer, start time.Time) {
+	o.Observe(time.Since(start).Seconds())
+}
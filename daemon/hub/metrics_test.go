@@ -0,0 +1,83 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scrapeHub returns the metrics of the state of h in the Prometheus text
+// format.
+func scrapeHub(t *testing.T, h *Hub) string {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(hubCollector{h})
+
+	w := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status is %d, want %d", w.Code, http.StatusOK)
+	}
+
+	return w.Body.String()
+}
+
+func TestHubCollectorBeforeInitialized(t *testing.T) {
+	prices, err := NewPriceWatcher(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Hub{s: &Stats{prices: prices}, prices: prices}
+
+	body := scrapeHub(t, h)
+	if strings.Contains(body, "burnstats_latest_block") {
+		t.Error("latest block is reported before the blocks are loaded")
+	}
+	if !strings.Contains(body, `burnstats_price_age_seconds{currency="USD"} NaN`) {
+		t.Errorf("price age of a price never updated is not NaN:\n%s", body)
+	}
+}
+
+func TestHubCollectorHeadLag(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 110)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 110)
+	s.health.setInitialized()
+
+	prices, err := NewPriceWatcher(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Hub{s: s, prices: prices}
+
+	defer atomic.StoreInt64(&metrics.nodeHead, 0)
+
+	// the head 111 announced the processing of 110
+	tests := []struct {
+		nodeHead int64
+		lag      string
+	}{
+		{111, "burnstats_head_lag_blocks 0"},
+		{115, "burnstats_head_lag_blocks 4"},
+		{110, "burnstats_head_lag_blocks 0"},
+	}
+
+	for _, test := range tests {
+		atomic.StoreInt64(&metrics.nodeHead, test.nodeHead)
+
+		body := scrapeHub(t, h)
+		if !strings.Contains(body, "burnstats_latest_block 110") {
+			t.Errorf("latest block is not 110:\n%s", body)
+		}
+		if !strings.Contains(body, test.lag+"\n") {
+			t.Errorf("head %d: want %s:\n%s", test.nodeHead, test.lag, body)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PriceSource defines an exchange or aggregator the ETH price in quote
+// currencies like USD is read from.
+type PriceSource interface {
+	Name() string
+
+	// Quotes returns true if the source has a price in currency.
+	Quotes(currency string) bool
+
+	GetPrice(client *http.Client, currency string) (float64, error)
+}
+
+// DefaultPriceSources are the sources used when none is configured.
+var DefaultPriceSources = []string{"coinbase", "kraken", "bitstamp", "gemini", "coingecko"}
+
+// priceSourceConfig defines the default endpoint of a known source, where
+// {CURRENCY} and {currency} are replaced by the upper and lower case symbol
+// of the currency, and the currencies it quotes, every one when nil.
+type priceSourceConfig struct {
+	endpoint   string
+	currencies []string
+	symbols    map[string]string
+	parse      func(body []byte, currency string) (float64, error)
+}
+
+var priceSourceConfigs = map[string]priceSourceConfig{
+	"coinbase": {
+		endpoint: "https://api.coinbase.com/v2/prices/ETH-{CURRENCY}/spot",
+		parse:    parseCoinbasePrice,
+	},
+	"kraken": {
+		endpoint:   "https://api.kraken.com/0/public/Ticker?pair=ETH{CURRENCY}",
+		currencies: []string{"USD", "EUR", "GBP", "JPY", "CAD", "CHF", "AUD", "BTC"},
+		symbols:    map[string]string{"BTC": "XBT"},
+		parse:      parseKrakenPrice,
+	},
+	"bitstamp": {
+		endpoint:   "https://www.bitstamp.net/api/v2/ticker/eth{currency}/",
+		currencies: []string{"USD", "EUR", "GBP", "BTC"},
+		parse:      parseLastPrice,
+	},
+	"gemini": {
+		endpoint:   "https://api.gemini.com/v1/pubticker/eth{currency}",
+		currencies: []string{"USD", "EUR", "GBP", "BTC"},
+		parse:      parseLastPrice,
+	},
+	"coingecko": {
+		endpoint: "https://api.coingecko.com/api/v3/simple/price?ids=ethereum&vs_currencies={currency}",
+		parse:    parseCoingeckoPrice,
+	},
+}
+
+// NewPriceSources returns the sources described by specs, a spec is the name
+// of a known source optionally followed by =endpoint to override its URL. An
+// endpoint without {CURRENCY} or {currency} only quotes USD.
+func NewPriceSources(specs []string) ([]PriceSource, error) {
+	var sources []PriceSource
+
+	for _, spec := range specs {
+		name, endpoint := spec, ""
+		if i := strings.Index(spec, "="); i != -1 {
+			name, endpoint = spec[:i], spec[i+1:]
+		}
+
+		source, err := newPriceSource(name, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+func newPriceSource(name string, endpoint string) (PriceSource, error) {
+	config, ok := priceSourceConfigs[name]
+	if !ok {
+		names := make([]string, 0, len(priceSourceConfigs))
+		for name := range priceSourceConfigs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("price source '%s' is not one of %v", name, names)
+	}
+
+	source := &jsonPriceSource{
+		name:       name,
+		endpoint:   config.endpoint,
+		currencies: config.currencies,
+		symbols:    config.symbols,
+		parse:      config.parse,
+	}
+
+	if endpoint != "" {
+		source.endpoint = endpoint
+		if !strings.Contains(endpoint, "{CURRENCY}") && !strings.Contains(endpoint, "{currency}") {
+			source.currencies = []string{"USD"}
+		}
+	}
+
+	return source, nil
+}
+
+// jsonPriceSource is a source whose endpoint answers a JSON document the
+// price is parsed from.
+type jsonPriceSource struct {
+	name       string
+	endpoint   string
+	currencies []string
+	symbols    map[string]string
+	parse      func(body []byte, currency string) (float64, error)
+}
+
+func (s *jsonPriceSource) Name() string {
+	return s.name
+}
+
+func (s *jsonPriceSource) Quotes(currency string) bool {
+	return s.currencies == nil || containsString(s.currencies, currency)
+}
+
+func (s *jsonPriceSource) GetPrice(client *http.Client, currency string) (float64, error) {
+	symbol := currency
+	if sourceSymbol, ok := s.symbols[currency]; ok {
+		symbol = sourceSymbol
+	}
+	endpoint := strings.NewReplacer("{CURRENCY}", strings.ToUpper(symbol), "{currency}", strings.ToLower(symbol)).Replace(s.endpoint)
+
+	r, err := client.Get(endpoint)
+	if err != nil {
+		return 0, fmt.Errorf("error getting %s %s price: %v", s.name, currency, err)
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("error getting %s %s price: %s", s.name, currency, r.Status)
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s response: %v", s.name, err)
+	}
+
+	price, err := s.parse(body, currency)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding %s response: %v", s.name, err)
+	}
+
+	if price <= 0 {
+		return 0, fmt.Errorf("%s %s price is not positive: %v", s.name, currency, price)
+	}
+
+	return price, nil
+}
+
+func parseCoinbasePrice(body []byte, currency string) (float64, error) {
+	var response struct {
+		Data struct {
+			Amount string `json:"amount"`
+		} `json:"data"`
+	}
+
+	err := json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(response.Data.Amount, 64)
+}
+
+func parseKrakenPrice(body []byte, currency string) (float64, error) {
+	var response struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			// c is the last trade closed, [price, lot volume]
+			C []string `json:"c"`
+		} `json:"result"`
+	}
+
+	err := json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(response.Error) > 0 {
+		return 0, fmt.Errorf("%v", response.Error)
+	}
+
+	// the result is keyed by the name of the pair, like XETHZUSD
+	for _, ticker := range response.Result {
+		if len(ticker.C) > 0 {
+			return strconv.ParseFloat(ticker.C[0], 64)
+		}
+	}
+
+	return 0, fmt.Errorf("no ticker in response")
+}
+
+func parseLastPrice(body []byte, currency string) (float64, error) {
+	var response struct {
+		Last string `json:"last"`
+	}
+
+	err := json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(response.Last, 64)
+}
+
+func parseCoingeckoPrice(body []byte, currency string) (float64, error) {
+	var response struct {
+		Ethereum map[string]float64 `json:"ethereum"`
+	}
+
+	err := json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
+	}
+
+	price, ok := response.Ethereum[strings.ToLower(currency)]
+	if !ok {
+		return 0, fmt.Errorf("no %s price in response", currency)
+	}
+
+	return price, nil
+}
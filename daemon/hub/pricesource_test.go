@@ -0,0 +1,121 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubPriceSource returns a source named name whose endpoint is a stub server
+// answering status and body, and the paths it was requested at.
+func stubPriceSource(t *testing.T, name string, status int, body string) (PriceSource, *[]string) {
+	t.Helper()
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	sources, err := NewPriceSources([]string{name + "=" + server.URL + "/{CURRENCY}/{currency}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sources[0], &paths
+}
+
+func TestJSONPriceSourceGetPrice(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		body     string
+		price    float64
+		path     string
+	}{
+		{"coinbase", "USD", `{"data":{"base":"ETH","currency":"USD","amount":"3012.45"}}`, 3012.45, "/USD/usd"},
+		{"kraken", "EUR", `{"error":[],"result":{"XETHZEUR":{"a":["2800.1","1","1.000"],"c":["2801.5","0.1"]}}}`, 2801.5, "/EUR/eur"},
+		{"kraken", "BTC", `{"error":[],"result":{"XETHXXBT":{"c":["0.0512","0.1"]}}}`, 0.0512, "/XBT/xbt"},
+		{"bitstamp", "GBP", `{"last":"2400.7","high":"2500"}`, 2400.7, "/GBP/gbp"},
+		{"gemini", "USD", `{"bid":"3000","last":"3010.25"}`, 3010.25, "/USD/usd"},
+		{"coingecko", "JPY", `{"ethereum":{"jpy":450123.5}}`, 450123.5, "/JPY/jpy"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name+"/"+test.currency, func(t *testing.T) {
+			source, paths := stubPriceSource(t, test.name, http.StatusOK, test.body)
+
+			price, err := source.GetPrice(http.DefaultClient, test.currency)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if price != test.price {
+				t.Errorf("price is %v, want %v", price, test.price)
+			}
+			if len(*paths) != 1 || (*paths)[0] != test.path {
+				t.Errorf("requested %v, want [%s]", *paths, test.path)
+			}
+		})
+	}
+}
+
+func TestJSONPriceSourceGetPriceErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		err    string
+	}{
+		{"coinbase", http.StatusTooManyRequests, `{"errors":[]}`, "429"},
+		{"coinbase", http.StatusOK, `{"data":`, "error decoding coinbase response"},
+		{"coinbase", http.StatusOK, `{"data":{"amount":"n/a"}}`, "error decoding coinbase response"},
+		{"kraken", http.StatusBadGateway, ``, "502"},
+		{"kraken", http.StatusOK, `{"error":["EQuery:Unknown asset pair"]}`, "Unknown asset pair"},
+		{"kraken", http.StatusOK, `{"error":[],"result":{}}`, "no ticker in response"},
+		{"bitstamp", http.StatusNotFound, `not found`, "404"},
+		{"bitstamp", http.StatusOK, `<html>`, "error decoding bitstamp response"},
+		{"gemini", http.StatusServiceUnavailable, ``, "503"},
+		{"gemini", http.StatusOK, `{"last":"0"}`, "price is not positive"},
+		{"coingecko", http.StatusInternalServerError, ``, "500"},
+		{"coingecko", http.StatusOK, `{"ethereum":{"eur":2800}}`, "no USD price in response"},
+		{"coingecko", http.StatusOK, `[]`, "error decoding coingecko response"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, _ := stubPriceSource(t, test.name, test.status, test.body)
+
+			price, err := source.GetPrice(http.DefaultClient, "USD")
+			if err == nil {
+				t.Fatalf("got price %v, want an error", price)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error is '%v', want it to contain '%s'", err, test.err)
+			}
+		})
+	}
+}
+
+func TestNewPriceSources(t *testing.T) {
+	sources, err := NewPriceSources([]string{"kraken", "gemini=http://localhost:9000/ticker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sources[0].Quotes("EUR") || sources[0].Quotes("XYZ") {
+		t.Error("kraken quotes its currencies only")
+	}
+
+	// an endpoint without a currency placeholder only quotes USD
+	if !sources[1].Quotes("USD") || sources[1].Quotes("EUR") {
+		t.Error("gemini with an overridden endpoint quotes USD only")
+	}
+
+	_, err = NewPriceSources([]string{"binance"})
+	if err == nil {
+		t.Error("unknown source is accepted")
+	}
+}
@@ -0,0 +1,273 @@
+package hub
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// priceRefreshInterval is how often the prices are fetched from the
+	// sources.
+	priceRefreshInterval = 1 * time.Minute
+
+	// maxPriceDeviation is how far from the median of all the sources the
+	// price of a source can be before it is rejected as an outlier.
+	maxPriceDeviation = 0.02
+
+	// usdCurrency is always watched, it is the price recorded in the blocks.
+	usdCurrency = "USD"
+)
+
+// DefaultCurrencies are the quote currencies watched when none is configured.
+var DefaultCurrencies = []string{"USD", "EUR", "GBP", "JPY", "BTC"}
+
+// PriceWatcher defines the mutexed ETH prices in several quote currencies,
+// each the median of the prices of the sources quoting it, refreshed every
+// minute.
+type PriceWatcher struct {
+	sources    []PriceSource
+	currencies []string
+	client     *http.Client
+
+	prices     map[string]float64
+	updatedAt  map[string]time.Time
+	priceMutex sync.RWMutex
+}
+
+// NewPriceWatcher returns a watcher of the prices of sources in currencies,
+// or of the default sources when there is none. USD is always watched.
+func NewPriceWatcher(sources []PriceSource, currencies []string) (*PriceWatcher, error) {
+	if len(sources) == 0 {
+		sources, _ = NewPriceSources(DefaultPriceSources)
+	}
+
+	watched := []string{usdCurrency}
+	for _, currency := range currencies {
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		if currency == "" || containsString(watched, currency) {
+			continue
+		}
+		watched = append(watched, currency)
+	}
+
+	for _, currency := range watched {
+		quoted := false
+		for _, source := range sources {
+			quoted = quoted || source.Quotes(currency)
+		}
+		if !quoted {
+			return nil, fmt.Errorf("no price source quotes %s", currency)
+		}
+	}
+
+	return &PriceWatcher{
+		sources:    sources,
+		currencies: watched,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		prices:     map[string]float64{},
+		updatedAt:  map[string]time.Time{},
+	}, nil
+}
+
+func (p *PriceWatcher) StartWatching() {
+	p.refreshPrices()
+
+	c := time.Tick(priceRefreshInterval)
+	for range c {
+		p.refreshPrices()
+	}
+}
+
+// Currencies returns the watched quote currencies, USD first.
+func (p *PriceWatcher) Currencies() []string {
+	return p.currencies
+}
+
+// IsWatching returns true if currency is one of the watched currencies.
+func (p *PriceWatcher) IsWatching(currency string) bool {
+	return containsString(p.currencies, currency)
+}
+
+// GetPrice returns the price in currency, or 0 if it is not known.
+func (p *PriceWatcher) GetPrice(currency string) float64 {
+	p.priceMutex.RLock()
+	defer p.priceMutex.RUnlock()
+	return p.prices[currency]
+}
+
+// GetPrices returns the known prices by currency.
+func (p *PriceWatcher) GetPrices() map[string]float64 {
+	p.priceMutex.RLock()
+	defer p.priceMutex.RUnlock()
+
+	prices := make(map[string]float64, len(p.prices))
+	for currency, price := range p.prices {
+		prices[currency] = price
+	}
+
+	return prices
+}
+
+// GetUpdatedAt returns when the price in currency was last updated, or the
+// zero time if it has never been.
+func (p *PriceWatcher) GetUpdatedAt(currency string) time.Time {
+	p.priceMutex.RLock()
+	defer p.priceMutex.RUnlock()
+	return p.updatedAt[currency]
+}
+
+// getPriceUpdatedAt returns the price in currency with the time it was
+// updated at.
+func (p *PriceWatcher) getPriceUpdatedAt(currency string) (float64, time.Time) {
+	p.priceMutex.RLock()
+	defer p.priceMutex.RUnlock()
+	return p.prices[currency], p.updatedAt[currency]
+}
+
+// GetPriceTimestamp returns the unix time the price in currency was last
+// updated at, or 0 if it has never been.
+func (p *PriceWatcher) GetPriceTimestamp(currency string) int64 {
+	updatedAt := p.GetUpdatedAt(currency)
+	if updatedAt.IsZero() {
+		return 0
+	}
+
+	return updatedAt.Unix()
+}
+
+// GetPriceTimestamps returns the unix time the known prices were last updated
+// at by currency.
+func (p *PriceWatcher) GetPriceTimestamps() map[string]int64 {
+	p.priceMutex.RLock()
+	defer p.priceMutex.RUnlock()
+
+	timestamps := make(map[string]int64, len(p.updatedAt))
+	for currency, updatedAt := range p.updatedAt {
+		timestamps[currency] = updatedAt.Unix()
+	}
+
+	return timestamps
+}
+
+// refreshPrices fetches the price of every source in every currency at once,
+// the previous price of a currency and its timestamp are kept when every
+// source quoting it fails.
+func (p *PriceWatcher) refreshPrices() {
+	type quote struct {
+		currency string
+		price    float64
+		err      error
+	}
+
+	var quotes []*quote
+	var wg sync.WaitGroup
+	for _, currency := range p.currencies {
+		for _, source := range p.sources {
+			if !source.Quotes(currency) {
+				continue
+			}
+
+			q := &quote{currency: currency}
+			quotes = append(quotes, q)
+
+			wg.Add(1)
+			go func(q *quote, source PriceSource) {
+				defer wg.Done()
+				q.price, q.err = source.GetPrice(p.client, q.currency)
+			}(q, source)
+		}
+	}
+	wg.Wait()
+
+	validPrices := map[string][]float64{}
+	sourceCounts := map[string]int{}
+	for _, q := range quotes {
+		sourceCounts[q.currency]++
+		if q.err != nil {
+			log.Warnln(q.err)
+			continue
+		}
+		validPrices[q.currency] = append(validPrices[q.currency], q.price)
+	}
+
+	now := time.Now()
+	for _, currency := range p.currencies {
+		if len(validPrices[currency]) == 0 {
+			log.Errorf("no %s price source answered out of %d", currency, sourceCounts[currency])
+			continue
+		}
+
+		price, used := medianPrice(validPrices[currency])
+		if used == 0 {
+			log.Errorf("no %s price source answered a positive price out of %d", currency, sourceCounts[currency])
+			continue
+		}
+		log.Debugf("%s price: %g from %d of %d sources", strings.ToLower(currency), price, used, sourceCounts[currency])
+
+		p.priceMutex.Lock()
+		p.prices[currency] = price
+		p.updatedAt[currency] = now
+		p.priceMutex.Unlock()
+	}
+}
+
+// medianPrice returns the median of the prices within maxPriceDeviation of
+// the median of all of them, and how many prices it is computed from. When
+// the prices disagree too much to tell the outliers, the median of all of
+// them is returned. Prices that are not positive are ignored, 0 and 0 are
+// returned without any other.
+func medianPrice(prices []float64) (float64, int) {
+	var positive []float64
+	for _, price := range prices {
+		if price > 0 {
+			positive = append(positive, price)
+		}
+	}
+	if len(positive) == 0 {
+		return 0, 0
+	}
+	prices = positive
+
+	allMedian := median(prices)
+
+	var agreeing []float64
+	for _, price := range prices {
+		if math.Abs(price-allMedian)/allMedian <= maxPriceDeviation {
+			agreeing = append(agreeing, price)
+		}
+	}
+
+	if len(agreeing) == 0 {
+		log.Warnf("price sources disagree: %v", prices)
+		return allMedian, len(prices)
+	}
+
+	return median(agreeing), len(agreeing)
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
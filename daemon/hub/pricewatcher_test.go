@@ -0,0 +1,115 @@
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMedianPrice(t *testing.T) {
+	tests := []struct {
+		name   string
+		prices []float64
+		price  float64
+		used   int
+	}{
+		{"single", []float64{3000}, 3000, 1},
+		{"two agreeing", []float64{3000, 3010}, 3005, 2},
+		{"two disagreeing", []float64{3000, 4000}, 3500, 2},
+		{"outlier rejected", []float64{3000, 3002, 3004, 3006, 2000}, 3003, 4},
+		{"outliers on both sides", []float64{3000, 3001, 3002, 100, 9000}, 3001, 3},
+		{"only the median agreeing", []float64{1000, 2000, 4000}, 2000, 1},
+		{"all disagreeing", []float64{1000, 2000, 4000, 8000}, 3000, 4},
+		{"zero ignored", []float64{0, 3000, 3010}, 3005, 2},
+		{"negative ignored", []float64{-3000, 3000}, 3000, 1},
+		{"only zeros", []float64{0, 0}, 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			price, used := medianPrice(test.prices)
+			if price != test.price || used != test.used {
+				t.Errorf("medianPrice(%v) = %v, %d, want %v, %d", test.prices, price, used, test.price, test.used)
+			}
+		})
+	}
+}
+
+func TestNewPriceWatcher(t *testing.T) {
+	sources, err := NewPriceSources([]string{"bitstamp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPriceWatcher(sources, []string{"eur", "BTC", "EUR", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Currencies()) != "[USD EUR BTC]" {
+		t.Errorf("currencies are %v, want [USD EUR BTC]", p.Currencies())
+	}
+
+	_, err = NewPriceWatcher(sources, []string{"JPY"})
+	if err == nil {
+		t.Error("currency no source quotes is accepted")
+	}
+}
+
+func TestRefreshPricesKeepsPreviousPrice(t *testing.T) {
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, map[string]string{
+			"/a/usd": `{"last":"3000"}`,
+			"/b/usd": `{"last":"3010"}`,
+			"/a/eur": `{"last":"2800"}`,
+		}[r.URL.Path])
+	}))
+	defer server.Close()
+
+	sources, err := NewPriceSources([]string{
+		"bitstamp=" + server.URL + "/a/{currency}",
+		"gemini=" + server.URL + "/b/{currency}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// gemini answers no EUR price, so EUR comes from bitstamp alone
+	p, err := NewPriceWatcher(sources, []string{"EUR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.refreshPrices()
+
+	if price := p.GetPrice("USD"); price != 3005 {
+		t.Errorf("USD price is %v, want 3005", price)
+	}
+	if price := p.GetPrice("EUR"); price != 2800 {
+		t.Errorf("EUR price is %v, want 2800", price)
+	}
+
+	updatedAt := p.GetUpdatedAt("USD")
+	if updatedAt.IsZero() {
+		t.Fatal("USD price has no timestamp")
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	p.refreshPrices()
+
+	if price := p.GetPrice("USD"); price != 3005 {
+		t.Errorf("USD price is %v after every source failed, want 3005", price)
+	}
+	if price := p.GetPrice("EUR"); price != 2800 {
+		t.Errorf("EUR price is %v after every source failed, want 2800", price)
+	}
+	if !p.GetUpdatedAt("USD").Equal(updatedAt) {
+		t.Errorf("USD price timestamp moved to %v after every source failed", p.GetUpdatedAt("USD"))
+	}
+}
@@ -0,0 +1,256 @@
+package hub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/network"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+const (
+	// followInterval is how often a read-only hub polls the database for the
+	// blocks written by another daemon.
+	followInterval = 2 * time.Second
+
+	// followDepth is how many of the latest blocks are read again on every
+	// poll, to notice the reorgs the writer rolled back.
+	followDepth = 16
+
+	// followOverlap is how long before the latest write already read the
+	// blocks written are read again, so the writes another daemon commits
+	// late are not missed.
+	followOverlap = time.Minute
+)
+
+// initializeReadOnly loads the stats from the database only, without any
+// connection to a node.
+func (s *Stats) initializeReadOnly(dbPath string, networkConfig *network.Config) error {
+	s.readOnly = true
+
+	err := s.initializeState(dbPath, networkConfig)
+	if err != nil {
+		return err
+	}
+
+	// the blocks written again while they are loaded are read on the first
+	// poll
+	s.followedAt, err = s.db.GetLatestBlockUpdate()
+	if err != nil {
+		return fmt.Errorf("error getting latest block update from database: %v", err)
+	}
+
+	highestBlockInDB, err := s.initGetBlocksFromDB()
+	if err != nil {
+		log.Errorf("error during initGetGetBlocksFromDB: %v", err)
+		return err
+	}
+
+	if highestBlockInDB < s.londonBlock {
+		return fmt.Errorf("database has no blocks to serve")
+	}
+	s.latestBlock.updateBlockNumber(highestBlockInDB)
+
+	if s.londonTimestamp == 0 {
+		s.londonTimestamp, err = s.getBlockTimestamp(s.londonBlock)
+		if err != nil {
+			return fmt.Errorf("london block %d is not in the database", s.londonBlock)
+		}
+	}
+
+	// without a node the timestamp of the last berlin block is unknown, it
+	// only bounds the consensus issuance which starts after the merge
+	s.lastBerlinTimestamp = s.londonTimestamp
+
+	if s.network.ParisBlock != nil {
+		s.consensusIssuance = newConsensusIssuance()
+
+		allEpochStats, err := s.db.GetAllEpochStats()
+		if err != nil {
+			return fmt.Errorf("error getting epochs from database: %v", err)
+		}
+
+		err = s.addEpochStats(allEpochStats)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("init: ConsensusIssuance - Imported %d epochs", len(allEpochStats))
+	}
+
+	err = s.loadTotals(highestBlockInDB)
+	if err != nil {
+		log.Errorf("error during loadTotals: %v", err)
+		return err
+	}
+
+	err = s.initializeLatestBlocks()
+	if err != nil {
+		log.Errorf("error during initializeLatestBlocks: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// pollDatabase reads the blocks written to the database since the last poll,
+// and rolls back the blocks the writer replaced after a reorg. The older
+// blocks written again, by a backfill, a reprocess or an import of prices,
+// are reloaded with the aggregates after them.
+func (s *Stats) pollDatabase() ([]sql.BlockStats, *ReorgData, error) {
+	err := s.pollEpochStats()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	latestBlockNumber := s.latestBlock.getBlockNumber()
+
+	from := s.lastBerlinBlock
+	if latestBlockNumber > from+followDepth {
+		from = latestBlockNumber - followDepth
+	}
+
+	err = s.pollChangedBlocks(from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allBlockStats, err := s.db.GetBlockStatsAfter(from)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting blocks from database: %v", err)
+	}
+
+	// the blocks after the last one that is still stored unchanged were
+	// replaced, or are being replaced, by the writer
+	ancestor := from
+	for _, b := range allBlockStats {
+		n := uint64(b.Number)
+		if n > latestBlockNumber || n != ancestor+1 || s.isOrphaned(n, b.Hash) {
+			break
+		}
+		ancestor = n
+	}
+
+	var reorg *ReorgData
+	if ancestor < latestBlockNumber {
+		log.Warnf("reorg: common ancestor %d, rolling back blocks %d -> %d", ancestor, ancestor+1, latestBlockNumber)
+		s.rollbackMemory(ancestor, latestBlockNumber)
+
+		reorg = &ReorgData{
+			Blocks:         []sql.BlockStats{},
+			CommonAncestor: ancestor,
+			Depth:          latestBlockNumber - ancestor,
+		}
+	}
+
+	// only follow the blocks that were committed in order
+	var newBlockStats []sql.BlockStats
+	for _, b := range allBlockStats {
+		n := uint64(b.Number)
+		if n <= ancestor {
+			continue
+		}
+		if n != ancestor+uint64(len(newBlockStats))+1 {
+			break
+		}
+
+		s.blocks.addBlocks(b)
+
+		s.latestBlocks.addBlock(b, false)
+		s.latestBlock.updateBlockNumber(n)
+
+		newBlockStats = append(newBlockStats, b)
+	}
+
+	if reorg != nil {
+		reorg.Blocks = newBlockStats
+	}
+
+	if len(newBlockStats) == 0 {
+		if reorg != nil {
+			return nil, reorg, s.refreshAggregateTotals(ancestor)
+		}
+		return nil, nil, nil
+	}
+
+	startBlockNumber := uint64(newBlockStats[0].Number)
+
+	if reorg != nil {
+		err = s.refreshAggregateTotals(startBlockNumber)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error refreshing aggregate totals from block %d: %v", startBlockNumber, err)
+		}
+	}
+
+	return newBlockStats, reorg, nil
+}
+
+// pollChangedBlocks reloads the blocks up to toBlock that were written again
+// since the last poll, and refreshes the aggregates from the first one that
+// changed. The blocks after toBlock are followed by pollDatabase.
+func (s *Stats) pollChangedBlocks(toBlock uint64) error {
+	allBlockStats, err := s.db.GetBlockStatsUpdatedAfter(s.followedAt-int64(followOverlap), toBlock)
+	if err != nil {
+		return fmt.Errorf("error getting written blocks from database: %v", err)
+	}
+
+	// the blocks read again in the overlap, or written again unchanged, are
+	// skipped
+	var changedBlockStats []sql.BlockStats
+	for _, b := range allBlockStats {
+		if b.UpdatedAt > s.followedAt {
+			s.followedAt = b.UpdatedAt
+		}
+		if !s.blocks.isStored(b) {
+			changedBlockStats = append(changedBlockStats, b)
+		}
+	}
+
+	if len(changedBlockStats) == 0 {
+		return nil
+	}
+
+	s.blocks.addBlocks(changedBlockStats...)
+
+	firstChange := uint64(changedBlockStats[0].Number)
+	log.Infof("follow: reloaded %d blocks written again from block %d", len(changedBlockStats), firstChange)
+
+	err = s.refreshAggregateTotals(firstChange)
+	if err != nil {
+		return fmt.Errorf("error refreshing aggregate totals from block %d: %v", firstChange, err)
+	}
+
+	return nil
+}
+
+// pollEpochStats reads the consensus issuance of the epochs written to the
+// database since the last poll.
+func (s *Stats) pollEpochStats() error {
+	if s.consensusIssuance == nil {
+		return nil
+	}
+
+	var allEpochStats []sql.EpochStats
+	var err error
+
+	nextEpoch, ok := s.consensusIssuance.nextEpoch()
+	if ok {
+		allEpochStats, err = s.db.GetEpochStatsAfter(nextEpoch - 1)
+	} else {
+		allEpochStats, err = s.db.GetAllEpochStats()
+	}
+	if err != nil {
+		return fmt.Errorf("error getting epochs from database: %v", err)
+	}
+
+	if len(allEpochStats) == 0 {
+		return nil
+	}
+
+	err = s.addEpochStats(allEpochStats)
+	if err != nil {
+		return err
+	}
+
+	return s.refreshTotalsFromTimestamp(allEpochStats[0].Timestamp)
+}
@@ -0,0 +1,93 @@
+package hub
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+// dayIssuanceUSD returns the issuance in USD of the latest UTC day.
+func dayIssuanceUSD(t *testing.T, s *Stats) string {
+	t.Helper()
+
+	days := s.aggregates["day"].getTotals(1)
+	if len(days) != 1 {
+		t.Fatalf("%d days, want 1", len(days))
+	}
+
+	return days[0].IssuanceUSD
+}
+
+func TestPollDatabaseReloadsBlocksWrittenAgain(t *testing.T) {
+	node := &fakeNode{transactions: true}
+	node.setChain("a", testLondonBlock-1, 150)
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	writer := newTestStatsWithDB(t, node, dbPath)
+	processBlocks(t, writer, testLondonBlock, 140)
+
+	replica := &Stats{}
+	err := replica.initializeReadOnly(dbPath, writer.network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuanceUSD := dayIssuanceUSD(t, replica); issuanceUSD != "0x0" {
+		t.Fatalf("issuance is %s USD before the prices are imported", issuanceUSD)
+	}
+
+	// blocks 110 and 111 are priced far below the latest blocks the replica
+	// reads again on every poll
+	var pricedBlockStats []sql.BlockStats
+	for _, n := range []uint64{110, 111} {
+		blockStats, _, err := writer.db.GetBlockStats(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blockStats.USDPrice = 1000
+		pricedBlockStats = append(pricedBlockStats, blockStats)
+	}
+	err = writer.db.SetBlockUSDPrices(pricedBlockStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processBlocks(t, writer, 141, 150)
+
+	allBlockStats, reorg, err := replica.pollDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allBlockStats) != 10 || reorg != nil {
+		t.Errorf("poll read %d new blocks and reorg %v, want 10 and none", len(allBlockStats), reorg)
+	}
+
+	for _, n := range []uint64{110, 111} {
+		if entry, _ := replica.blocks.getEntry(n); entry.usdPrice != 1000 {
+			t.Errorf("block %d has price %v, want 1000", n, entry.usdPrice)
+		}
+	}
+
+	// the replica has the aggregates of the writer with the new prices
+	writer.blocks.addBlocks(pricedBlockStats...)
+	err = writer.refreshAggregateTotals(110)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuanceUSD, want := dayIssuanceUSD(t, replica), dayIssuanceUSD(t, writer); issuanceUSD != want || issuanceUSD == "0x0" {
+		t.Errorf("issuance is %s USD, want %s", issuanceUSD, want)
+	}
+
+	// the blocks read again in the overlap are unchanged
+	for _, b := range pricedBlockStats {
+		if !replica.blocks.isStored(b) {
+			t.Errorf("block %d is not stored with its price", b.Number)
+		}
+	}
+	allBlockStats, reorg, err = replica.pollDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allBlockStats) != 0 || reorg != nil {
+		t.Errorf("second poll read %d new blocks and reorg %v, want none", len(allBlockStats), reorg)
+	}
+}
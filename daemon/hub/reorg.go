@@ -0,0 +1,154 @@
+package hub
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+// maxReorgDepth is how many blocks are walked back looking for a common
+// ancestor before giving up on a reorg.
+const maxReorgDepth = 64
+
+func (s *Stats) getBlockHash(blockNumber uint64) string {
+	return s.blocks.getHash(blockNumber)
+}
+
+// isOrphaned returns true when the block stored for blockNumber is known and
+// its hash no longer matches hash.
+func (s *Stats) isOrphaned(blockNumber uint64, hash string) bool {
+	storedHash := s.getBlockHash(blockNumber)
+
+	return storedHash != "" && !strings.EqualFold(storedHash, hash)
+}
+
+func (s *Stats) getCanonicalHash(blockNumber uint64) (string, error) {
+	block, err := s.getNodeBlock(blockNumber, true)
+	if err != nil {
+		return "", err
+	}
+
+	return block.Hash, nil
+}
+
+// findCommonAncestor walks back from blockNumber until the stored block hash
+// matches the hash the node has for the same height.
+func (s *Stats) findCommonAncestor(blockNumber uint64) (uint64, error) {
+	for i := blockNumber; i >= s.londonBlock; i-- {
+		if blockNumber-i >= maxReorgDepth {
+			return 0, fmt.Errorf("no common ancestor found within %d blocks of %d", maxReorgDepth, blockNumber)
+		}
+
+		// blocks stored before hashes were recorded cannot be compared
+		storedHash := s.getBlockHash(i)
+		if storedHash == "" {
+			return i, nil
+		}
+
+		canonicalHash, err := s.getCanonicalHash(i)
+		if err != nil {
+			return 0, err
+		}
+
+		if strings.EqualFold(storedHash, canonicalHash) {
+			return i, nil
+		}
+
+		log.Warnf("reorg: block %d orphaned, have %s and want %s", i, storedHash, canonicalHash)
+	}
+
+	return s.lastBerlinBlock, nil
+}
+
+// rollbackBlocks removes every block after ancestor up to head from memory and
+// from the database.
+func (s *Stats) rollbackBlocks(ancestor uint64, head uint64) error {
+	s.rollbackMemory(ancestor, head)
+
+	return s.db.DeleteBlocksAfter(ancestor)
+}
+
+// rollbackMemory removes every block after ancestor up to head from memory.
+func (s *Stats) rollbackMemory(ancestor uint64, head uint64) {
+	s.blocks.removeBlocksAfter(ancestor)
+
+	s.latestBlocks.removeBlocksAfter(ancestor)
+	s.latestBlock.rollbackBlockNumber(ancestor)
+}
+
+// processReorg walks back from block from until the stored chain matches the
+// node again, rolls back the orphaned blocks up to the latest processed block
+// or block to, whichever is higher, and replays the canonical blocks in their
+// place. The blocks after to the node does not have yet are left to the next
+// heads. It returns nil if no stored block was orphaned.
+func (s *Stats) processReorg(from uint64, to uint64) (*ReorgData, error) {
+	start := time.Now()
+
+	ancestor, err := s.findCommonAncestor(from)
+	if err != nil {
+		return nil, err
+	}
+
+	head := s.latestBlock.getBlockNumber()
+	if to > head {
+		head = to
+	}
+
+	if ancestor >= head {
+		return nil, nil
+	}
+
+	log.Warnf("reorg: common ancestor %d, rolling back blocks %d -> %d", ancestor, ancestor+1, head)
+
+	err = s.rollbackBlocks(ancestor, head)
+	if err != nil {
+		return nil, fmt.Errorf("error rolling back blocks after %d: %v", ancestor, err)
+	}
+
+	reorg := &ReorgData{
+		Blocks:         []sql.BlockStats{},
+		CommonAncestor: ancestor,
+		Depth:          head - ancestor,
+	}
+
+	replayed := ancestor
+	for i := ancestor + 1; i <= head; i++ {
+		blockStats, blockStatsPercentiles, err := s.updateBlockStats(i, true)
+		if err != nil && i > to {
+			log.Warnf("reorg: stopping the replay at block %d: %v", i, err)
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot update block stats for '%d', %v", i, err)
+		}
+
+		err = s.db.AddBlock(blockStats, blockStatsPercentiles)
+		s.health.setDBResult(err)
+		if err != nil {
+			return nil, fmt.Errorf("error adding block %d to database: %v", i, err)
+		}
+		s.latestBlocks.addBlock(blockStats, false)
+		s.latestBlock.updateBlockNumber(i)
+
+		reorg.Blocks = append(reorg.Blocks, blockStats)
+		replayed = i
+	}
+
+	// without a replayed block the aggregates are only cut at the ancestor
+	refreshFrom := ancestor
+	if replayed > ancestor {
+		refreshFrom = ancestor + 1
+	}
+
+	err = s.refreshAggregateTotals(refreshFrom)
+	if err != nil {
+		return nil, fmt.Errorf("error refreshing aggregate totals from block %d: %v", refreshFrom, err)
+	}
+
+	duration := time.Since(start) / time.Millisecond
+	log.Warnf("reorg: replaced %d blocks with %d blocks after %d (ptime: %dms)", reorg.Depth, len(reorg.Blocks), ancestor, duration)
+
+	return reorg, nil
+}
@@ -0,0 +1,390 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/network"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+const testLondonBlock = 100
+
+// testBlockReward is the reward of the proof of work blocks, in wei.
+const testBlockReward = "2000000000000000000"
+
+// fakeNode serves the blocks of a chain the test can switch, the blocks have
+// no transaction so no receipt is fetched unless transactions is set.
+type fakeNode struct {
+	mu     sync.Mutex
+	hashes map[uint64]string
+
+	// transactions makes the blocks proof of work blocks with a transaction
+	// using fakeGasUsed gas and paying fakeTip per gas above the base fee.
+	transactions bool
+}
+
+// fakeBaseFee is the base fee of every block served by fakeNode, in wei.
+const fakeBaseFee = 1_000_000_000
+
+// fakeTip is the tip per gas of the transactions served by fakeNode, in wei.
+const fakeTip = 2_000_000_000
+
+// fakeGasUsed returns the gas used by the transaction of blockNumber.
+func fakeGasUsed(blockNumber uint64) uint64 {
+	return blockNumber * 1000
+}
+
+func fakeTransactionHash(blockNumber uint64) string {
+	return fmt.Sprintf("0x%064x", 1_000_000+blockNumber)
+}
+
+// setChain makes the node serve blocks from -> to with hashes tagged by
+// chain, the blocks before from are kept.
+func (n *fakeNode) setChain(chain string, from uint64, to uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.hashes == nil {
+		n.hashes = map[uint64]string{}
+	}
+	for i := range n.hashes {
+		if i >= from {
+			delete(n.hashes, i)
+		}
+	}
+	for i := from; i <= to; i++ {
+		n.hashes[i] = fakeHash(chain, i)
+	}
+}
+
+func fakeHash(chain string, blockNumber uint64) string {
+	return fmt.Sprintf("0x%s%062x", map[string]string{"a": "aa", "b": "bb", "c": "cc"}[chain], blockNumber)
+}
+
+func (n *fakeNode) getBlock(blockNumber uint64) interface{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	hash, ok := n.hashes[blockNumber]
+	if !ok {
+		return nil
+	}
+
+	difficulty := "0x0"
+	gasUsed := uint64(0)
+	transactions := []string{}
+	if n.transactions {
+		difficulty = "0x1"
+		gasUsed = fakeGasUsed(blockNumber)
+		transactions = append(transactions, fakeTransactionHash(blockNumber))
+	}
+
+	zeroHash := fmt.Sprintf("0x%064x", 0)
+	return map[string]interface{}{
+		"number":           hexutil.EncodeUint64(blockNumber),
+		"hash":             hash,
+		"parentHash":       n.hashes[blockNumber-1],
+		"timestamp":        hexutil.EncodeUint64(1_000_000 + blockNumber*12),
+		"gasUsed":          hexutil.EncodeUint64(gasUsed),
+		"gasLimit":         "0x1c9c380",
+		"baseFeePerGas":    hexutil.EncodeUint64(fakeBaseFee),
+		"difficulty":       difficulty,
+		"transactions":     transactions,
+		"uncles":           []string{},
+		"sha3Uncles":       zeroHash,
+		"miner":            fmt.Sprintf("0x%040x", 0),
+		"stateRoot":        zeroHash,
+		"transactionsRoot": zeroHash,
+		"receiptsRoot":     zeroHash,
+		"logsBloom":        fmt.Sprintf("0x%0512x", 0),
+		"extraData":        "0x",
+	}
+}
+
+// getReceipt returns the receipt of the transaction of a block served with
+// transactions.
+func (n *fakeNode) getReceipt(transactionHash string) interface{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for blockNumber, hash := range n.hashes {
+		if n.transactions && fakeTransactionHash(blockNumber) == transactionHash {
+			return map[string]interface{}{
+				"blockHash":         hash,
+				"blockNumber":       hexutil.EncodeUint64(blockNumber),
+				"gasUsed":           hexutil.EncodeUint64(fakeGasUsed(blockNumber)),
+				"effectiveGasPrice": hexutil.EncodeUint64(fakeBaseFee + fakeTip),
+				"transactionHash":   transactionHash,
+				"type":              "0x2",
+			}
+		}
+	}
+
+	return nil
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	var message jsonrpcMessage
+	if json.Unmarshal(body, &message) != nil {
+		http.Error(w, "batch requests are not supported", http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": message.ID}
+	switch message.Method {
+	case "eth_getBlockByNumber":
+		var params []interface{}
+		json.Unmarshal(message.Params, &params)
+		blockNumber, _ := hexutil.DecodeUint64(params[0].(string))
+		response["result"] = n.getBlock(blockNumber)
+	case "eth_getTransactionReceipt":
+		var params []string
+		json.Unmarshal(message.Params, &params)
+		response["result"] = n.getReceipt(params[0])
+	default:
+		response["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// newTestStats returns stats tracking the chain of node from testLondonBlock,
+// stored in a temporary SQLite database.
+func newTestStats(t *testing.T, node *fakeNode) *Stats {
+	t.Helper()
+
+	return newTestStatsWithDB(t, node, filepath.Join(t.TempDir(), "test.db"))
+}
+
+// newTestStatsWithDB returns stats tracking the chain of node from
+// testLondonBlock, stored in the SQLite database at dbPath.
+func newTestStatsWithDB(t *testing.T, node *fakeNode, dbPath string) *Stats {
+	t.Helper()
+
+	server := httptest.NewServer(node)
+	t.Cleanup(server.Close)
+
+	// the config is loaded from a file to be validated like the daemon does
+	b, err := json.Marshal(network.Config{
+		Name:    "test",
+		ChainID: 1337,
+		BlockRewards: []network.BlockReward{
+			{Block: 0, Reward: testBlockReward},
+		},
+		LondonBlock:     testLondonBlock,
+		LondonTimestamp: 1_000_000 + testLondonBlock*12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(t.TempDir(), "network.json")
+	err = ioutil.WriteFile(configPath, b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	networkConfig, err := network.Load("", configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Stats{}
+	err = s.initializeState(dbPath, networkConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.rpcClient = &RPCClient{endpoint: server.URL, httpClient: server.Client()}
+	s.transactionReceiptWorker = &TransactionReceiptWorker{NumWorkers: 1, Endpoint: server.URL}
+	s.transactionReceiptWorker.Initialize()
+
+	err = s.initForkTimestamps()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// processBlocks processes the blocks from -> to like the heads of the node.
+func processBlocks(t *testing.T, s *Stats, from uint64, to uint64) {
+	t.Helper()
+
+	for i := from; i <= to; i++ {
+		_, _, err := s.processBlock(i, false)
+		if err != nil {
+			t.Fatalf("processBlock(%d): %v", i, err)
+		}
+	}
+}
+
+// checkChain checks the blocks from -> to are stored in memory and in the
+// database with the hashes of chain.
+func checkChain(t *testing.T, s *Stats, chain string, from uint64, to uint64) {
+	t.Helper()
+
+	for i := from; i <= to; i++ {
+		if hash := s.getBlockHash(i); hash != fakeHash(chain, i) {
+			t.Errorf("block %d has hash %s in memory, want %s", i, hash, fakeHash(chain, i))
+		}
+
+		blockStats, ok, err := s.db.GetBlockStats(i)
+		if err != nil || !ok {
+			t.Errorf("block %d is not in the database: %v", i, err)
+		} else if blockStats.Hash != fakeHash(chain, i) {
+			t.Errorf("block %d has hash %s in the database, want %s", i, blockStats.Hash, fakeHash(chain, i))
+		}
+	}
+}
+
+// checkLatest checks latest is the latest block, with its totals, and that no
+// block after it is left.
+func checkLatest(t *testing.T, s *Stats, latest uint64) {
+	t.Helper()
+
+	if latestBlock := s.latestBlock.getBlockNumber(); latestBlock != latest {
+		t.Errorf("latest block is %d, want %d", latestBlock, latest)
+	}
+
+	if _, ok := s.blocks.getEntry(latest + 1); ok {
+		t.Errorf("block %d is still in memory", latest+1)
+	}
+
+	if _, ok, _ := s.db.GetBlockStats(latest + 1); ok {
+		t.Errorf("block %d is still in the database", latest+1)
+	}
+
+	if _, err := s.getTotals(latest); err != nil {
+		t.Errorf("getTotals(%d): %v", latest, err)
+	}
+}
+
+func checkReorg(t *testing.T, reorg *ReorgData, blockStats sql.BlockStats, ancestor uint64, head uint64) {
+	t.Helper()
+
+	if reorg == nil {
+		t.Fatal("no reorg")
+	}
+	if reorg.CommonAncestor != ancestor {
+		t.Errorf("common ancestor is %d, want %d", reorg.CommonAncestor, ancestor)
+	}
+	if len(reorg.Blocks) != int(head-ancestor) {
+		t.Errorf("reorg replayed %d blocks, want %d", len(reorg.Blocks), head-ancestor)
+	}
+	if uint64(blockStats.Number) != head {
+		t.Errorf("processBlock returned block %d, want %d", blockStats.Number, head)
+	}
+}
+
+func TestProcessBlockReorgParentOrphaned(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 110)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 110)
+
+	// the node switches to a chain forking after block 106 and announces 111
+	node.setChain("b", 107, 111)
+
+	blockStats, reorg, err := s.processBlock(111, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkReorg(t, reorg, blockStats, 106, 111)
+	checkChain(t, s, "a", testLondonBlock, 106)
+	checkChain(t, s, "b", 107, 111)
+	checkLatest(t, s, 111)
+}
+
+func TestProcessBlockReorgRepeated(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 110)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 110)
+
+	// a new head builds on another block 110
+	node.setChain("b", 108, 111)
+
+	blockStats, reorg, err := s.processBlock(110, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkReorg(t, reorg, blockStats, 107, 110)
+	checkChain(t, s, "b", 108, 110)
+	checkLatest(t, s, 110)
+}
+
+func TestProcessBlockReorgAncestorBelowLatest(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 110)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 110)
+
+	// the node answers block 107 unchanged but replaced the blocks after it,
+	// so the ancestor is the repeated block itself while 110 was processed
+	node.setChain("b", 108, 110)
+
+	blockStats, reorg, err := s.processBlock(107, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkReorg(t, reorg, blockStats, 107, 110)
+	checkChain(t, s, "a", testLondonBlock, 107)
+	checkChain(t, s, "b", 108, 110)
+	checkLatest(t, s, 110)
+}
+
+func TestProcessBlockReorgShorterChain(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 110)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 110)
+
+	// the node flipped back to a chain that is only at block 108 yet
+	node.setChain("b", 106, 108)
+
+	blockStats, reorg, err := s.processBlock(107, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkReorg(t, reorg, blockStats, 105, 108)
+	checkChain(t, s, "b", 106, 108)
+	checkLatest(t, s, 108)
+
+	// the next heads extend the new chain
+	node.setChain("b", 109, 111)
+	processBlocks(t, s, 109, 111)
+	checkChain(t, s, "b", 106, 111)
+	checkLatest(t, s, 111)
+}
+
+func TestProcessBlockReorgNothingReplayed(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 110)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 110)
+
+	// the node is back at block 107 with the blocks after it gone
+	node.setChain("b", 108, 107)
+
+	blockStats, reorg, err := s.processBlock(107, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkReorg(t, reorg, blockStats, 107, 107)
+	checkChain(t, s, "a", testLondonBlock, 107)
+	checkLatest(t, s, 107)
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // RPCClient is a client for the RPC interface
@@ -19,6 +21,14 @@ type HTTPClient interface {
 	Do(request *http.Request) (*http.Response, error)
 }
 
+// BatchElem is a single call of a batch request, Result and Error are filled
+// in once the batch is sent.
+type BatchElem struct {
+	Args   []interface{}
+	Result json.RawMessage
+	Error  error
+}
+
 // CallContext is a context for a single RPC call
 func (c *RPCClient) CallContext(
 	version string,
@@ -27,10 +37,89 @@ func (c *RPCClient) CallContext(
 	updateCache bool,
 	args ...interface{},
 ) (json.RawMessage, error) {
+	message, err := c.call(version, method, blockNumber, updateCache, args...)
+	if err != nil {
+		return nil, err
+	}
 
-	requestMethod := "POST"
-	requestURL := c.endpoint
+	return message.Result, nil
+}
+
+// BatchCallContext sends all the calls of batch for the same method in a single
+// JSON-RPC batch request. The returned error is only set when the batch itself
+// failed, errors of the individual calls are set on their BatchElem.
+func (c *RPCClient) BatchCallContext(
+	version string,
+	method string,
+	blockNumber string,
+	updateCache bool,
+	batch []BatchElem,
+) error {
+	messages := make([]jsonrpcMessage, len(batch))
+	for i, elem := range batch {
+		b, err := json.Marshal(elem.Args)
+		if err != nil {
+			return err
+		}
+
+		messages[i] = jsonrpcMessage{
+			Version: version,
+			ID:      json.RawMessage(strconv.Itoa(i)),
+			Method:  method,
+			Params:  json.RawMessage(b),
+		}
+	}
+
+	b, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+
+	responseBody, err := c.post(method, blockNumber, updateCache, len(batch), b)
+	if err != nil {
+		return err
+	}
+
+	// nodes without batch support answer with a single error message
+	var responses []jsonrpcMessage
+	err = json.Unmarshal(responseBody, &responses)
+	if err != nil {
+		return fmt.Errorf("error while unmarshalling batch response body %s '%s'", err, string(responseBody))
+	}
+
+	if len(responses) != len(batch) {
+		return fmt.Errorf("batch response has %d messages, expected %d", len(responses), len(batch))
+	}
 
+	for i := range batch {
+		batch[i].Error = fmt.Errorf("missing response for batch message %d", i)
+	}
+
+	for _, response := range responses {
+		i, err := strconv.Atoi(string(response.ID))
+		if err != nil || i < 0 || i >= len(batch) {
+			return fmt.Errorf("batch response has unknown id '%s'", string(response.ID))
+		}
+
+		batch[i].Result = response.Result
+		batch[i].Error = nil
+		if response.Error != nil {
+			batch[i].Error = response.Error
+		}
+	}
+
+	return nil
+}
+
+// call sends a single RPC call and returns the whole response message, which
+// includes the error returned by the node if any.
+func (c *RPCClient) call(
+	version string,
+	method string,
+	blockNumber string,
+	updateCache bool,
+	args ...interface{},
+) (*jsonrpcMessage, error) {
 	b, err := json.Marshal(args)
 	if err != nil {
 		return nil, err
@@ -47,7 +136,35 @@ func (c *RPCClient) CallContext(
 	if err != nil {
 		return nil, err
 	}
-	requestBody := bytes.NewReader(b)
+
+	responseBody, err := c.post(method, blockNumber, updateCache, 0, b)
+	if err != nil {
+		return nil, err
+	}
+
+	//Unmarshalling json response to the required type
+	var message jsonrpcMessage
+
+	err = json.Unmarshal(responseBody, &message)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshalling response body %s '%s'", err, string(responseBody))
+	}
+
+	return &message, nil
+}
+
+func (c *RPCClient) post(
+	method string,
+	blockNumber string,
+	updateCache bool,
+	batchSize int,
+	body []byte,
+) ([]byte, error) {
+	defer observeSince(metrics.rpcCalls.WithLabelValues(method), time.Now())
+
+	requestMethod := "POST"
+	requestURL := c.endpoint
+	requestBody := bytes.NewReader(body)
 
 	// Creating *Request instance based on the above variables
 	request, err := http.NewRequest(
@@ -65,6 +182,9 @@ func (c *RPCClient) CallContext(
 	if blockNumber != "" {
 		request.Header.Add("X-Custom-Block-Number", blockNumber)
 	}
+	if batchSize > 0 {
+		request.Header.Add("X-Custom-Batch-Size", strconv.Itoa(batchSize))
+	}
 	if updateCache {
 		request.Header.Add("X-Custom-Update-Cache", "true")
 	} else {
@@ -84,13 +204,5 @@ func (c *RPCClient) CallContext(
 		return nil, fmt.Errorf("error while reading http response body %s", err)
 	}
 
-	//Unmarshalling json response to the required type
-	var message jsonrpcMessage
-
-	err = json.Unmarshal(responseBody, &message)
-	if err != nil {
-		return nil, fmt.Errorf("error while unmarshalling response body %s '%s'", err, string(responseBody))
-	}
-
-	return message.Result, nil
+	return responseBody, nil
 }
@@ -6,27 +6,20 @@ import (
 	"math"
 	"math/big"
 	"net/http"
-	"reflect"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/network"
 	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
 )
 
-type statsMap struct {
-	mu sync.Mutex
-	v  map[uint64]sql.BlockStats
-}
-
-type totalsMap struct {
-	mu sync.Mutex
-	v  map[uint64]Totals
-}
+// maxBlockStatsRange is how many blocks are returned at once by
+// internal_getBlockStatsRange.
+const maxBlockStatsRange = 100
 
 type Syncing struct {
 	CurrentBlock string `json:"currentBlock"`
@@ -41,121 +34,302 @@ type Stats struct {
 	latestBlock  *LatestBlock
 	latestBlocks *LatestBlocks
 
-	byzantiumBlock      uint64
-	constantinopleBlock uint64
+	network             *network.Config
 	lastBerlinBlock     uint64
 	lastBerlinTimestamp uint64
 	londonBlock         uint64
 	londonTimestamp     uint64
+	parisTimestamp      uint64
 
 	ethSyncing *Syncing
 
-	statsByBlock   statsMap
-	totalsByBlock  totalsMap
-	totalsPerDay   *TotalsList
-	totalsPerHour  *TotalsList
-	totalsPerMonth *TotalsList
+	health HealthState
+
+	// readOnly stats follow the database and never write to it
+	readOnly bool
+
+	// followedAt is when the latest block read again by read-only stats was
+	// written, in unix nanoseconds
+	followedAt int64
+
+	blocks *BlockIndex
+
+	// aggregates are the periods of every granularity in UTC, by name
+	aggregates      map[string]*TotalsList
+	zonedAggregates *ZonedAggregates
 
 	// Used to perform the transaction receipt fetching within a worker
 	transactionReceiptWorker *TransactionReceiptWorker
+
+	// Used to include the consensus layer issuance after the merge
+	beaconClient      *BeaconClient
+	beaconGenesisTime uint64
+	consensusIssuance *ConsensusIssuance
+
+	// Used to record the ETH/USD price of every block, prices is nil in the
+	// commands that do not watch the live prices
+	prices    *PriceWatcher
+	usdPrices *USDPrices
 }
 
 func (s *Stats) initialize(
 	gethEndpointHTTP string,
 	dbPath string,
-	ropsten bool,
+	networkConfig *network.Config,
 	workerCount int,
+	beaconEndpoint string,
 ) error {
-	var err error
-	s.byzantiumBlock = uint64(4_370_000)
-	s.constantinopleBlock = uint64(7_280_000)
-	s.lastBerlinBlock = uint64(12_964_999)
-	s.lastBerlinTimestamp = uint64(1628166812)
-	s.londonBlock = uint64(12_965_000)
-	s.londonTimestamp = uint64(1628166822)
-
-	if ropsten {
-		s.byzantiumBlock = uint64(1_700_000)
-		s.constantinopleBlock = uint64(4_230_000)
-		s.lastBerlinBlock = uint64(10_499_400)
-		s.lastBerlinTimestamp = uint64(1624500042)
-		s.londonBlock = uint64(10_499_401)
-		s.londonTimestamp = uint64(1624500217)
+	err := s.initializeClients(gethEndpointHTTP, dbPath, networkConfig, workerCount)
+	if err != nil {
+		return err
 	}
 
-	log.Infof("Initialize rpcClientHttp '%s'", gethEndpointHTTP)
+	highestBlockInDB, err := s.initGetBlocksFromDB()
+	if err != nil {
+		log.Errorf("error during initGetGetBlocksFromDB: %v", err)
+		return err
+	}
 
-	s.rpcClient = &RPCClient{
-		endpoint:   gethEndpointHTTP,
-		httpClient: new(http.Client),
+	err = s.initGetLatestBlocks(highestBlockInDB)
+	if err != nil {
+		log.Errorf("error during initGetLatestBlocks: %v", err)
+		return err
 	}
 
-	s.latestBlock = newLatestBlock()
-	s.latestBlocks = newLatestBlocks(300)
+	err = s.getMissingBlocks()
+	if err != nil {
+		log.Errorf("error during getMissingBlocks: %v", err)
+		return err
+	}
 
-	s.db, err = sql.ConnectDatabase(dbPath)
+	if beaconEndpoint != "" {
+		err = s.initBeaconEndpoint(beaconEndpoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.loadTotals(s.latestBlock.getBlockNumber())
+	if err != nil {
+		log.Errorf("error during loadTotals: %v", err)
+		return err
+	}
+
+	err = s.initializeLatestBlocks()
 	if err != nil {
+		log.Errorf("error during initializeLatestBlocks: %v", err)
 		return err
 	}
 
+	if s.consensusIssuance != nil {
+		go s.watchConsensusIssuance()
+	}
+
+	return err
+}
+
+// initializeClients connects to the node and the database, it does not fetch
+// any block.
+func (s *Stats) initializeClients(
+	gethEndpointHTTP string,
+	dbPath string,
+	networkConfig *network.Config,
+	workerCount int,
+) error {
+	err := s.initializeState(dbPath, networkConfig)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Initialize rpcClientHttp '%s'", gethEndpointHTTP)
+
+	s.rpcClient = &RPCClient{
+		endpoint:   gethEndpointHTTP,
+		httpClient: new(http.Client),
+	}
+
 	s.transactionReceiptWorker = &TransactionReceiptWorker{
 		NumWorkers: workerCount,
 		Endpoint:   gethEndpointHTTP,
 	}
 
-	s.statsByBlock = statsMap{v: make(map[uint64]sql.BlockStats)}
-	s.totalsByBlock = totalsMap{v: make(map[uint64]Totals)}
-
-	s.totalsPerDay = newTotalsList()
-	s.totalsPerHour = newTotalsList()
-	s.totalsPerMonth = newTotalsList()
-
 	s.transactionReceiptWorker.Initialize()
 
+	err = s.initCheckChainID()
+	if err != nil {
+		log.Errorf("error during initCheckChainID: %v", err)
+		return err
+	}
+
 	err = s.initWaitForSyncingFalse()
 	if err != nil {
 		log.Errorf("error during initWaitForSyncingFalse: %v", err)
 		return err
 	}
 
+	err = s.initForkTimestamps()
+	if err != nil {
+		log.Errorf("error during initForkTimestamps: %v", err)
+		return err
+	}
+
 	_, err = s.updateLatestBlock()
 	if err != nil {
 		return fmt.Errorf("error updating latest block: %v", err)
 	}
 
-	highestBlockInDB, err := s.initGetBlocksFromDB()
+	return nil
+}
+
+// initializeState sets up the network, the database and the in-memory state.
+func (s *Stats) initializeState(dbPath string, networkConfig *network.Config) error {
+	var err error
+	s.network = networkConfig
+	s.londonBlock = networkConfig.LondonBlock
+	s.londonTimestamp = networkConfig.LondonTimestamp
+	s.parisTimestamp = networkConfig.ParisTimestamp
+
+	// the genesis block has no transactions, so networks launched with london
+	// are tracked from the first block after it
+	if s.londonBlock == 0 {
+		s.londonBlock = 1
+		s.londonTimestamp = 0
+	}
+	s.lastBerlinBlock = s.londonBlock - 1
+
+	s.latestBlock = newLatestBlock()
+	s.latestBlocks = newLatestBlocks(300)
+
+	s.db, err = sql.ConnectDatabase(dbPath)
 	if err != nil {
-		log.Errorf("error during initGetGetBlocksFromDB: %v", err)
 		return err
 	}
 
-	err = s.initGetLatestBlocks(highestBlockInDB)
+	err = s.initUSDPrices()
 	if err != nil {
-		log.Errorf("error during initGetLatestBlocks: %v", err)
 		return err
 	}
 
-	err = s.getMissingBlocks()
+	s.blocks = newBlockIndex(s.londonBlock)
+
+	s.aggregates = map[string]*TotalsList{}
+	for _, g := range granularities {
+		s.aggregates[g.Name] = newTotalsList()
+	}
+	s.zonedAggregates = newZonedAggregates()
+
+	return nil
+}
+
+func (s *Stats) initBeaconEndpoint(beaconEndpoint string) error {
+	if s.network.ParisBlock == nil {
+		return fmt.Errorf("network '%s' has not merged, there is no consensus issuance", s.network.Name)
+	}
+
+	err := s.initConsensusIssuance(beaconEndpoint)
 	if err != nil {
-		log.Errorf("error during getMissingBlocks: %v", err)
+		log.Errorf("error during initConsensusIssuance: %v", err)
 		return err
 	}
 
-	err = s.updateAllTotals(s.latestBlock.getBlockNumber())
+	return nil
+}
+
+func (s *Stats) initCheckChainID() error {
+	chainIDRaw, err := s.rpcClient.CallContext(
+		"2.0",
+		"eth_chainId",
+		"",
+		false,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get chain id from geth: %v", err)
+	}
+
+	var hexChainID string
+	err = json.Unmarshal(chainIDRaw, &hexChainID)
 	if err != nil {
-		log.Errorf("error during updateAllTotals: %v", err)
-		return err
+		return fmt.Errorf("couldn't unmarshal eth_chainId response: %v", chainIDRaw)
 	}
 
-	err = s.updateAllAggregateTotals(s.latestBlock.getBlockNumber())
+	chainID, err := hexutil.DecodeUint64(hexChainID)
+	if err != nil {
+		return fmt.Errorf("chain id could not be decoded from hex to uint: %v", hexChainID)
+	}
+
+	if chainID != s.network.ChainID {
+		return fmt.Errorf("geth is on chain %d but network '%s' is chain %d", chainID, s.network.Name, s.network.ChainID)
+	}
+
+	log.Infof("init: network %s (chain %d)", s.network.Name, chainID)
+
+	return nil
+}
+
+// initForkTimestamps reads the fork timestamps the network config leaves out
+// from the blocks that activated them.
+func (s *Stats) initForkTimestamps() error {
+	var err error
+
+	s.lastBerlinTimestamp, err = s.getNodeBlockTimestamp(s.lastBerlinBlock)
 	if err != nil {
-		log.Errorf("error during updateAllAggregateTotals: %v", err)
 		return err
 	}
 
-	s.initializeLatestBlocks()
+	if s.londonTimestamp == 0 {
+		s.londonTimestamp, err = s.getNodeBlockTimestamp(s.londonBlock)
+		if err != nil {
+			return err
+		}
+	}
 
-	return err
+	if s.parisTimestamp == 0 && s.network.ParisBlock != nil {
+		s.parisTimestamp, err = s.getNodeBlockTimestamp(*s.network.ParisBlock)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Infof("init: london block %d at %d, paris at %d", s.londonBlock, s.londonTimestamp, s.parisTimestamp)
+
+	return nil
+}
+
+func (s *Stats) getNodeBlock(blockNumber uint64, updateCache bool) (Block, error) {
+	block := Block{}
+
+	rawResponse, err := s.rpcClient.CallContext(
+		"2.0",
+		"eth_getBlockByNumber",
+		strconv.Itoa(int(blockNumber)),
+		updateCache,
+		hexutil.EncodeUint64(blockNumber),
+		false,
+	)
+	if err != nil {
+		return block, fmt.Errorf("error eth_getBlockByNumber: %v", err)
+	}
+
+	err = json.Unmarshal(rawResponse, &block)
+	if err != nil {
+		return block, fmt.Errorf("error eth_getBlockByNumber Unmarshal Block: %v", err)
+	}
+
+	return block, nil
+}
+
+func (s *Stats) getNodeBlockTimestamp(blockNumber uint64) (uint64, error) {
+	block, err := s.getNodeBlock(blockNumber, false)
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp, err := hexutil.DecodeUint64(block.Timestamp)
+	if err != nil {
+		return 0, fmt.Errorf("error decode timestamp of block %d (%s): %v", blockNumber, block.Timestamp, err)
+	}
+
+	return timestamp, nil
 }
 
 func (s *Stats) initWaitForSyncingFalse() error {
@@ -194,6 +368,7 @@ func (s *Stats) initWaitForSyncingFalse() error {
 				return fmt.Errorf("couldn't decode eth_syncing HighestBlock: %v", err)
 			}
 
+			s.health.setSyncing(s.ethSyncing)
 			log.Infof("init: geth is syncing: %d/%d", current, highest)
 		}
 		if ethSyncing {
@@ -203,6 +378,7 @@ func (s *Stats) initWaitForSyncingFalse() error {
 
 	log.Infof("init: geth syncing finished")
 	s.ethSyncing = nil
+	s.health.setSyncing(nil)
 
 	return nil
 }
@@ -242,18 +418,15 @@ func (s *Stats) initGetBlocksFromDB() (uint64, error) {
 	}
 	log.Infof("init: GetBlocksFromDB - Highest block is %d", highestBlockInDB)
 
-	allBlockStats, err := s.db.GetAllBlockStats()
+	err = s.db.EachBlockStats(10000, func(blockStats []sql.BlockStats) error {
+		s.blocks.addBlocks(blockStats...)
+		return nil
+	})
 	if err != nil {
-		return s.londonBlock, fmt.Errorf("error getting totals from database: %v", err)
+		return s.londonBlock, fmt.Errorf("error getting blocks from database: %v", err)
 	}
 
-	for _, b := range allBlockStats {
-		s.statsByBlock.mu.Lock()
-		s.statsByBlock.v[uint64(b.Number)] = b
-		s.statsByBlock.mu.Unlock()
-	}
-
-	log.Infof("init: GetBlocksFromDB - Imported %d blocks", len(allBlockStats))
+	log.Infof("init: GetBlocksFromDB - Imported %d blocks (index: %d MB)", s.blocks.len(), s.blocks.size()/1_000_000)
 
 	return highestBlockInDB, nil
 }
@@ -265,146 +438,181 @@ func (s *Stats) initGetLatestBlocks(highestBlockInDB uint64) error {
 	if currentBlock == 1 {
 		currentBlock = s.londonBlock
 	}
-	latestBlock := s.latestBlock.getBlockNumber()
-	log.Infof("init: GetLatestBlocks - Fetching %d blocks (%d -> %d)", latestBlock-highestBlockInDB, currentBlock, latestBlock)
-
-	var batchBlockStats []sql.BlockStats
-	var batchBlockStatsPercentiles []sql.BlockStatsPercentiles
 
-	if latestBlock >= currentBlock {
-		for {
-			var err error
-			blockStats, blockStatsPercentiles, err := s.updateBlockStats(currentBlock, false)
-			if err != nil {
-				return fmt.Errorf("cannot update block stats for '%d',  %v", currentBlock, err)
-			}
+	// keep backfilling until the head stops moving
+	for {
+		latestBlock := s.latestBlock.getBlockNumber()
+		if currentBlock > latestBlock {
+			break
+		}
 
-			batchBlockStats = append(batchBlockStats, blockStats)
-			for _, bsp := range blockStatsPercentiles {
-				batchBlockStatsPercentiles = append(batchBlockStatsPercentiles, bsp)
-			}
+		log.Infof("init: GetLatestBlocks - Fetching %d blocks (%d -> %d)", latestBlock-currentBlock+1, currentBlock, latestBlock)
 
-			if currentBlock%100 == 0 || currentBlock == s.latestBlock.getBlockNumber() {
-				s.db.AddBlocks(batchBlockStats, batchBlockStatsPercentiles)
-				batchBlockStats = nil
-				batchBlockStatsPercentiles = nil
-			}
+		err := s.backfillBlocks("latest", currentBlock, latestBlock, false)
+		if err != nil {
+			return err
+		}
+		currentBlock = latestBlock + 1
 
-			//s.db.AddBlock(blockStats, blockStatsPercentiles)
-
-			if currentBlock == latestBlock {
-				latestBlock, err = s.updateLatestBlock()
-				if err != nil {
-					return fmt.Errorf("error updating latest block: %v", err)
-				}
-				log.Infof("Latest block: %d", latestBlock)
-				if currentBlock == latestBlock {
-					break
-				}
-			}
-			currentBlock++
+		latestBlock, err = s.updateLatestBlock()
+		if err != nil {
+			return fmt.Errorf("error updating latest block: %v", err)
 		}
+		log.Infof("Latest block: %d", latestBlock)
 	}
 
 	return nil
 }
 
 func (s *Stats) getMissingBlocks() error {
-	var blockNumbers, missingBlockNumbers []uint64
-
-	s.statsByBlock.mu.Lock()
-	if _, ok := s.statsByBlock.v[s.londonBlock]; !ok {
-		missingBlockNumbers = append(missingBlockNumbers, s.londonBlock)
-	}
-
-	for _, b := range s.statsByBlock.v {
-		blockNumbers = append(blockNumbers, uint64(b.Number))
-	}
-	s.statsByBlock.mu.Unlock()
-
-	// sort slice to find missing blocks
-	sort.Slice(blockNumbers, func(i, j int) bool { return blockNumbers[i] < blockNumbers[j] })
-
-	for i := 1; i < len(blockNumbers); i++ {
-		if blockNumbers[i]-blockNumbers[i-1] != 1 {
-			for x := uint64(1); x < blockNumbers[i]-blockNumbers[i-1]; x++ {
-				missingBlockNumber := blockNumbers[i-1] + x
-				if missingBlockNumber > s.londonBlock {
-					missingBlockNumbers = append(missingBlockNumbers, missingBlockNumber)
-				}
-			}
-		}
-	}
+	missingBlockNumbers := s.blocks.getMissingBlocks(s.londonBlock, s.latestBlock.getBlockNumber())
 
 	if len(missingBlockNumbers) > 0 {
 		log.Infof("init: GetMissingBlocks - Fetching %d missing blocks", len(missingBlockNumbers))
 
-		for _, n := range missingBlockNumbers {
-			blockStats, blockStatsPercentiles, err := s.updateBlockStats(n, false)
-			if err != nil {
-				log.Errorf("cannot update block stats for block %d: %v", n, err)
+		// backfill every run of consecutive missing blocks at once
+		from := missingBlockNumbers[0]
+		for i, n := range missingBlockNumbers {
+			if i+1 < len(missingBlockNumbers) && missingBlockNumbers[i+1] == n+1 {
 				continue
 			}
-			s.db.AddBlock(blockStats, blockStatsPercentiles)
+
+			err := s.backfillBlocks("missing", from, n, false)
+			if err != nil {
+				log.Errorf("cannot backfill missing blocks %d -> %d: %v", from, n, err)
+			}
+
+			if i+1 < len(missingBlockNumbers) {
+				from = missingBlockNumbers[i+1]
+			}
 		}
 	}
 
 	return nil
 }
 
-func (s *Stats) initializeLatestBlocks() {
-	s.statsByBlock.mu.Lock()
-	defer s.statsByBlock.mu.Unlock()
-
+func (s *Stats) initializeLatestBlocks() error {
 	latestBlockNumber := s.latestBlock.getBlockNumber()
 
-	blockCount := min(s.latestBlocks.maxBlocks, len(s.statsByBlock.v))
+	blockCount := min(s.latestBlocks.maxBlocks, s.blocks.len())
 	log.Infof("Initialize latest %d blocks", blockCount)
-	for i := latestBlockNumber - uint64(blockCount); i <= latestBlockNumber; i++ {
-		if blockStat, ok := s.statsByBlock.v[i]; ok {
-			s.latestBlocks.addBlock(blockStat, false)
+
+	allBlockStats, err := s.db.GetBlockStatsAfter(latestBlockNumber - uint64(blockCount))
+	if err != nil {
+		return fmt.Errorf("error getting latest blocks from database: %v", err)
+	}
+
+	for _, blockStats := range allBlockStats {
+		if uint64(blockStats.Number) <= latestBlockNumber {
+			s.latestBlocks.addBlock(blockStats, false)
 		}
 	}
+
+	return nil
 }
 
-func (s *Stats) getTotals(blockNumber uint64) (Totals, error) {
-	var totals Totals
-	var ok bool
+// cumulativeTotals are the totals of every block from london up to a block,
+// the USD ones are in millionths of a dollar.
+type cumulativeTotals struct {
+	timestamp   uint64
+	blobBurned  *big.Int
+	burned      *big.Int
+	burnedUSD   int64
+	issuance    *big.Int
+	issuanceUSD int64
+	rewards     *big.Int
+	tips        *big.Int
+	tipsUSD     int64
+}
 
-	s.totalsByBlock.mu.Lock()
-	defer s.totalsByBlock.mu.Unlock()
-	if totals, ok = s.totalsByBlock.v[blockNumber]; !ok {
-		totals.Burned = "0x0"
-		totals.Issuance = "0x0"
-		totals.Rewards = "0x0"
-		totals.Tips = "0x0"
-		return totals, fmt.Errorf("error getting totals for block %d", blockNumber)
+func (s *Stats) getCumulativeTotals(blockNumber uint64) (cumulativeTotals, error) {
+	sums, ok := s.blocks.getSums(blockNumber)
+	if !ok {
+		return cumulativeTotals{}, notFoundErrorf("error getting totals for block %d", blockNumber)
 	}
 
-	return totals, nil
+	timestamp, err := s.getBlockTimestamp(blockNumber)
+	if err != nil {
+		return cumulativeTotals{}, err
+	}
+
+	// consensus layer issuance is credited to the first block after each epoch
+	consensusIssuance, consensusIssuanceUSD := s.getConsensusIssuance(s.lastBerlinTimestamp, timestamp)
+	rewards := sums.rewards.ToBig()
+	rewards.Add(rewards, consensusIssuance)
+	rewardsUSD := sums.rewardsUSD + consensusIssuanceUSD
+
+	burned := sums.burned.ToBig()
+
+	return cumulativeTotals{
+		timestamp:   timestamp,
+		blobBurned:  sums.blobBurned.ToBig(),
+		burned:      burned,
+		burnedUSD:   sums.burnedUSD,
+		issuance:    new(big.Int).Sub(rewards, burned),
+		issuanceUSD: rewardsUSD - sums.burnedUSD,
+		rewards:     rewards,
+		tips:        sums.tips.ToBig(),
+		tipsUSD:     sums.tipsUSD,
+	}, nil
 }
 
-func (s *Stats) getBlockTimestamp(blockNumber uint64) (uint64, error) {
-	var blockStats sql.BlockStats
-	var ok bool
+func (s *Stats) getTotals(blockNumber uint64) (Totals, error) {
+	totals, err := s.getCumulativeTotals(blockNumber)
+	if err != nil {
+		return newZeroTotals(), err
+	}
+
+	// the issuance is only known since london, so the supply of a network
+	// launched before london leaves out the issuance up to it
+	supply := ""
+	if genesisSupply, ok := s.network.GetGenesisSupply(); ok {
+		supply = hexutil.EncodeBig(genesisSupply.Add(genesisSupply, totals.issuance))
+	}
+
+	return Totals{
+		BlobBurned:  hexutil.EncodeBig(totals.blobBurned),
+		Burned:      hexutil.EncodeBig(totals.burned),
+		BurnedUSD:   hexutil.EncodeBig(usdBig(totals.burnedUSD)),
+		Duration:    totals.timestamp - s.londonTimestamp,
+		Issuance:    hexutil.EncodeBig(totals.issuance),
+		IssuanceUSD: hexutil.EncodeBig(usdBig(totals.issuanceUSD)),
+		Rewards:     hexutil.EncodeBig(totals.rewards),
+		Supply:      supply,
+		Tips:        hexutil.EncodeBig(totals.tips),
+		TipsUSD:     hexutil.EncodeBig(usdBig(totals.tipsUSD)),
+	}, nil
+}
 
+func (s *Stats) getBlockTimestamp(blockNumber uint64) (uint64, error) {
 	//return known timestamp of last berlin block
 	if blockNumber == s.lastBerlinBlock {
 		return s.lastBerlinTimestamp, nil
 	}
 
-	s.statsByBlock.mu.Lock()
-	defer s.statsByBlock.mu.Unlock()
-	if blockStats, ok = s.statsByBlock.v[blockNumber]; !ok {
+	entry, ok := s.blocks.getEntry(blockNumber)
+	if !ok {
 		return 0, fmt.Errorf("error getting block %d", blockNumber)
 	}
 
-	return blockStats.Timestamp, nil
+	return entry.timestamp, nil
+}
+
+// getBlockRangeTimeDelta returns the first and the last block produced in
+// [startTime, endTime), false if no block was.
+func (s *Stats) getBlockRangeTimeDelta(startTime uint64, endTime uint64) (uint64, uint64, bool) {
+	startBlock := s.blocks.searchTimestamp(startTime)
+	endBlock := s.blocks.searchTimestamp(endTime)
+
+	if endBlock <= startBlock {
+		return 0, 0, false
+	}
+
+	return startBlock, endBlock - 1, true
 }
 
 func (s *Stats) getTotalsTimeDelta(startTime uint64, endTime uint64) (Totals, error) {
 	start := time.Now()
-	var totals Totals
 
 	id := fmt.Sprintf("%d:%d", startTime, endTime)
 
@@ -412,91 +620,16 @@ func (s *Stats) getTotalsTimeDelta(startTime uint64, endTime uint64) (Totals, er
 		return Totals{}, fmt.Errorf("endTime must be greater than startTime")
 	}
 
-	// set startTime to no less than london timestamp
-	if startTime < s.londonTimestamp {
-		startTime = s.londonTimestamp
+	startBlock, endBlock, ok := s.getBlockRangeTimeDelta(startTime, endTime)
+	if !ok {
+		totals := newZeroTotals()
+		totals.ID = id
+		return totals, nil
 	}
 
-	latestBlockNumber := s.latestBlock.getBlockNumber()
-
-	latestBlockTime, err := s.getBlockTimestamp(latestBlockNumber)
+	totals, err := s.getTotalsBlockDelta(startBlock-1, endBlock)
 	if err != nil {
-		log.Errorf("getBlockTimestamp(%d): %v", latestBlockNumber, err)
-		return totals, err
-	}
-
-	if endTime > latestBlockTime {
-		endTime = latestBlockTime
-	}
-
-	// start with assumption that blocks do not process faster than 5 seconds/block
-	endBlock := latestBlockNumber - (latestBlockTime-endTime)/5
-
-	//set endBlock to no less than london block
-	if endBlock < s.londonBlock {
-		endBlock = s.londonBlock
-	}
-	endBlockTime, err := s.getBlockTimestamp(endBlock)
-	if err != nil {
-		log.Errorf("getBlockTimestamp(%d): %v", endBlock, err)
-		return totals, err
-	}
-
-	endIteration := 0
-
-	for endBlockTime < endTime {
-		endBlockTime, err = s.getBlockTimestamp(endBlock + 1)
-		if err != nil {
-			log.Errorf("getBlockTimestamp(%d): %v", endBlock, err)
-			return totals, err
-		}
-		timeOffset := int64(endTime - endBlockTime)
-		if timeOffset > 2400 {
-			//assume average block time is not > 2min within 40min window
-			endBlock += uint64(timeOffset / 120)
-		}
-		if endBlockTime < endTime {
-			endBlock++
-		}
-		endIteration++
-
-	}
-
-	if startTime > latestBlockTime {
-		startTime = latestBlockTime
-	}
-	// start with assumption that blocks do not process faster than 5 seconds/block
-	startBlock := latestBlockNumber - (latestBlockTime-startTime)/5
-	if startBlock < s.londonBlock {
-		startBlock = s.londonBlock
-	}
-	startBlockTime, err := s.getBlockTimestamp(startBlock)
-	if err != nil {
-		log.Errorf("getBlockTimestamp(%d): %v", startBlock, err)
-		return totals, err
-	}
-
-	startIteration := 0
-	for startBlockTime < startTime {
-		startBlockTime, err = s.getBlockTimestamp(startBlock + 1)
-		if err != nil {
-			log.Errorf("getBlockTimestamp(%d): %v", startBlock, err)
-			return totals, err
-		}
-		timeOffset := int64(startTime - startBlockTime)
-		if timeOffset > 2400 {
-			//assume average block time is not > 2min within 40min window
-			startBlock += uint64(timeOffset / 120)
-		}
-		if startBlockTime < startTime {
-			startBlock++
-		}
-		startIteration++
-	}
-
-	totals, err = s.getTotalsBlockDelta(startBlock, endBlock)
-	if err != nil {
-		log.Errorf("getTotalsBlockDelta(%d,%d): %v", startBlock, endBlock, err)
+		log.Errorf("getTotalsBlockDelta(%d,%d): %v", startBlock-1, endBlock, err)
 		return totals, err
 	}
 	totals.ID = id
@@ -522,242 +655,130 @@ func (s *Stats) getTotalsTimeDelta(startTime uint64, endTime uint64) (Totals, er
 
 	duration := time.Since(start) / time.Microsecond
 
-	log.Debugf("(%d -> %d) (%ds period) (%ds Δ) totals: %s%s issuance, %s burned, %s rewards, %s tips (%d SI %d EI %d us)", startBlock, endBlock, endTime-startTime, delta, issuanceNeg, issuance.String(), burned.String(), rewards.String(), tips.String(), startIteration, endIteration, duration)
+	log.Debugf("(%d -> %d) (%ds period) (%ds Δ) totals: %s%s issuance, %s burned, %s rewards, %s tips (%d us)", startBlock, endBlock, endTime-startTime, delta, issuanceNeg, issuance.String(), burned.String(), rewards.String(), tips.String(), duration)
 
 	return totals, nil
 }
 
 func (s *Stats) getBaseFeePercentilesTimeDelta(startTime uint64, endTime uint64) (BaseFeePercentiles, error) {
-	start := time.Now()
-	var baseFeePercentiles BaseFeePercentiles
-
 	if startTime >= endTime {
-		return baseFeePercentiles, fmt.Errorf("endTime must be greater than startTime")
+		return BaseFeePercentiles{}, fmt.Errorf("endTime must be greater than startTime")
 	}
 
-	// set startTime to no less than london timestamp
-	if startTime < s.londonTimestamp {
-		startTime = s.londonTimestamp
+	startBlock, endBlock, ok := s.getBlockRangeTimeDelta(startTime, endTime)
+	if !ok {
+		return BaseFeePercentiles{}, nil
 	}
 
-	latestBlockNumber := s.latestBlock.getBlockNumber()
-
-	latestBlockTime, err := s.getBlockTimestamp(latestBlockNumber)
-	if err != nil {
-		log.Errorf("getBlockTimestamp(%d): %v", latestBlockNumber, err)
-		return baseFeePercentiles, err
-	}
-
-	if endTime > latestBlockTime {
-		endTime = latestBlockTime
-	}
-
-	// start with assumption that blocks do not process faster than 5 seconds/block
-	endBlock := latestBlockNumber - (latestBlockTime-endTime)/5
-
-	//set endBlock to no less than london block
-	if endBlock < s.londonBlock {
-		endBlock = s.londonBlock
-	}
-	endBlockTime, err := s.getBlockTimestamp(endBlock)
-	if err != nil {
-		log.Errorf("getBlockTimestamp(%d): %v", endBlock, err)
-		return baseFeePercentiles, err
-	}
-
-	endIteration := 0
-
-	for endBlockTime < endTime {
-		endBlockTime, err = s.getBlockTimestamp(endBlock + 1)
-		if err != nil {
-			log.Errorf("getBlockTimestamp(%d): %v", endBlock, err)
-			return baseFeePercentiles, err
-		}
-		timeOffset := int64(endTime - endBlockTime)
-		if timeOffset > 2400 {
-			//assume average block time is not > 2min within 40min window
-			endBlock += uint64(timeOffset / 120)
-		}
-		if endBlockTime < endTime {
-			endBlock++
-		}
-		endIteration++
-
-	}
+	return s.getBaseFeePercentilesBlockDelta(startBlock, endBlock)
+}
 
-	if startTime > latestBlockTime {
-		startTime = latestBlockTime
-	}
-	// start with assumption that blocks do not process faster than 5 seconds/block
-	startBlock := latestBlockNumber - (latestBlockTime-startTime)/5
-	if startBlock < s.londonBlock {
-		startBlock = s.londonBlock
-	}
-	startBlockTime, err := s.getBlockTimestamp(startBlock)
-	if err != nil {
-		log.Errorf("getBlockTimestamp(%d): %v", startBlock, err)
-		return baseFeePercentiles, err
-	}
+// getBaseFeePercentilesBlockDelta returns the base fee percentiles of the
+// blocks startBlock -> endBlock, both included.
+func (s *Stats) getBaseFeePercentilesBlockDelta(startBlock uint64, endBlock uint64) (BaseFeePercentiles, error) {
+	start := time.Now()
+	var baseFeePercentiles BaseFeePercentiles
 
-	startIteration := 0
-	for startBlockTime < startTime {
-		startBlockTime, err = s.getBlockTimestamp(startBlock + 1)
-		if err != nil {
-			log.Errorf("getBlockTimestamp(%d): %v", startBlock, err)
-			return baseFeePercentiles, err
-		}
-		timeOffset := int64(startTime - startBlockTime)
-		if timeOffset > 2400 {
-			//assume average block time is not > 2min within 40min window
-			startBlock += uint64(timeOffset / 120)
-		}
-		if startBlockTime < startTime {
-			startBlock++
-		}
-		startIteration++
+	if startBlock > endBlock {
+		return baseFeePercentiles, fmt.Errorf("endBlock must be greater than startBlock")
 	}
 
-	s.statsByBlock.mu.Lock()
-	defer s.statsByBlock.mu.Unlock()
-
-	var allBaseFeeGwei []uint64
-
-	blockNumber := startBlock
-
-	for blockNumber <= endBlock {
-		var block sql.BlockStats
-		var ok bool
-
-		if block, ok = s.statsByBlock.v[blockNumber]; !ok {
-			return baseFeePercentiles, fmt.Errorf("block stats for block %d does not exist", blockNumber)
-		}
-
-		baseFee, err := hexutil.DecodeBig(block.BaseFee)
-		if err != nil {
-			log.Errorf("block.BaseFee is not a hex - %s", block.BaseFee)
-			return baseFeePercentiles, err
-		}
-
-		baseFeeGwei := baseFee.Div(baseFee, big.NewInt(1_000_000_000))
-
-		allBaseFeeGwei = append(allBaseFeeGwei, baseFeeGwei.Uint64())
-
-		blockNumber++
+	baseFeeCounts, ok := s.blocks.getBaseFeeCounts(startBlock, endBlock)
+	if !ok {
+		return baseFeePercentiles, notFoundErrorf("block stats of blocks %d -> %d are not all stored", startBlock, endBlock)
 	}
 
-	// sort slices that will be used for percentile calculations later
-	sort.Slice(allBaseFeeGwei, func(i, j int) bool { return allBaseFeeGwei[i] < allBaseFeeGwei[j] })
-
 	baseFeePercentiles = BaseFeePercentiles{
-		Maximum:   uint(getPercentileSortedUint64(allBaseFeeGwei, 100)),
-		Median:    uint(getPercentileSortedUint64(allBaseFeeGwei, 50)),
-		Minimum:   uint(getPercentileSortedUint64(allBaseFeeGwei, 0)),
-		Ninetieth: uint(getPercentileSortedUint64(allBaseFeeGwei, 90)),
+		Maximum:   uint(getPercentileCounts(baseFeeCounts, 100)),
+		Median:    uint(getPercentileCounts(baseFeeCounts, 50)),
+		Minimum:   uint(getPercentileCounts(baseFeeCounts, 0)),
+		Ninetieth: uint(getPercentileCounts(baseFeeCounts, 90)),
 	}
 
 	duration := time.Since(start) / time.Microsecond
 
-	log.Debugf("(%d -> %d) (%ds period) basefees: %d min, %d median, %d, max, %d 90p (%d SI %d EI %d us)", startBlock, endBlock, endTime-startTime, baseFeePercentiles.Minimum, baseFeePercentiles.Median, baseFeePercentiles.Maximum, baseFeePercentiles.Ninetieth, startIteration, endIteration, duration)
+	log.Debugf("(%d -> %d) basefees: %d min, %d median, %d, max, %d 90p (%d us)", startBlock, endBlock, baseFeePercentiles.Minimum, baseFeePercentiles.Median, baseFeePercentiles.Maximum, baseFeePercentiles.Ninetieth, duration)
 
 	return baseFeePercentiles, nil
 }
 
-func (s *Stats) getTotalsBlockDelta(startBlockNumber uint64, endBlockNumber uint64) (Totals, error) {
-	var endTotals, startTotals, totals Totals
-	var ok bool
-
-	id := fmt.Sprintf("%d:%d", startBlockNumber, endBlockNumber)
+// getTotalsRange returns the totals and base fee percentiles of the blocks
+// from -> to, both included, when unit is "block", or of the blocks produced
+// in [from, to) when unit is "time".
+func (s *Stats) getTotalsRange(from uint64, to uint64, unit string) (Totals, error) {
+	var startBlock, endBlock uint64
 
-	if startBlockNumber > endBlockNumber {
-		return Totals{}, fmt.Errorf("endBlockNumber must be greater than startBlockNumber")
-	}
-	s.totalsByBlock.mu.Lock()
-	defer s.totalsByBlock.mu.Unlock()
-	if endTotals, ok = s.totalsByBlock.v[endBlockNumber]; !ok {
-		totals.Burned = "0x0"
-		totals.Issuance = "0x0"
-		totals.Rewards = "0x0"
-		totals.Tips = "0x0"
-		return totals, fmt.Errorf("error getting totals for block %d", endBlockNumber)
-	}
-
-	if startTotals, ok = s.totalsByBlock.v[startBlockNumber]; !ok {
-		totals.Burned = "0x0"
-		totals.Issuance = "0x0"
-		totals.Rewards = "0x0"
-		totals.Tips = "0x0"
-		return totals, fmt.Errorf("error getting totals for block %d", startBlockNumber)
-	}
-
-	startBlockTime, err := s.getBlockTimestamp(startBlockNumber)
-	if err != nil {
-		log.Errorf("getBlockTimestamp(%d): %v", startBlockNumber, err)
-		return totals, err
-	}
-
-	endBlockTime, err := s.getBlockTimestamp(endBlockNumber)
-	if err != nil {
-		log.Errorf("getBlockTimestamp(%d): %v", endBlockNumber, err)
-		return totals, err
-	}
-
-	endBurned, err := hexutil.DecodeBig(endTotals.Burned)
-	if err != nil {
-		log.Errorf("endTotals.Burned is not a hex - %s", endTotals.Burned)
-		return totals, err
-	}
-	startBurned, err := hexutil.DecodeBig(startTotals.Burned)
-	if err != nil {
-		log.Errorf("startTotals.Burned is not a hex - %s", startTotals.Burned)
-		return totals, err
-	}
-
-	endIssuance, err := hexutil.DecodeBig(endTotals.Issuance)
-	if err != nil {
-		log.Errorf("endTotals.Issuance is not a hex - %s", endTotals.Issuance)
-		return totals, err
-	}
-	startIssuance, err := hexutil.DecodeBig(startTotals.Issuance)
-	if err != nil {
-		log.Errorf("startTotals.Issuance is not a hex - %s", startTotals.Issuance)
-		return totals, err
-	}
+	switch unit {
+	case "block":
+		if from < s.londonBlock {
+			from = s.londonBlock
+		}
+		if from > to {
+			return Totals{}, invalidParamsErrorf("invalid block range %d -> %d", from, to)
+		}
+		if latestBlockNumber := s.latestBlock.getBlockNumber(); to > latestBlockNumber {
+			return Totals{}, notFoundErrorf("block %d is after the latest block %d", to, latestBlockNumber)
+		}
+		startBlock, endBlock = from, to
+	case "time":
+		if from >= to {
+			return Totals{}, invalidParamsErrorf("invalid time range %d -> %d", from, to)
+		}
 
-	endRewards, err := hexutil.DecodeBig(endTotals.Rewards)
-	if err != nil {
-		log.Errorf("endTotals.Rewards is not a hex - %s", endTotals.Rewards)
-		return totals, err
-	}
-	startRewards, err := hexutil.DecodeBig(startTotals.Rewards)
-	if err != nil {
-		log.Errorf("startTotals.Rewards is not a hex - %s", startTotals.Rewards)
-		return totals, err
+		var ok bool
+		startBlock, endBlock, ok = s.getBlockRangeTimeDelta(from, to)
+		if !ok {
+			totals := newZeroTotals()
+			totals.ID = fmt.Sprintf("%d:%d", from, to)
+			return totals, nil
+		}
+	default:
+		return Totals{}, invalidParamsErrorf("unit '%s' is not one of block or time", unit)
 	}
 
-	endTips, err := hexutil.DecodeBig(endTotals.Tips)
+	totals, err := s.getTotalsBlockDelta(startBlock-1, endBlock)
 	if err != nil {
-		log.Errorf("endTotals.Tips is not a hex - %s", endTotals.Tips)
 		return totals, err
 	}
-	startTips, err := hexutil.DecodeBig(startTotals.Tips)
+	totals.ID = fmt.Sprintf("%d:%d", from, to)
+
+	totals.BaseFeePercentiles, err = s.getBaseFeePercentilesBlockDelta(startBlock, endBlock)
 	if err != nil {
-		log.Errorf("startTotals.Tips is not a hex - %s", startTotals.Tips)
 		return totals, err
 	}
 
-	endBurned.Sub(endBurned, startBurned)
-	endIssuance.Sub(endIssuance, startIssuance)
-	endRewards.Sub(endRewards, startRewards)
-	endTips.Sub(endTips, startTips)
+	return totals, nil
+}
 
-	totals.ID = id
-	totals.Burned = hexutil.EncodeBig(endBurned)
-	totals.Duration = endBlockTime - startBlockTime
-	totals.Issuance = hexutil.EncodeBig(endIssuance)
-	totals.Rewards = hexutil.EncodeBig(endRewards)
-	totals.Tips = hexutil.EncodeBig(endTips)
+func (s *Stats) getTotalsBlockDelta(startBlockNumber uint64, endBlockNumber uint64) (Totals, error) {
+	id := fmt.Sprintf("%d:%d", startBlockNumber, endBlockNumber)
 
-	return totals, nil
+	if startBlockNumber > endBlockNumber {
+		return Totals{}, fmt.Errorf("endBlockNumber must be greater than startBlockNumber")
+	}
+
+	endTotals, err := s.getCumulativeTotals(endBlockNumber)
+	if err != nil {
+		return newZeroTotals(), err
+	}
+
+	startTotals, err := s.getCumulativeTotals(startBlockNumber)
+	if err != nil {
+		return newZeroTotals(), err
+	}
+
+	return Totals{
+		ID:          id,
+		BlobBurned:  hexutil.EncodeBig(endTotals.blobBurned.Sub(endTotals.blobBurned, startTotals.blobBurned)),
+		Burned:      hexutil.EncodeBig(endTotals.burned.Sub(endTotals.burned, startTotals.burned)),
+		BurnedUSD:   hexutil.EncodeBig(usdBig(endTotals.burnedUSD - startTotals.burnedUSD)),
+		Duration:    endTotals.timestamp - startTotals.timestamp,
+		Issuance:    hexutil.EncodeBig(endTotals.issuance.Sub(endTotals.issuance, startTotals.issuance)),
+		IssuanceUSD: hexutil.EncodeBig(usdBig(endTotals.issuanceUSD - startTotals.issuanceUSD)),
+		Rewards:     hexutil.EncodeBig(endTotals.rewards.Sub(endTotals.rewards, startTotals.rewards)),
+		Tips:        hexutil.EncodeBig(endTotals.tips.Sub(endTotals.tips, startTotals.tips)),
+		TipsUSD:     hexutil.EncodeBig(usdBig(endTotals.tipsUSD - startTotals.tipsUSD)),
+	}, nil
 }
 
 func (s *Stats) getBlockStats() func(c *Client, message jsonrpcMessage) (json.RawMessage, error) {
@@ -770,223 +791,261 @@ func (s *Stats) getBlockStats() func(c *Client, message jsonrpcMessage) (json.Ra
 		var params []interface{}
 		err = json.Unmarshal(b, &params)
 		if err != nil {
-			return nil, err
+			return nil, invalidParamsErrorf("invalid params: %v", err)
 		}
 
 		if len(params) == 0 {
-			return nil, fmt.Errorf("no parameters provided %s", message.Method)
+			return nil, invalidParamsErrorf("no parameters provided %s", message.Method)
 		}
 
-		var blockNumberHex string
+		blockNumber, err := s.parseRangeParam("block number", params[0], "block")
+		if err != nil {
+			return nil, err
+		}
 
-		blockNumberHex, ok := params[0].(string)
-		if !ok {
-			return nil, fmt.Errorf("starting block is not a string - %v", params[0])
+		page, err := s.getBlockStatsRange(blockNumber, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(page.Blocks) == 0 {
+			return nil, notFoundErrorf("block %d is not stored", blockNumber)
+		}
+
+		blockStatsJSON, err := json.Marshal(page.Blocks[0])
+		if err != nil {
+			log.Errorf("Error marshaling block stats: %v", err)
+		}
+
+		return json.RawMessage(blockStatsJSON), nil
+	}
+}
+
+func (s *Stats) getBlockStatsPage() func(c *Client, message jsonrpcMessage) (json.RawMessage, error) {
+	return func(c *Client, message jsonrpcMessage) (json.RawMessage, error) {
+		b, err := message.Params.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		var params []interface{}
+		err = json.Unmarshal(b, &params)
+		if err != nil {
+			return nil, invalidParamsErrorf("invalid params: %v", err)
 		}
 
-		blockNumber, err := hexutil.DecodeUint64(blockNumberHex)
+		if len(params) < 2 {
+			return nil, invalidParamsErrorf("from and to are required %s", message.Method)
+		}
+
+		from, err := s.parseRangeParam("from", params[0], "block")
 		if err != nil {
 			return nil, err
 		}
 
-		latestBlockNumber := s.latestBlock.getBlockNumber()
-		if blockNumber > latestBlockNumber {
+		to, err := s.parseRangeParam("to", params[1], "block")
+		if err != nil {
 			return nil, err
 		}
 
-		var blockStats sql.BlockStats
+		if from > to {
+			return nil, invalidParamsErrorf("from %d is after to %d", from, to)
+		}
 
-		s.statsByBlock.mu.Lock()
-		if blockStats, ok = s.statsByBlock.v[blockNumber]; !ok {
-			log.Printf("error fetching block stats for block #%d", blockNumber)
-			s.statsByBlock.mu.Unlock()
+		page, err := s.getBlockStatsRange(from, to)
+		if err != nil {
 			return nil, err
 		}
-		s.statsByBlock.mu.Unlock()
 
-		blockStatsJSON, err := json.Marshal(blockStats)
+		pageJSON, err := json.Marshal(page)
 		if err != nil {
-			log.Errorf("Error marshaling block stats: %vn", err)
+			log.Errorf("Error marshaling block stats: %v", err)
 		}
 
-		return json.RawMessage(blockStatsJSON), nil
+		return json.RawMessage(pageJSON), nil
 	}
 }
 
-func (s *Stats) getBaseFeeNext(blockNumber uint64) (string, error) {
-	s.statsByBlock.mu.Lock()
-	defer s.statsByBlock.mu.Unlock()
+// getBlockStatsRange returns the blocks fromBlock -> toBlock with their
+// percentiles, up to maxBlockStatsRange blocks at once, including the latest
+// ones not stored yet. The blocks after the page are returned by a request
+// starting at Next.
+func (s *Stats) getBlockStatsRange(fromBlock uint64, toBlock uint64) (BlockStatsPage, error) {
+	latestBlockNumber := s.latestBlock.getBlockNumber()
+	if fromBlock > latestBlockNumber {
+		return BlockStatsPage{}, notFoundErrorf("block %d is after the latest block %d", fromBlock, latestBlockNumber)
+	}
+	if toBlock > latestBlockNumber {
+		toBlock = latestBlockNumber
+	}
 
-	block := s.statsByBlock.v[blockNumber]
+	page := BlockStatsPage{
+		Blocks: []BlockStatsData{},
+	}
+	if toBlock-fromBlock >= maxBlockStatsRange {
+		toBlock = fromBlock + maxBlockStatsRange - 1
+		next := hexutil.Uint64(toBlock + 1)
+		page.Next = &next
+	}
 
-	baseFee, err := hexutil.DecodeBig(block.BaseFee)
+	storedBlockStats, err := s.db.GetBlockStatsRange(fromBlock, toBlock)
 	if err != nil {
-		baseFee = big.NewInt(0)
-		log.Errorf("block.BaseFee is not a hex - %s", block.BaseFee)
-		return "", err
+		log.Errorf("error getting blocks %d -> %d from database: %v", fromBlock, toBlock, err)
+		return BlockStatsPage{}, fmt.Errorf("error getting blocks %d -> %d", fromBlock, toBlock)
 	}
 
-	gasUsed, err := hexutil.DecodeBig(block.GasUsed)
+	storedPercentiles, err := s.db.GetBlockStatsPercentilesRange(fromBlock, toBlock)
 	if err != nil {
-		gasUsed = big.NewInt(0)
-		log.Errorf("block.GasUsed is not a hex - %s", block.GasUsed)
-		return "", err
+		log.Errorf("error getting percentiles of blocks %d -> %d from database: %v", fromBlock, toBlock, err)
+		return BlockStatsPage{}, fmt.Errorf("error getting percentiles of blocks %d -> %d", fromBlock, toBlock)
 	}
 
-	gasTarget, err := hexutil.DecodeBig(block.GasTarget)
-	if err != nil {
-		gasTarget = big.NewInt(0)
-		log.Errorf("block.GasTarget is not a hex - %s", block.GasTarget)
-		return "", err
+	blocks := map[uint64]sql.BlockStats{}
+	for _, blockStats := range storedBlockStats {
+		blocks[uint64(blockStats.Number)] = blockStats
 	}
 
-	baseFeeNext := big.NewInt(0)
-	baseFeeNext.Add(baseFeeNext, gasUsed)
-	baseFeeNext.Sub(baseFeeNext, gasTarget)
-	baseFeeNext.Mul(baseFeeNext, baseFee)
-	baseFeeNext.Quo(baseFeeNext, gasTarget)
-	baseFeeNext.Quo(baseFeeNext, big.NewInt(8))
-	baseFeeNext.Add(baseFeeNext, baseFee)
+	percentiles := map[uint][]sql.BlockStatsPercentiles{}
+	for _, p := range storedPercentiles {
+		percentiles[p.Number] = append(percentiles[p.Number], p)
+	}
 
-	return hexutil.EncodeBig(baseFeeNext), nil
-}
+	for blockNumber := fromBlock; blockNumber <= toBlock; blockNumber++ {
+		// blocks removed by a reorg may still be stored
+		if _, ok := s.blocks.getEntry(blockNumber); !ok {
+			continue
+		}
 
-func (s *Stats) updateTotals(blockNumber uint64) error {
-	s.totalsByBlock.mu.Lock()
-	defer s.totalsByBlock.mu.Unlock()
+		// the latest blocks are kept in memory before they are stored, their
+		// percentiles are only returned once stored
+		blockStats, ok := s.latestBlocks.getBlock(blockNumber)
+		if !ok {
+			blockStats, ok = blocks[blockNumber]
+		}
+		if !ok {
+			continue
+		}
 
-	//recalculate totals for previous 10 blocks in case blocks missed
-	for i := blockNumber - 10; i <= blockNumber; i++ {
-		totals := Totals{}
-		totalBurned := big.NewInt(0)
-		totalIssuance := big.NewInt(0)
-		totalRewards := big.NewInt(0)
-		totalTips := big.NewInt(0)
+		blockPercentiles, ok := percentiles[blockStats.Number]
+		if !ok {
+			blockPercentiles = []sql.BlockStatsPercentiles{}
+		}
 
-		s.statsByBlock.mu.Lock()
-		block := s.statsByBlock.v[i]
-		s.statsByBlock.mu.Unlock()
+		page.Blocks = append(page.Blocks, BlockStatsData{
+			Block:       blockStats,
+			Percentiles: blockPercentiles,
+		})
+	}
 
-		blockBurned, err := hexutil.DecodeBig(block.Burned)
-		if err != nil {
-			blockBurned = big.NewInt(0)
-			log.Errorf("block.Burned is not a hex - %s", block.Burned)
-		}
-		blockRewards, err := hexutil.DecodeBig(block.Rewards)
-		if err != nil {
-			blockRewards = big.NewInt(0)
-			log.Errorf("block.Reward is not a hex - %s", block.Rewards)
+	return page, nil
+}
+
+// parseRangeParam reads a block number or a timestamp given as a number or a
+// hex string, "latest" is the latest block or the time right after it.
+func (s *Stats) parseRangeParam(name string, param interface{}, unit string) (uint64, error) {
+	switch v := param.(type) {
+	case float64:
+		if v < 0 {
+			return 0, invalidParamsErrorf("%s is negative - %v", name, v)
 		}
-		blockTips, err := hexutil.DecodeBig(block.Tips)
-		if err != nil {
-			blockTips = big.NewInt(0)
-			log.Errorf("block.Tips is not a hex - %s", block.Tips)
+		return uint64(v), nil
+	case string:
+		if v != "latest" {
+			n, err := hexutil.DecodeUint64(v)
+			if err != nil {
+				return 0, invalidParamsErrorf("%s is invalid - %v", name, err)
+			}
+			return n, nil
 		}
 
-		prevTotals := s.totalsByBlock.v[i-1]
-		prevTotalBurned, err := hexutil.DecodeBig(prevTotals.Burned)
-		if err != nil {
-			prevTotalBurned = big.NewInt(0)
-			log.Errorf("prevTotals.Burned is not a hex - %s", prevTotals.Burned)
-		}
-		prevTotalRewards, err := hexutil.DecodeBig(prevTotals.Rewards)
-		if err != nil {
-			prevTotalRewards = big.NewInt(0)
-			log.Errorf("prevTotals.Rewards is not a hex - %s", prevTotals.Rewards)
+		blockNumber := s.latestBlock.getBlockNumber()
+		if unit != "time" {
+			return blockNumber, nil
 		}
-		prevTotalTips, err := hexutil.DecodeBig(prevTotals.Tips)
+
+		blockTime, err := s.getBlockTimestamp(blockNumber)
 		if err != nil {
-			prevTotalTips = big.NewInt(0)
-			log.Errorf("prevTotals.Tips (%d) is not a hex - %s", i-1, prevTotals.Tips)
+			return 0, notReadyErrorf("latest block %d is not processed yet", blockNumber)
 		}
-
-		totalBurned.Add(prevTotalBurned, blockBurned)
-		totalRewards.Add(prevTotalRewards, blockRewards)
-		totalIssuance.Sub(totalRewards, totalBurned)
-		totalTips.Add(prevTotalTips, blockTips)
-
-		totals.Burned = hexutil.EncodeBig(totalBurned)
-		totals.Duration = block.Timestamp - s.londonTimestamp
-		totals.Issuance = hexutil.EncodeBig(totalIssuance)
-		totals.Rewards = hexutil.EncodeBig(totalRewards)
-		totals.Tips = hexutil.EncodeBig(totalTips)
-
-		s.totalsByBlock.v[i] = totals
-
-		//log.Infof("block %d totals: %s burned, %s issuance, %s rewards, and %s tips", i, totalBurned.String(), totalIssuance.String(), totalRewards.String(), totalTips.String())
+		return blockTime + 1, nil
 	}
 
-	return nil
+	return 0, invalidParamsErrorf("%s is not a number or a hex string - %v", name, param)
 }
 
-func (s *Stats) updateAllTotals(blockNumber uint64) error {
-	start := time.Now()
-	var totals Totals
-
-	log.Infof("Updating totals for every block from %d to %d (%d blocks)", s.londonBlock, blockNumber, blockNumber-s.londonBlock)
-
-	totalBurned := big.NewInt(0)
-	totalIssuance := big.NewInt(0)
-	totalRewards := big.NewInt(0)
-	totalTips := big.NewInt(0)
+// getStoredBlockStats returns one of the latest blocks from memory, and the
+// other blocks from the database.
+func (s *Stats) getStoredBlockStats(blockNumber uint64) (sql.BlockStats, bool) {
+	if _, ok := s.blocks.getEntry(blockNumber); !ok {
+		return sql.BlockStats{}, false
+	}
 
-	s.statsByBlock.mu.Lock()
-	defer s.statsByBlock.mu.Unlock()
+	if blockStats, ok := s.latestBlocks.getBlock(blockNumber); ok {
+		return blockStats, true
+	}
 
-	totals.Burned = hexutil.EncodeBig(totalBurned)
-	totals.Duration = 0
-	totals.Issuance = hexutil.EncodeBig(totalIssuance)
-	totals.Rewards = hexutil.EncodeBig(totalRewards)
-	totals.Tips = hexutil.EncodeBig(totalTips)
+	blockStats, ok, err := s.db.GetBlockStats(blockNumber)
+	if err != nil {
+		log.Errorf("error getting block %d from database: %v", blockNumber, err)
+		return sql.BlockStats{}, false
+	}
 
-	// set last berlin block totals to 0
-	s.totalsByBlock.mu.Lock()
-	s.totalsByBlock.v[s.lastBerlinBlock] = totals
-	s.totalsByBlock.mu.Unlock()
+	return blockStats, ok
+}
 
-	for i := s.londonBlock; i <= blockNumber; i++ {
-		block := s.statsByBlock.v[i]
+func (s *Stats) getBaseFeeNext(blockNumber uint64) (string, error) {
+	block, _ := s.blocks.getEntry(blockNumber)
 
-		burned, err := hexutil.DecodeBig(block.Burned)
-		if err != nil {
-			return fmt.Errorf("block %d: block.Burned was not a hex - %s", i, block.Burned)
-		}
-		totalBurned.Add(totalBurned, burned)
+	baseFee := new(big.Int).SetUint64(block.baseFee)
+	gasUsed := new(big.Int).SetUint64(block.gasUsed)
+	gasTarget := new(big.Int).SetUint64(block.gasTarget)
 
-		rewards, err := hexutil.DecodeBig(block.Rewards)
-		if err != nil {
-			return fmt.Errorf("block %d: block.Rewards was not a hex - %s", i, block.Rewards)
-		}
-		totalRewards.Add(totalRewards, rewards)
+	baseFeeNext := big.NewInt(0)
+	baseFeeNext.Add(baseFeeNext, gasUsed)
+	baseFeeNext.Sub(baseFeeNext, gasTarget)
+	baseFeeNext.Mul(baseFeeNext, baseFee)
+	baseFeeNext.Quo(baseFeeNext, gasTarget)
+	baseFeeNext.Quo(baseFeeNext, big.NewInt(8))
+	baseFeeNext.Add(baseFeeNext, baseFee)
 
-		tips, err := hexutil.DecodeBig(block.Tips)
-		if err != nil {
-			return fmt.Errorf("block %d: block.Burned was not a hex - %s", i, block.Tips)
-		}
-		totalTips.Add(totalTips, tips)
-		totalIssuance.Sub(totalRewards, totalBurned)
+	return hexutil.EncodeBig(baseFeeNext), nil
+}
 
-		totals.Burned = hexutil.EncodeBig(totalBurned)
-		totals.Duration = block.Timestamp - s.londonTimestamp
-		totals.Issuance = hexutil.EncodeBig(totalIssuance)
-		totals.Rewards = hexutil.EncodeBig(totalRewards)
-		totals.Tips = hexutil.EncodeBig(totalTips)
+// getPeriodTotals returns the totals and base fee percentiles of the period
+// of granularity g beginning at startPeriod.
+func (s *Stats) getPeriodTotals(g Granularity, startPeriod time.Time) (Totals, error) {
+	return s.getPeriodTotalsUntil(g, startPeriod, uint64(g.next(startPeriod).Unix()))
+}
 
-		s.totalsByBlock.mu.Lock()
-		s.totalsByBlock.v[uint64(block.Number)] = totals
-		s.totalsByBlock.mu.Unlock()
+// getPeriodTotalsUntil returns the totals and base fee percentiles of the
+// blocks of the period of granularity g beginning at startPeriod that were
+// produced before endTime.
+func (s *Stats) getPeriodTotalsUntil(g Granularity, startPeriod time.Time, endTime uint64) (Totals, error) {
+	startTime := uint64(startPeriod.Unix())
+	endPeriod := uint64(g.next(startPeriod).Unix())
+	if endTime > endPeriod {
+		endTime = endPeriod
+	}
 
-		if block.Number%5000 == 0 {
-			log.Infof("block %d totals: %s burned, %s issuance, %s rewards, and %s tips", block.Number, totalBurned.String(), totalIssuance.String(), totalRewards.String(), totalTips.String())
-		}
+	totals, err := s.getTotalsTimeDelta(startTime, endTime)
+	if err != nil {
+		log.Errorf("getTotalsTimeDelta(%d, %d): %v", startTime, endTime, err)
+		return totals, err
 	}
+	totals.ID = fmt.Sprintf("%d:%d", startTime, endPeriod)
 
-	duration := time.Since(start) / time.Millisecond
-	log.Infof("block %d totals: %s burned, %s issuance, %s rewards, and %s tips (ptime: %dms)", blockNumber, totalBurned.String(), totalIssuance.String(), totalRewards.String(), totalTips.String(), duration)
+	baseFeePercentiles, err := s.getBaseFeePercentilesTimeDelta(startTime, endTime)
+	if err != nil {
+		log.Errorf("getPercentilesTimeDelta(%d,%d): %v", startTime, endTime, err)
+		return totals, err
+	}
+	totals.BaseFeePercentiles = baseFeePercentiles
 
-	return nil
+	return totals, nil
 }
 
+// updateAggregateTotals updates the period of every granularity containing
+// blockNumber.
 func (s *Stats) updateAggregateTotals(blockNumber uint64) error {
 	epoch, err := s.getBlockTimestamp(blockNumber)
 	if err != nil {
@@ -994,61 +1053,86 @@ func (s *Stats) updateAggregateTotals(blockNumber uint64) error {
 		return err
 	}
 
-	//update monthly totals
-	startPeriod := beginningOfMonthTimeFromEpoch(epoch)
-	endPeriod := startPeriod.AddDate(0, 1, 0)
-	totals, err := s.getTotalsTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
-	if err != nil {
-		log.Errorf("getTotalsTimeDelta(%d, %d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
-		return err
-	}
-	baseFeePercentiles, err := s.getBaseFeePercentilesTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
-	if err != nil {
-		log.Errorf("getPercentilesTimeDelta(%d,%d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
-		return err
+	var periodTotals []sql.PeriodTotals
+
+	for _, g := range granularities {
+		totals, err := s.getPeriodTotals(g, g.startFromEpoch(epoch))
+		if err != nil {
+			return err
+		}
+		s.aggregates[g.Name].addPeriod(totals)
+		periodTotals = append(periodTotals, toSQLPeriodTotals(g.Name, totals))
 	}
-	totals.BaseFeePercentiles = baseFeePercentiles
-	s.totalsPerMonth.addPeriod(totals)
 
-	//update daily totals
-	startPeriod = beginningOfDayTimeFromEpoch(epoch)
-	endPeriod = startPeriod.AddDate(0, 0, 1)
-	totals, err = s.getTotalsTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
+	return s.storePeriodTotals(blockNumber, blockNumber, periodTotals)
+}
+
+// refreshAggregateTotals recomputes the period of every granularity from the
+// one containing blockNumber up to the latest block, dropping periods that no
+// longer have any blocks.
+func (s *Stats) refreshAggregateTotals(blockNumber uint64) error {
+	return s.refreshAggregateTotalsRange(blockNumber, s.latestBlock.getBlockNumber())
+}
+
+// refreshAggregateTotalsRange recomputes the period of every granularity from
+// the one containing blockNumber up to the one containing endBlockNumber, from
+// the blocks up to endBlockNumber. The periods after them are only dropped
+// when endBlockNumber is the latest block.
+func (s *Stats) refreshAggregateTotalsRange(blockNumber uint64, endBlockNumber uint64) error {
+	startEpoch, err := s.getBlockTimestamp(blockNumber)
 	if err != nil {
-		log.Errorf("getTotalsTimeDelta(%d, %d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
+		log.Errorf("getBlockTimestamp(%d): %v", blockNumber, err)
 		return err
 	}
-	baseFeePercentiles, err = s.getBaseFeePercentilesTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
+
+	endEpoch, err := s.getBlockTimestamp(endBlockNumber)
 	if err != nil {
-		log.Errorf("getPercentilesTimeDelta(%d,%d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
+		log.Errorf("getBlockTimestamp(%d): %v", endBlockNumber, err)
 		return err
 	}
-	totals.BaseFeePercentiles = baseFeePercentiles
-	s.totalsPerDay.addPeriod(totals)
 
-	//update hourly totals
-	startPeriod = beginningOfHourTimeFromEpoch(epoch)
-	endPeriod = startPeriod.Add(1 * time.Hour)
-	totals, err = s.getTotalsTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
-	if err != nil {
-		log.Errorf("getTotalsTimeDelta(%d, %d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
-		return err
+	latest := endBlockNumber >= s.latestBlock.getBlockNumber()
+
+	s.zonedAggregates.reset()
+
+	var periodTotals []sql.PeriodTotals
+
+	for _, g := range granularities {
+		totalsList := s.aggregates[g.Name]
+		if latest {
+			totalsList.removePeriodsAfter(endEpoch)
+		}
+
+		startPeriod := g.startFromEpoch(startEpoch)
+		for uint64(startPeriod.Unix()) <= endEpoch {
+			totals, err := s.getPeriodTotalsUntil(g, startPeriod, endEpoch+1)
+			if err != nil {
+				return err
+			}
+			totalsList.replacePeriod(totals)
+			periodTotals = append(periodTotals, toSQLPeriodTotals(g.Name, totals))
+
+			startPeriod = g.next(startPeriod)
+		}
 	}
-	baseFeePercentiles, err = s.getBaseFeePercentilesTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
-	if err != nil {
-		log.Errorf("getPercentilesTimeDelta(%d,%d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
-		return err
+
+	if latest && !s.readOnly {
+		err = s.db.DeletePeriodTotalsAfter(endEpoch)
+		if err != nil {
+			return fmt.Errorf("error deleting periods after %d: %v", endEpoch, err)
+		}
 	}
-	totals.BaseFeePercentiles = baseFeePercentiles
-	s.totalsPerHour.addPeriod(totals)
 
-	return nil
+	return s.storePeriodTotals(blockNumber, endBlockNumber, periodTotals)
 }
 
+// updateAllAggregateTotals computes the periods of every granularity from
+// london up to blockNumber.
 func (s *Stats) updateAllAggregateTotals(blockNumber uint64) error {
 	start := time.Now()
 
-	log.Infof("Updating aggregate totals per month/hour/day")
+	granularityNames := strings.Join(getGranularityNames(), "/")
+	log.Infof("Updating aggregate totals per %s", granularityNames)
 
 	endEpoch, err := s.getBlockTimestamp(blockNumber)
 	if err != nil {
@@ -1057,91 +1141,74 @@ func (s *Stats) updateAllAggregateTotals(blockNumber uint64) error {
 	}
 	endTime := time.Unix(int64(endEpoch), 0)
 
-	startPeriod := beginningOfHourTimeFromEpoch(s.londonTimestamp)
-	endPeriod := startPeriod.Add(1 * time.Hour)
-
-	for startPeriod.Before(endTime) {
-		totals, err := s.getTotalsTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
-		if err != nil {
-			log.Errorf("getTotalsTimeDelta(%d, %d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
-			return err
-		}
-		baseFeePercentiles, err := s.getBaseFeePercentilesTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
-		if err != nil {
-			log.Errorf("getPercentilesTimeDelta(%d,%d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
-			return err
-		}
-		totals.BaseFeePercentiles = baseFeePercentiles
-		s.totalsPerHour.addPeriod(totals)
+	var periodTotals []sql.PeriodTotals
 
-		startPeriod = endPeriod
-		endPeriod = endPeriod.Add(1 * time.Hour)
-	}
+	for _, g := range granularities {
+		startPeriod := g.startFromEpoch(s.londonTimestamp)
 
-	startPeriod = beginningOfDayTimeFromEpoch(s.londonTimestamp)
-	endPeriod = startPeriod.AddDate(0, 0, 1)
+		for startPeriod.Before(endTime) {
+			totals, err := s.getPeriodTotals(g, startPeriod)
+			if err != nil {
+				return err
+			}
+			s.aggregates[g.Name].addPeriod(totals)
+			periodTotals = append(periodTotals, toSQLPeriodTotals(g.Name, totals))
 
-	for startPeriod.Before(endTime) {
-		totals, err := s.getTotalsTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
-		if err != nil {
-			log.Errorf("getTotalsTimeDelta(%d, %d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
-			return err
-		}
-		baseFeePercentiles, err := s.getBaseFeePercentilesTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
-		if err != nil {
-			log.Errorf("getPercentilesTimeDelta(%d,%d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
-			return err
+			startPeriod = g.next(startPeriod)
 		}
-		totals.BaseFeePercentiles = baseFeePercentiles
-		s.totalsPerDay.addPeriod(totals)
+	}
 
-		startPeriod = endPeriod
-		endPeriod = endPeriod.AddDate(0, 0, 1)
+	err = s.storePeriodTotals(s.londonBlock, blockNumber, periodTotals)
+	if err != nil {
+		return err
 	}
 
-	startPeriod = beginningOfMonthTimeFromEpoch(s.londonTimestamp)
-	endPeriod = startPeriod.AddDate(0, 1, 0)
+	duration := time.Since(start) / time.Millisecond
+	log.Infof("Finished calculating %s aggregations (ptime: %dms)", granularityNames, duration)
+
+	return nil
+}
+
+func (s *Stats) processBlock(blockNumber uint64, blockRepeated bool) (sql.BlockStats, *ReorgData, error) {
+	// the totals include the epochs fetched since the last head
+	s.refreshConsensusIssuance()
 
-	for startPeriod.Before(endTime) {
-		totals, err := s.getTotalsTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
+	// a repeated block means the node switched chains at or below it, so
+	// roll back to the common ancestor and replay the canonical blocks
+	if blockRepeated {
+		reorg, err := s.processReorg(blockNumber, blockNumber)
 		if err != nil {
-			log.Errorf("getTotalsTimeDelta(%d, %d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
-			return err
+			return sql.BlockStats{}, nil, err
 		}
-		baseFeePercentiles, err := s.getBaseFeePercentilesTimeDelta(uint64(startPeriod.Unix()), uint64(endPeriod.Unix()))
-		if err != nil {
-			log.Errorf("getPercentilesTimeDelta(%d,%d): %v", startPeriod.Unix(), endPeriod.Unix(), err)
-			return err
+
+		if reorg == nil {
+			log.Infof("block %d unchanged", blockNumber)
+			blockStats, _ := s.getStoredBlockStats(blockNumber)
+			return blockStats, nil, nil
 		}
-		totals.BaseFeePercentiles = baseFeePercentiles
-		s.totalsPerMonth.addPeriod(totals)
 
-		startPeriod = endPeriod
-		endPeriod = endPeriod.AddDate(0, 1, 0)
+		return s.getReorgHead(reorg), reorg, nil
 	}
 
-	duration := time.Since(start) / time.Millisecond
-	log.Infof("Finished calculating month/day/hour aggregations (ptime: %dms)", duration)
-
-	return nil
-}
-
-func (s *Stats) processBlock(blockNumber uint64, blockRepeated bool) (sql.BlockStats, error) {
 	// fetch block, process stats, and update block stats maps
 	blockStats, blockStatsPercentiles, err := s.updateBlockStats(blockNumber, blockRepeated)
 	if err != nil {
-		log.Errorf("Error getting block stats for block %d: %v", blockNumber, err)
+		return sql.BlockStats{}, nil, fmt.Errorf("error getting block stats for block %d: %v", blockNumber, err)
 	}
 
-	if blockRepeated {
-		s.statsByBlock.mu.Lock()
-		existingBlockStats := s.statsByBlock.v[blockNumber]
-		s.statsByBlock.mu.Unlock()
-		//if blockStats and existingBlockStats are same, return empty stats
-		if reflect.DeepEqual(blockStats, existingBlockStats) {
-			log.Infof("block %d unchanged", blockNumber)
-			return sql.BlockStats{}, nil
+	// the stored parent must be the one this block builds on, otherwise the
+	// stored blocks below it were orphaned
+	if blockNumber > s.londonBlock && s.isOrphaned(blockNumber-1, blockStats.ParentHash) {
+		reorg, err := s.processReorg(blockNumber-1, blockNumber)
+		if err != nil {
+			return sql.BlockStats{}, nil, err
+		}
+
+		if reorg == nil {
+			return sql.BlockStats{}, nil, fmt.Errorf("parent of block %d is orphaned but no stored block changed", blockNumber)
 		}
+
+		return s.getReorgHead(reorg), reorg, nil
 	}
 
 	// check for and update missing blocks
@@ -1150,12 +1217,6 @@ func (s *Stats) processBlock(blockNumber uint64, blockRepeated bool) (sql.BlockS
 		log.Errorf("error during initGetMissingBlocks: %v", err)
 	}
 
-	// calculate and update totals for block
-	err = s.updateTotals(blockNumber)
-	if err != nil {
-		log.Errorf("Error updating totals for block %d: %v", blockNumber, err)
-	}
-
 	// add block to latestBlocks array
 	s.latestBlocks.addBlock(blockStats, false)
 
@@ -1163,9 +1224,25 @@ func (s *Stats) processBlock(blockNumber uint64, blockRepeated bool) (sql.BlockS
 	s.latestBlock.updateBlockNumber(blockNumber)
 
 	// add to database
-	s.db.AddBlock(blockStats, blockStatsPercentiles)
+	err = s.db.AddBlock(blockStats, blockStatsPercentiles)
+	s.health.setDBResult(err)
+	if err != nil {
+		log.Errorf("error adding block %d to database: %v", blockNumber, err)
+	}
+
+	return blockStats, nil, nil
+}
 
-	return blockStats, nil
+// getReorgHead returns the latest block after a reorg, the last replayed one
+// or the stored latest block when none was replayed.
+func (s *Stats) getReorgHead(reorg *ReorgData) sql.BlockStats {
+	if len(reorg.Blocks) > 0 {
+		return reorg.Blocks[len(reorg.Blocks)-1]
+	}
+
+	blockStats, _ := s.getStoredBlockStats(s.latestBlock.getBlockNumber())
+
+	return blockStats
 }
 
 func (s *Stats) updateBlockStats(blockNumber uint64, updateCache bool) (sql.BlockStats, []sql.BlockStatsPercentiles, error) {
@@ -1232,6 +1309,11 @@ func (s *Stats) updateBlockStats(blockNumber uint64, updateCache bool) (sql.Bloc
 
 	blockReward := s.getBaseReward(blockNumber)
 
+	// proof of stake blocks have no difficulty, no uncles and no block reward
+	if header.Difficulty != nil && header.Difficulty.Sign() == 0 {
+		blockReward = *big.NewInt(0)
+	}
+
 	for n, uncleHash := range block.Uncles {
 		var raw json.RawMessage
 		raw, err := s.rpcClient.CallContext(
@@ -1277,10 +1359,34 @@ func (s *Stats) updateBlockStats(blockNumber uint64, updateCache bool) (sql.Bloc
 	var allPriorityFeePerGasMwei []uint64
 
 	// Fetch all transaction receipts to calculate burned, and tips.
-	batchPriorityFee, batchBurned, batchTips, type2count := s.transactionReceiptWorker.QueueJob(block.Transactions, blockNumber, baseFee, updateCache)
-	allPriorityFeePerGasMwei = append(batchPriorityFee[:], allPriorityFeePerGasMwei[:]...)
-	blockBurned.Add(blockBurned, batchBurned)
-	blockTips.Add(blockTips, batchTips)
+	receiptTotals := s.transactionReceiptWorker.QueueJob(block.Transactions, blockNumber, baseFee, updateCache)
+	allPriorityFeePerGasMwei = append(receiptTotals.PriorityFeePerGasMwei[:], allPriorityFeePerGasMwei[:]...)
+	blockBurned.Add(blockBurned, receiptTotals.Burned)
+	blockTips.Add(blockTips, receiptTotals.Tips)
+	type2count := receiptTotals.Type2Count
+	type3count := receiptTotals.Type3Count
+
+	// blocks since cancun (EIP-4844) carry blob gas, which burns on its own
+	blobGasUsed := big.NewInt(0)
+	if block.BlobGasUsed != "" {
+		blobGasUsed, err = hexutil.DecodeBig(block.BlobGasUsed)
+		if err != nil {
+			return blockStats, blockStatsPercentiles, fmt.Errorf("error decode BlobGasUsed (%s): %v", block.BlobGasUsed, err)
+		}
+	}
+
+	// the receipts carry the blob base fee, blocks without blob transactions
+	// derive it from the excess blob gas instead
+	blobBaseFee := receiptTotals.BlobGasPrice
+	if type3count.Sign() == 0 && block.ExcessBlobGas != "" {
+		excessBlobGas, err := hexutil.DecodeBig(block.ExcessBlobGas)
+		if err != nil {
+			return blockStats, blockStatsPercentiles, fmt.Errorf("error decode ExcessBlobGas (%s): %v", block.ExcessBlobGas, err)
+		}
+		blobBaseFee = s.getBlobBaseFee(excessBlobGas, header.Time)
+	}
+
+	blobBurned := receiptTotals.BlobBurned
 
 	// sort slices that will be used for percentile calculations later
 	sort.Slice(allPriorityFeePerGasMwei, func(i, j int) bool { return allPriorityFeePerGasMwei[i] < allPriorityFeePerGasMwei[j] })
@@ -1304,19 +1410,24 @@ func (s *Stats) updateBlockStats(blockNumber uint64, updateCache bool) (sql.Bloc
 
 	blockStats.Number = uint(blockNumber)
 	blockStats.Timestamp = header.Time
-	blockStats.BaseFee = hexutil.EncodeBig(baseFee)
-	blockStats.Burned = hexutil.EncodeBig(blockBurned)
-	blockStats.GasTarget = hexutil.EncodeBig(gasTarget)
-	blockStats.GasUsed = hexutil.EncodeBig(gasUsed)
-	blockStats.PriorityFee = hexutil.EncodeBig(priorityFee)
-	blockStats.Rewards = hexutil.EncodeBig(&blockReward)
-	blockStats.Tips = hexutil.EncodeBig(blockTips)
-	blockStats.Transactions = hexutil.EncodeBig(transactionCount)
-	blockStats.Type2Transactions = hexutil.EncodeBig(type2count)
-
-	s.statsByBlock.mu.Lock()
-	s.statsByBlock.v[blockNumber] = blockStats
-	s.statsByBlock.mu.Unlock()
+	blockStats.Hash = block.Hash
+	blockStats.ParentHash = block.ParentHash
+	blockStats.BaseFee = sql.NewBig(baseFee)
+	blockStats.BlobBaseFee = sql.NewBig(blobBaseFee)
+	blockStats.BlobBurned = sql.NewBig(blobBurned)
+	blockStats.BlobGasUsed = sql.Uint64(blobGasUsed.Uint64())
+	blockStats.Burned = sql.NewBig(blockBurned)
+	blockStats.GasTarget = sql.Uint64(gasTarget.Uint64())
+	blockStats.GasUsed = sql.Uint64(gasUsed.Uint64())
+	blockStats.PriorityFee = sql.NewBig(priorityFee)
+	blockStats.Rewards = sql.NewBig(&blockReward)
+	blockStats.Tips = sql.NewBig(blockTips)
+	blockStats.Transactions = sql.Uint64(transactionCount.Uint64())
+	blockStats.Type2Transactions = sql.Uint64(type2count.Uint64())
+	blockStats.Type3Transactions = sql.Uint64(type3count.Uint64())
+	blockStats.USDPrice = s.getUSDPrice(header.Time)
+
+	s.blocks.addBlocks(blockStats)
 
 	// convert stats practical units when logging
 	gWEI := big.NewInt(1_000_000_000)
@@ -1326,13 +1437,58 @@ func (s *Stats) updateBlockStats(blockNumber uint64, updateCache bool) (sql.Bloc
 	blockReward.Div(&blockReward, mETH)
 	blockTips.Div(blockTips, mETH)
 	blockBurned.Div(blockBurned, mETH)
+	blobBurned = new(big.Int).Div(blobBurned, mETH)
 
 	duration := time.Since(start) / time.Millisecond
-	log.Printf("block: %d, blockHex: %s, timestamp: %d, gas_target: %s, gas_used: %s, rewards: %s mETH, tips: %s mETH, baseFee: %s GWEI, burned: %s mETH, transactions: %s, type2: %s, ptime: %dms", blockNumber, blockNumberHex, header.Time, gasTarget.String(), gasUsed.String(), blockReward.String(), blockTips.String(), baseFee.String(), blockBurned.String(), transactionCount.String(), type2count.String(), duration)
+	observeSince(metrics.blockProcessing, start)
+	log.Printf("block: %d, blockHex: %s, timestamp: %d, gas_target: %s, gas_used: %s, rewards: %s mETH, tips: %s mETH, baseFee: %s GWEI, burned: %s mETH, blob_burned: %s mETH, transactions: %s, type2: %s, type3: %s, ptime: %dms", blockNumber, blockNumberHex, header.Time, gasTarget.String(), gasUsed.String(), blockReward.String(), blockTips.String(), baseFee.String(), blockBurned.String(), blobBurned.String(), transactionCount.String(), type2count.String(), type3count.String(), duration)
 
 	return blockStats, blockStatsPercentiles, nil
 }
 
+// decodeSignedBig decodes a hex number that can be negative, like the
+// issuance once more ether is burned than issued.
+func decodeSignedBig(input string) (*big.Int, error) {
+	if strings.HasPrefix(input, "-") {
+		v, err := hexutil.DecodeBig(input[1:])
+		if err != nil {
+			return nil, err
+		}
+		return v.Neg(v), nil
+	}
+
+	return hexutil.DecodeBig(input)
+}
+
+// getPercentileCounts returns the percentile of the values counted by value,
+// the same as getPercentileSortedUint64 of the sorted values.
+func getPercentileCounts(counts map[uint64]int, perc int) uint64 {
+	values := make([]uint64, 0, len(counts))
+	total := 0
+	for value, count := range counts {
+		values = append(values, value)
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	rank := int(math.Ceil(float64(total) * float64(perc) / 100))
+	if rank == 0 {
+		rank = 1
+	}
+
+	for _, value := range values {
+		rank -= counts[value]
+		if rank <= 0 {
+			return value
+		}
+	}
+
+	return values[len(values)-1]
+}
+
 func getPercentileSortedUint64(values []uint64, perc int) uint64 {
 	if len(values) == 0 {
 		return 0
@@ -1351,22 +1507,31 @@ func getPercentileSortedUint64(values []uint64, perc int) uint64 {
 }
 
 func (s *Stats) getBaseReward(blockNum uint64) big.Int {
-	baseReward := big.NewInt(0)
-	if blockNum >= s.constantinopleBlock {
-		constantinopleReward := big.NewInt(2000000000000000000)
-		baseReward.Add(baseReward, constantinopleReward)
-		return *baseReward
-	}
+	return *s.network.GetBlockReward(blockNum)
+}
+
+// getBlobBaseFee derives the blob base fee from the excess blob gas of a
+// block, as defined in EIP-4844, with the update fraction of the blob schedule
+// of the network.
+func (s *Stats) getBlobBaseFee(excessBlobGas *big.Int, timestamp uint64) *big.Int {
+	updateFraction := new(big.Int).SetUint64(s.network.GetBlobUpdateFraction(timestamp))
+
+	return fakeExponential(big.NewInt(1), excessBlobGas, updateFraction)
+}
+
+// fakeExponential approximates factor * e ** (numerator / denominator) using
+// integer math, as defined in EIP-4844.
+func fakeExponential(factor *big.Int, numerator *big.Int, denominator *big.Int) *big.Int {
+	output := big.NewInt(0)
+	numeratorAccum := new(big.Int).Mul(factor, denominator)
 
-	if blockNum >= s.byzantiumBlock {
-		byzantiumReward := big.NewInt(3000000000000000000)
-		baseReward.Add(baseReward, byzantiumReward)
-		return *baseReward
+	for i := int64(1); numeratorAccum.Sign() > 0; i++ {
+		output.Add(output, numeratorAccum)
+		numeratorAccum.Mul(numeratorAccum, numerator)
+		numeratorAccum.Div(numeratorAccum, new(big.Int).Mul(denominator, big.NewInt(i)))
 	}
 
-	genesisReward := big.NewInt(5000000000000000000)
-	baseReward.Add(baseReward, genesisReward)
-	return *baseReward
+	return output.Div(output, denominator)
 }
 
 func min(x, y int) int {
@@ -1375,28 +1540,3 @@ func min(x, y int) int {
 	}
 	return y
 }
-
-func beginningOfMonthTimeFromEpoch(epoch uint64) time.Time {
-	t := time.Unix(int64(epoch), 0)
-	year, month, _ := t.UTC().Date()
-	location, _ := time.LoadLocation("UTC")
-	beginMonthTime := time.Date(year, month, 1, 0, 0, 0, 0, location)
-	return beginMonthTime
-}
-
-func beginningOfDayTimeFromEpoch(epoch uint64) time.Time {
-	t := time.Unix(int64(epoch), 0)
-	year, month, day := t.UTC().Date()
-	location, _ := time.LoadLocation("UTC")
-	beginDayTime := time.Date(year, month, day, 0, 0, 0, 0, location)
-	return beginDayTime
-}
-
-func beginningOfHourTimeFromEpoch(epoch uint64) time.Time {
-	t := time.Unix(int64(epoch), 0)
-	year, month, day := t.UTC().Date()
-	hour, _, _ := t.UTC().Clock()
-	location, _ := time.LoadLocation("UTC")
-	beginHourTime := time.Date(year, month, day, hour, 0, 0, 0, location)
-	return beginHourTime
-}
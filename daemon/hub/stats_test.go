@@ -0,0 +1,248 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/network"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+// fakeTimestamp returns the timestamp of blockNumber served by fakeNode.
+func fakeTimestamp(blockNumber uint64) uint64 {
+	return 1_000_000 + blockNumber*12
+}
+
+// checkTotals checks the sums of totals are the ones of the blocks from -> to
+// served by fakeNode with transactions.
+func checkTotals(t *testing.T, totals Totals, from uint64, to uint64) {
+	t.Helper()
+
+	burned := big.NewInt(0)
+	tips := big.NewInt(0)
+	rewards := big.NewInt(0)
+	blockReward, _ := new(big.Int).SetString(testBlockReward, 10)
+	for i := from; i <= to; i++ {
+		gasUsed := new(big.Int).SetUint64(fakeGasUsed(i))
+		burned.Add(burned, new(big.Int).Mul(gasUsed, big.NewInt(fakeBaseFee)))
+		tips.Add(tips, new(big.Int).Mul(gasUsed, big.NewInt(fakeTip)))
+		rewards.Add(rewards, blockReward)
+	}
+	issuance := new(big.Int).Sub(rewards, burned)
+
+	for _, sum := range []struct {
+		name string
+		have string
+		want *big.Int
+	}{
+		{"burned", totals.Burned, burned},
+		{"tips", totals.Tips, tips},
+		{"rewards", totals.Rewards, rewards},
+		{"issuance", totals.Issuance, issuance},
+		{"blob burned", totals.BlobBurned, big.NewInt(0)},
+	} {
+		if sum.have != hexutil.EncodeBig(sum.want) {
+			t.Errorf("%s of %d -> %d is %s, want %s", sum.name, from, to, sum.have, hexutil.EncodeBig(sum.want))
+		}
+	}
+
+	if totals.Duration != fakeTimestamp(to)-fakeTimestamp(from-1) {
+		t.Errorf("duration of %d -> %d is %d, want %d", from, to, totals.Duration, fakeTimestamp(to)-fakeTimestamp(from-1))
+	}
+	if totals.BaseFeePercentiles.Median != fakeBaseFee/1_000_000_000 {
+		t.Errorf("median base fee of %d -> %d is %d gwei, want %d", from, to, totals.BaseFeePercentiles.Median, fakeBaseFee/1_000_000_000)
+	}
+}
+
+func TestGetTotalsRange(t *testing.T) {
+	node := &fakeNode{transactions: true}
+	node.setChain("a", testLondonBlock-1, 120)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 120)
+
+	blockRanges := []struct {
+		from uint64
+		to   uint64
+	}{
+		// the totals of 105 -> 110 are the ones up to 110 minus the ones up
+		// to 104
+		{105, 110},
+		{110, 110},
+		{101, 120},
+	}
+	for _, r := range blockRanges {
+		totals, err := s.getTotalsRange(r.from, r.to, "block")
+		if err != nil {
+			t.Fatalf("getTotalsRange(%d, %d): %v", r.from, r.to, err)
+		}
+		checkTotals(t, totals, r.from, r.to)
+		if id := fmt.Sprintf("%d:%d", r.from, r.to); totals.ID != id {
+			t.Errorf("id is %s, want %s", totals.ID, id)
+		}
+	}
+
+	// a time range holds the blocks produced in [from, to)
+	timeRanges := []struct {
+		from      uint64
+		to        uint64
+		fromBlock uint64
+		toBlock   uint64
+	}{
+		{fakeTimestamp(105), fakeTimestamp(111), 105, 110},
+		{fakeTimestamp(105) + 1, fakeTimestamp(107), 106, 106},
+		{fakeTimestamp(110), fakeTimestamp(110) + 1, 110, 110},
+	}
+	for _, r := range timeRanges {
+		totals, err := s.getTotalsRange(r.from, r.to, "time")
+		if err != nil {
+			t.Fatalf("getTotalsRange(%d, %d, time): %v", r.from, r.to, err)
+		}
+		checkTotals(t, totals, r.fromBlock, r.toBlock)
+		if id := fmt.Sprintf("%d:%d", r.from, r.to); totals.ID != id {
+			t.Errorf("id is %s, want %s", totals.ID, id)
+		}
+	}
+
+	// no block was produced between two blocks
+	totals, err := s.getTotalsRange(fakeTimestamp(105)+1, fakeTimestamp(105)+2, "time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals.Burned != "0x0" {
+		t.Errorf("burned of a time range without blocks is %s, want 0x0", totals.Burned)
+	}
+
+	// from 0 is from london, like internal_getTotalsRange(0, "latest")
+	totals, err = s.getTotalsRange(0, 120, "block")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTotals(t, totals, testLondonBlock, 120)
+
+	// block 110 is dropped from memory, the blocks around it are kept
+	var blocks []sql.BlockStats
+	for i := uint64(111); i <= 120; i++ {
+		blockStats, _, err := s.db.GetBlockStats(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, blockStats)
+	}
+	s.blocks.removeBlocksAfter(109)
+	s.blocks.addBlocks(blocks...)
+
+	for _, r := range [][2]uint64{{0, 120}, {105, 115}, {110, 110}, {111, 120}} {
+		_, err = s.getTotalsRange(r[0], r[1], "block")
+		if e, ok := err.(rpcError); !ok || e.ErrorCode() != errcodeNotFound {
+			t.Errorf("getTotalsRange(%d, %d) over a missing block: %v, want a not found error", r[0], r[1], err)
+		}
+	}
+
+	// the totals of 112 -> 120 are the ones up to 120 minus the ones up to 111
+	totals, err = s.getTotalsRange(112, 120, "block")
+	if err != nil {
+		t.Fatalf("getTotalsRange(112, 120): %v", err)
+	}
+	checkTotals(t, totals, 112, 120)
+}
+
+func TestGetTotalsSupply(t *testing.T) {
+	node := &fakeNode{transactions: true}
+	node.setChain("a", testLondonBlock-1, 110)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 110)
+
+	// the test network has no genesis supply
+	totals, err := s.getTotals(110)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals.Supply != "" {
+		t.Errorf("supply without a genesis supply is %s", totals.Supply)
+	}
+
+	config := *s.network
+	config.GenesisSupply = "1000000000000000000000"
+	b, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(t.TempDir(), "network.json")
+	err = ioutil.WriteFile(configPath, b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.network, err = network.Load("", configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the supply is the genesis supply and the issuance since london
+	totals, err = s.getTotals(110)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuance, err := decodeSignedBig(totals.Issuance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	supply, _ := new(big.Int).SetString("1000000000000000000000", 10)
+	supply.Add(supply, issuance)
+	if totals.Supply != hexutil.EncodeBig(supply) {
+		t.Errorf("supply is %s, want %s", totals.Supply, hexutil.EncodeBig(supply))
+	}
+
+	// a range of blocks has no supply
+	totals, err = s.getTotalsRange(105, 110, "block")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals.Supply != "" {
+		t.Errorf("supply of a range is %s", totals.Supply)
+	}
+}
+
+func TestGetBlockStatsRange(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 250)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 250)
+
+	// block 249 and 250 failed to be stored but are kept in memory
+	err := s.db.DeleteBlocksAfter(248)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := s.getBlockStatsRange(120, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Blocks) != maxBlockStatsRange || page.Blocks[0].Block.Number != 120 {
+		t.Fatalf("first page has %d blocks from %d, want %d from 120", len(page.Blocks), page.Blocks[0].Block.Number, maxBlockStatsRange)
+	}
+	if page.Next == nil || *page.Next != 220 {
+		t.Fatalf("next of the first page is %v, want 220", page.Next)
+	}
+
+	page, err = s.getBlockStatsRange(uint64(*page.Next), 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Next != nil {
+		t.Errorf("next of the last page is %d, want none", *page.Next)
+	}
+	if len(page.Blocks) != 31 {
+		t.Fatalf("last page has %d blocks, want 31", len(page.Blocks))
+	}
+	for i, b := range page.Blocks {
+		if b.Block.Number != uint(220+i) {
+			t.Errorf("block %d of the last page is %d, want %d", i, b.Block.Number, 220+i)
+		}
+	}
+}
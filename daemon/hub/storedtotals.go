@@ -0,0 +1,195 @@
+package hub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+const (
+	// aggregatesCheckpoint is the last block included in the stored hour, day
+	// and month totals.
+	aggregatesCheckpoint = "aggregates"
+
+	// totalsStoreSize is how many blocks are read from the database at once.
+	totalsStoreSize = 10000
+)
+
+func newZeroTotals() Totals {
+	return Totals{
+		BlobBurned:  "0x0",
+		Burned:      "0x0",
+		BurnedUSD:   "0x0",
+		Issuance:    "0x0",
+		IssuanceUSD: "0x0",
+		Rewards:     "0x0",
+		Tips:        "0x0",
+		TipsUSD:     "0x0",
+	}
+}
+
+func toSQLPeriodTotals(unit string, totals Totals) sql.PeriodTotals {
+	var startTime, endTime uint64
+	fmt.Sscanf(totals.ID, "%d:%d", &startTime, &endTime)
+
+	blobBurned, _ := decodeSignedBig(totals.BlobBurned)
+	burned, _ := decodeSignedBig(totals.Burned)
+	burnedUSD, _ := decodeSignedBig(totals.BurnedUSD)
+	issuance, _ := decodeSignedBig(totals.Issuance)
+	issuanceUSD, _ := decodeSignedBig(totals.IssuanceUSD)
+	rewards, _ := decodeSignedBig(totals.Rewards)
+	tips, _ := decodeSignedBig(totals.Tips)
+	tipsUSD, _ := decodeSignedBig(totals.TipsUSD)
+
+	return sql.PeriodTotals{
+		Unit:             unit,
+		StartTime:        startTime,
+		EndTime:          endTime,
+		Duration:         totals.Duration,
+		BlobBurned:       sql.NewBig(blobBurned),
+		Burned:           sql.NewBig(burned),
+		BurnedUSD:        sql.NewBig(burnedUSD),
+		Issuance:         sql.NewBig(issuance),
+		IssuanceUSD:      sql.NewBig(issuanceUSD),
+		Rewards:          sql.NewBig(rewards),
+		Tips:             sql.NewBig(tips),
+		TipsUSD:          sql.NewBig(tipsUSD),
+		BaseFeeMaximum:   totals.BaseFeePercentiles.Maximum,
+		BaseFeeMedian:    totals.BaseFeePercentiles.Median,
+		BaseFeeMinimum:   totals.BaseFeePercentiles.Minimum,
+		BaseFeeNinetieth: totals.BaseFeePercentiles.Ninetieth,
+	}
+}
+
+func fromSQLPeriodTotals(p sql.PeriodTotals) Totals {
+	return Totals{
+		ID: fmt.Sprintf("%d:%d", p.StartTime, p.EndTime),
+		BaseFeePercentiles: BaseFeePercentiles{
+			Maximum:   p.BaseFeeMaximum,
+			Median:    p.BaseFeeMedian,
+			Minimum:   p.BaseFeeMinimum,
+			Ninetieth: p.BaseFeeNinetieth,
+		},
+		BlobBurned:  hexutil.EncodeBig(p.BlobBurned.ToInt()),
+		Burned:      hexutil.EncodeBig(p.Burned.ToInt()),
+		BurnedUSD:   hexutil.EncodeBig(p.BurnedUSD.ToInt()),
+		Duration:    p.Duration,
+		Issuance:    hexutil.EncodeBig(p.Issuance.ToInt()),
+		IssuanceUSD: hexutil.EncodeBig(p.IssuanceUSD.ToInt()),
+		Rewards:     hexutil.EncodeBig(p.Rewards.ToInt()),
+		Tips:        hexutil.EncodeBig(p.Tips.ToInt()),
+		TipsUSD:     hexutil.EncodeBig(p.TipsUSD.ToInt()),
+	}
+}
+
+// storePeriodTotals stores the periods computed from the blocks fromBlock ->
+// toBlock.
+func (s *Stats) storePeriodTotals(fromBlock uint64, toBlock uint64, periodTotals []sql.PeriodTotals) error {
+	if s.readOnly {
+		return nil
+	}
+
+	err := s.db.AddPeriodTotals(aggregatesCheckpoint, fromBlock, toBlock, periodTotals)
+	if err != nil {
+		return fmt.Errorf("error storing aggregate totals for blocks %d -> %d: %v", fromBlock, toBlock, err)
+	}
+
+	return nil
+}
+
+// rewindAggregatesCheckpoint marks the stored aggregates after blockNumber as
+// out of date, they are computed again on the next start.
+func (s *Stats) rewindAggregatesCheckpoint(blockNumber uint64) error {
+	if s.readOnly {
+		return nil
+	}
+
+	err := s.db.RewindCheckpoint(aggregatesCheckpoint, blockNumber)
+	if err != nil {
+		return fmt.Errorf("error rewinding checkpoint '%s': %v", aggregatesCheckpoint, err)
+	}
+
+	return nil
+}
+
+// getTotalsCheckpoint returns the checkpoint called name, nothing is stored
+// before the london block.
+func (s *Stats) getTotalsCheckpoint(name string) (uint64, error) {
+	checkpoint, ok, err := s.db.GetCheckpoint(name)
+	if err != nil {
+		return 0, fmt.Errorf("error getting checkpoint '%s': %v", name, err)
+	}
+
+	if !ok {
+		checkpoint = s.lastBerlinBlock
+
+		if !s.readOnly {
+			err = s.db.SetCheckpoint(name, checkpoint)
+			if err != nil {
+				return 0, fmt.Errorf("error setting checkpoint '%s': %v", name, err)
+			}
+		}
+	}
+
+	return checkpoint, nil
+}
+
+// loadTotals loads the stored aggregates, and only computes the ones of the
+// blocks stored after them up to blockNumber. The cumulative totals are not
+// stored, they are computed from the blocks loaded in memory.
+func (s *Stats) loadTotals(blockNumber uint64) error {
+	start := time.Now()
+
+	aggregatesBlock, err := s.getTotalsCheckpoint(aggregatesCheckpoint)
+	if err != nil {
+		return err
+	}
+	if aggregatesBlock > blockNumber {
+		aggregatesBlock = blockNumber
+	}
+
+	allPeriodTotals, err := s.db.GetAllPeriodTotals()
+	if err != nil {
+		return fmt.Errorf("error getting aggregate totals from database: %v", err)
+	}
+
+	// a granularity without stored periods was added since they were stored
+	storedUnits := map[string]bool{}
+	for _, p := range allPeriodTotals {
+		storedUnits[p.Unit] = true
+	}
+	for _, g := range granularities {
+		if !storedUnits[g.Name] {
+			aggregatesBlock = s.lastBerlinBlock
+		}
+	}
+
+	if aggregatesBlock < s.londonBlock {
+		return s.updateAllAggregateTotals(blockNumber)
+	}
+
+	// periods are added from the earliest to the latest
+	for _, p := range allPeriodTotals {
+		totalsList, ok := s.aggregates[p.Unit]
+		if !ok {
+			continue
+		}
+		totalsList.addPeriod(fromSQLPeriodTotals(p))
+	}
+
+	log.Infof("init: LoadTotals - Imported %d aggregate totals up to block %d", len(allPeriodTotals), aggregatesBlock)
+
+	if aggregatesBlock < blockNumber {
+		err = s.refreshAggregateTotalsRange(aggregatesBlock+1, blockNumber)
+		if err != nil {
+			return fmt.Errorf("error refreshing aggregate totals from block %d: %v", aggregatesBlock+1, err)
+		}
+	}
+
+	duration := time.Since(start) / time.Millisecond
+	log.Infof("init: LoadTotals - Loaded totals up to block %d (ptime: %dms)", blockNumber, duration)
+
+	return nil
+}
@@ -1,6 +1,8 @@
 package hub
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -39,3 +41,37 @@ func (tl *TotalsList) addPeriod(period Totals) {
 	sliceEnd := len(tl.periods) + 1
 	tl.periods = append([]Totals{period}, tl.periods...)[:sliceEnd]
 }
+
+func (tl *TotalsList) replacePeriod(period Totals) {
+	tl.mu.Lock()
+
+	// periods are sorted from the latest to the earliest
+	start := getPeriodStart(period.ID)
+	i := sort.Search(len(tl.periods), func(i int) bool { return getPeriodStart(tl.periods[i].ID) <= start })
+	if i < len(tl.periods) && tl.periods[i].ID == period.ID {
+		tl.periods[i] = period
+		tl.mu.Unlock()
+		return
+	}
+
+	tl.mu.Unlock()
+	tl.addPeriod(period)
+}
+
+// removePeriodsAfter drops the latest periods that start after epoch.
+func (tl *TotalsList) removePeriodsAfter(epoch uint64) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	for len(tl.periods) > 0 && getPeriodStart(tl.periods[0].ID) > epoch {
+		tl.periods = tl.periods[1:]
+	}
+}
+
+// getPeriodStart returns the start time encoded in a period ID.
+func getPeriodStart(id string) uint64 {
+	var startPeriod, endPeriod uint64
+	fmt.Sscanf(id, "%d:%d", &startPeriod, &endPeriod)
+
+	return startPeriod
+}
@@ -6,53 +6,125 @@ import (
 	"math/big"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
+// receiptsBatchSize is how many receipts are requested per batch request, it
+// keeps the request body within the body size the cache hashes.
+const receiptsBatchSize = 50
+
 type TransactionReceiptWorker struct {
 	NumWorkers int
 	Endpoint   string
 
 	// The channel to receive the jobs. All the workers will block until it receives a job.
 	jobs chan transactionReceiptJob
+
+	// The features of the node, detected when initializing.
+	blockReceipts bool
+	batchRequests bool
 }
 
 func (h *TransactionReceiptWorker) Initialize() {
 	h.jobs = make(chan transactionReceiptJob)
 
+	h.detectFeatures(h.newRPCClient())
+
 	// Start all the workers.
 	for w := 1; w <= h.NumWorkers; w++ {
 		go h.startWorker(w, h.jobs)
 	}
 }
 
-func (h *TransactionReceiptWorker) QueueJob(transactions []string, blockNumber uint64, baseFee *big.Int, updateCache bool) ([]uint64, *big.Int, *big.Int, *big.Int) {
+func (h *TransactionReceiptWorker) newRPCClient() *RPCClient {
+	tr := &http.Transport{}
+	client := &http.Client{Transport: tr}
+
+	return &RPCClient{
+		endpoint:   h.Endpoint,
+		httpClient: client,
+	}
+}
+
+// detectFeatures checks whether the node serves eth_getBlockReceipts and
+// JSON-RPC batch requests, receipts are fetched one by one otherwise.
+func (h *TransactionReceiptWorker) detectFeatures(rpcClient *RPCClient) {
+	message, err := rpcClient.call("2.0", "eth_getBlockReceipts", "", true, "latest")
+	if err != nil {
+		log.Warnf("cannot detect eth_getBlockReceipts support: %v", err)
+	} else if message.Error != nil {
+		log.Infof("eth_getBlockReceipts is not supported: %v", message.Error)
+	} else {
+		var receipts []TransactionReceipt
+		h.blockReceipts = json.Unmarshal(message.Result, &receipts) == nil
+	}
+
+	batch := []BatchElem{{Args: []interface{}{}}}
+	err = rpcClient.BatchCallContext("2.0", "eth_chainId", "", true, batch)
+	if err != nil {
+		log.Infof("batch requests are not supported: %v", err)
+	} else {
+		h.batchRequests = batch[0].Error == nil
+	}
+
+	log.Infof("Initialize transactionReceiptWorker: eth_getBlockReceipts=%t, batch requests=%t", h.blockReceipts, h.batchRequests)
+}
+
+func (h *TransactionReceiptWorker) QueueJob(transactions []string, blockNumber uint64, baseFee *big.Int, updateCache bool) *transactionReceiptTotals {
+	// A single job fetches all the receipts of the block when the node supports
+	// it, otherwise the transactions are split in batches.
+	batchSize := 1
+	if h.blockReceipts {
+		batchSize = len(transactions)
+	} else if h.batchRequests {
+		batchSize = receiptsBatchSize
+	}
+
+	var jobs []transactionReceiptJob
+	for i := 0; i < len(transactions); i += batchSize {
+		j := i + batchSize
+		if j > len(transactions) {
+			j = len(transactions)
+		}
+
+		jobs = append(jobs, transactionReceiptJob{
+			BlockNumber:       blockNumber,
+			BlockReceipts:     h.blockReceipts,
+			TransactionHashes: transactions[i:j],
+			BaseFee:           baseFee,
+			UpdateCache:       updateCache,
+		})
+	}
+
 	// Open a channel to maka sure all the receipts are processed and we block on the result.
 	results := make(chan transactionReceiptResult, len(transactions))
 
 	// Enqueue the jobs.
-	for _, tHash := range transactions {
-		h.jobs <- transactionReceiptJob{
-			Results:         results,
-			BlockNumber:     blockNumber,
-			TransactionHash: tHash,
-			BaseFee:         baseFee,
-			UpdateCache:     updateCache,
-		}
+	metrics.receiptQueueDepth.Add(float64(len(jobs)))
+	for _, job := range jobs {
+		job.Results = results
+		h.jobs <- job
 	}
 
-	var allPriorityFeePerGasMwei []uint64
-	blockBurned := big.NewInt(0)
-	blockTips := big.NewInt(0)
+	totals := &transactionReceiptTotals{
+		Burned:       big.NewInt(0),
+		Tips:         big.NewInt(0),
+		BlobBurned:   big.NewInt(0),
+		BlobGasUsed:  big.NewInt(0),
+		BlobGasPrice: big.NewInt(0),
+	}
 
 	type2count := int64(0)
-	// Wait for all the jobs to be processed.
+	type3count := int64(0)
+	// Wait for all the receipts to be processed.
 	for a := 0; a < len(transactions); a++ {
 		response := <-results
 
 		if response.Error != nil {
 			log.Errorln(response.Error)
+			metrics.receiptErrors.Inc()
 			continue
 		}
 
@@ -64,52 +136,156 @@ func (h *TransactionReceiptWorker) QueueJob(transactions []string, blockNumber u
 			type2count++
 		}
 
-		allPriorityFeePerGasMwei = append(allPriorityFeePerGasMwei, response.Result.PriorityFeePerGas.Uint64())
-		blockBurned.Add(blockBurned, response.Result.Burned)
-		blockTips.Add(blockTips, response.Result.Tips)
+		if response.Result.Type == "0x3" {
+			type3count++
+			totals.BlobGasPrice = response.Result.BlobGasPrice
+		}
+
+		totals.PriorityFeePerGasMwei = append(totals.PriorityFeePerGasMwei, response.Result.PriorityFeePerGas.Uint64())
+		totals.Burned.Add(totals.Burned, response.Result.Burned)
+		totals.Tips.Add(totals.Tips, response.Result.Tips)
+		totals.BlobBurned.Add(totals.BlobBurned, response.Result.BlobBurned)
+		totals.BlobGasUsed.Add(totals.BlobGasUsed, response.Result.BlobGasUsed)
 	}
 
+	totals.Type2Count = big.NewInt(type2count)
+	totals.Type3Count = big.NewInt(type3count)
+
 	// Return the aggregated results.
-	return allPriorityFeePerGasMwei, blockBurned, blockTips, big.NewInt(type2count)
+	return totals
 }
 
 func (h *TransactionReceiptWorker) startWorker(id int, jobs <-chan transactionReceiptJob) {
 	// Reuse the transport for each worker.
-	tr := &http.Transport{}
-	client := &http.Client{Transport: tr}
-	rpcClient := &RPCClient{
-		endpoint:   h.Endpoint,
-		httpClient: client,
-	}
+	rpcClient := h.newRPCClient()
 
-	// Listen for jobs and process them.
+	// Listen for jobs and process them, every job sends one result per transaction.
 	for j := range jobs {
-		response, err := h.processTransactionReceipt(rpcClient, j)
-		j.Results <- transactionReceiptResult{Result: response, Error: err}
+		metrics.receiptQueueDepth.Dec()
+
+		receipts, errs := h.getTransactionReceipts(rpcClient, j)
+
+		for i, tHash := range j.TransactionHashes {
+			if errs[i] != nil {
+				j.Results <- transactionReceiptResult{Error: errs[i]}
+				continue
+			}
+
+			response, err := h.processTransactionReceipt(receipts[i], tHash, j)
+			j.Results <- transactionReceiptResult{Result: response, Error: err}
+		}
 	}
 }
 
-func (h *TransactionReceiptWorker) processTransactionReceipt(rpcClient *RPCClient, param transactionReceiptJob) (*transactionReceiptResponse, error) {
-	raw, err := rpcClient.CallContext(
+// getTransactionReceipts returns the receipt, or the error, of every
+// transaction of the job in the same order.
+func (h *TransactionReceiptWorker) getTransactionReceipts(rpcClient *RPCClient, param transactionReceiptJob) ([]TransactionReceipt, []error) {
+	receipts := make([]TransactionReceipt, len(param.TransactionHashes))
+	errs := make([]error, len(param.TransactionHashes))
+
+	if param.BlockReceipts {
+		err := h.getBlockReceipts(rpcClient, param, receipts)
+		if err == nil {
+			return receipts, errs
+		}
+		log.Warnf("block %d: falling back to eth_getTransactionReceipt, %v", param.BlockNumber, err)
+	}
+
+	if len(param.TransactionHashes) > 1 {
+		batch := make([]BatchElem, len(param.TransactionHashes))
+		for i, tHash := range param.TransactionHashes {
+			batch[i].Args = []interface{}{tHash}
+		}
+
+		err := rpcClient.BatchCallContext(
+			"2.0",
+			"eth_getTransactionReceipt",
+			strconv.Itoa(int(param.BlockNumber)),
+			param.UpdateCache,
+			batch,
+		)
+		if err == nil {
+			for i, elem := range batch {
+				if elem.Error != nil {
+					errs[i] = fmt.Errorf("error eth_getTransactionReceipt: %v", elem.Error)
+					continue
+				}
+
+				err = json.Unmarshal(elem.Result, &receipts[i])
+				if err != nil {
+					errs[i] = fmt.Errorf("error eth_getTransactionReceipt Unmarshal TransactionReceipt: %v", err)
+				}
+			}
+
+			return receipts, errs
+		}
+		log.Warnf("block %d: falling back to single eth_getTransactionReceipt requests, %v", param.BlockNumber, err)
+	}
+
+	for i, tHash := range param.TransactionHashes {
+		raw, err := rpcClient.CallContext(
+			"2.0",
+			"eth_getTransactionReceipt",
+			strconv.Itoa(int(param.BlockNumber)),
+			param.UpdateCache,
+			tHash,
+		)
+		if err != nil {
+			errs[i] = fmt.Errorf("error eth_getTransactionReceipt: %v", err)
+			continue
+		}
+
+		err = json.Unmarshal(raw, &receipts[i])
+		if err != nil {
+			errs[i] = fmt.Errorf("error eth_getTransactionReceipt Unmarshal TransactionReceipt: %v", err)
+		}
+	}
+
+	return receipts, errs
+}
+
+// getBlockReceipts fills receipts with all the receipts of the block, they
+// must match the transactions of the job one to one.
+func (h *TransactionReceiptWorker) getBlockReceipts(rpcClient *RPCClient, param transactionReceiptJob, receipts []TransactionReceipt) error {
+	message, err := rpcClient.call(
 		"2.0",
-		"eth_getTransactionReceipt",
+		"eth_getBlockReceipts",
 		strconv.Itoa(int(param.BlockNumber)),
 		param.UpdateCache,
-		param.TransactionHash,
+		hexutil.EncodeUint64(param.BlockNumber),
 	)
-
 	if err != nil {
-		return nil, fmt.Errorf("error eth_getTransactionReceipt: %v", err)
+		return fmt.Errorf("error eth_getBlockReceipts: %v", err)
+	}
+
+	if message.Error != nil {
+		return fmt.Errorf("error eth_getBlockReceipts: %v", message.Error)
 	}
 
-	receipt := TransactionReceipt{}
-	err = json.Unmarshal(raw, &receipt)
+	var blockReceipts []TransactionReceipt
+	err = json.Unmarshal(message.Result, &blockReceipts)
 	if err != nil {
-		return nil, fmt.Errorf("error eth_getTransactionReceipt Unmarshal TransactionReceipt: %v", err)
+		return fmt.Errorf("error eth_getBlockReceipts Unmarshal TransactionReceipt: %v", err)
 	}
 
+	if len(blockReceipts) != len(receipts) {
+		return fmt.Errorf("eth_getBlockReceipts returned %d receipts for %d transactions", len(blockReceipts), len(receipts))
+	}
+
+	for i, receipt := range blockReceipts {
+		if !strings.EqualFold(receipt.TransactionHash, param.TransactionHashes[i]) {
+			return fmt.Errorf("eth_getBlockReceipts returned receipt %s for transaction %s", receipt.TransactionHash, param.TransactionHashes[i])
+		}
+	}
+
+	copy(receipts, blockReceipts)
+
+	return nil
+}
+
+func (h *TransactionReceiptWorker) processTransactionReceipt(receipt TransactionReceipt, transactionHash string, param transactionReceiptJob) (*transactionReceiptResponse, error) {
 	if receipt.BlockNumber == "" {
-		log.Warnf("block %d, transaction %s: found empty transaction receipt", param.BlockNumber, param.TransactionHash)
+		log.Warnf("block %d, transaction %s: found empty transaction receipt", param.BlockNumber, transactionHash)
 		return nil, nil
 	}
 
@@ -135,27 +311,52 @@ func (h *TransactionReceiptWorker) processTransactionReceipt(rpcClient *RPCClien
 	tips.Sub(tips, burned)
 
 	if tips.Sign() == -1 {
-		log.Errorf("tips is negative, effectiveGasPrice=%s, gasUsed=%s, transactionHash=%s, blockNumber=%d, baseFee=%s", effectiveGasPrice.String(), gasUsed.String(), param.TransactionHash, param.BlockNumber, param.BaseFee)
+		log.Errorf("tips is negative, effectiveGasPrice=%s, gasUsed=%s, transactionHash=%s, blockNumber=%d, baseFee=%s", effectiveGasPrice.String(), gasUsed.String(), transactionHash, param.BlockNumber, param.BaseFee)
 	}
 
 	priorityFeePerGas := big.NewInt(0)
 	priorityFeePerGas.Div(tips, gasUsed)
 	priorityFeePerGasMwei := priorityFeePerGas.Div(priorityFeePerGas, big.NewInt(1_000_000))
 
+	// blob transactions (EIP-4844) also burn the blob gas at the blob base fee
+	blobGasUsed := big.NewInt(0)
+	blobGasPrice := big.NewInt(0)
+
+	if receipt.BlobGasUsed != "" {
+		blobGasUsed, err = hexutil.DecodeBig(receipt.BlobGasUsed)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding receipt.BlobGasUsed: %v", err)
+		}
+	}
+
+	if receipt.BlobGasPrice != "" {
+		blobGasPrice, err = hexutil.DecodeBig(receipt.BlobGasPrice)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding receipt.BlobGasPrice: %v", err)
+		}
+	}
+
+	blobBurned := big.NewInt(0)
+	blobBurned.Mul(blobGasUsed, blobGasPrice)
+
 	return &transactionReceiptResponse{
 		Burned:            burned,
 		PriorityFeePerGas: priorityFeePerGasMwei,
 		Tips:              tips,
 		Type:              receipt.Type,
+		BlobBurned:        blobBurned,
+		BlobGasPrice:      blobGasPrice,
+		BlobGasUsed:       blobGasUsed,
 	}, nil
 }
 
 type transactionReceiptJob struct {
-	BlockNumber     uint64
-	BaseFee         *big.Int
-	Results         chan transactionReceiptResult
-	TransactionHash string
-	UpdateCache     bool
+	BlockNumber       uint64
+	BlockReceipts     bool
+	BaseFee           *big.Int
+	Results           chan transactionReceiptResult
+	TransactionHashes []string
+	UpdateCache       bool
 }
 
 type transactionReceiptResponse struct {
@@ -163,9 +364,23 @@ type transactionReceiptResponse struct {
 	PriorityFeePerGas *big.Int
 	Tips              *big.Int
 	Type              string
+	BlobBurned        *big.Int
+	BlobGasPrice      *big.Int
+	BlobGasUsed       *big.Int
 }
 
 type transactionReceiptResult struct {
 	Result *transactionReceiptResponse
 	Error  error
 }
+
+type transactionReceiptTotals struct {
+	PriorityFeePerGasMwei []uint64
+	Burned                *big.Int
+	Tips                  *big.Int
+	BlobBurned            *big.Int
+	BlobGasPrice          *big.Int
+	BlobGasUsed           *big.Int
+	Type2Count            *big.Int
+	Type3Count            *big.Int
+}
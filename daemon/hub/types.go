@@ -1,11 +1,17 @@
 package hub
 
-import "github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+import (
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/network"
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
 
 // Block type represents a single ethereum Block.
 type Block struct {
 	BaseFeePerGas    string        `json:"baseFeePerGas"`
+	BlobGasUsed      string        `json:"blobGasUsed"`
 	Difficulty       string        `json:"difficulty"`
+	ExcessBlobGas    string        `json:"excessBlobGas"`
 	ExtraData        string        `json:"extraData"`
 	GasLimit         string        `json:"gasLimit"`
 	GasUsed          string        `json:"gasUsed"`
@@ -42,6 +48,8 @@ type TransactionLog struct {
 
 // TransactionReceipt type represents a single ethereum Transaction.
 type TransactionReceipt struct {
+	BlobGasPrice      string           `json:"blobGasPrice"`
+	BlobGasUsed       string           `json:"blobGasUsed"`
 	BlockHash         string           `json:"blockHash"`
 	BlockNumber       string           `json:"blockNumber"`
 	ContractAddress   interface{}      `json:"contractAddress"`
@@ -65,16 +73,25 @@ type BaseFeePercentiles struct {
 	Ninetieth uint `json:"ninetieth"`
 }
 
-// Totals type represents a single aggregate of all the data.
+// Totals type represents a single aggregate of all the data. Burned includes
+// the blob burn, which is also reported on its own as BlobBurned. The USD
+// amounts are valued at the price of each block, in 1e-18 dollars like the
+// other amounts are in wei. Supply is only set in the totals since london, on
+// networks whose genesis supply is known.
 type Totals struct {
 	ID                 string             `json:"id"`
 	BaseFee            uint               `json:"baseFee,omitempty"`
 	BaseFeePercentiles BaseFeePercentiles `json:"baseFeePercentiles,omitempty"`
+	BlobBurned         string             `json:"blobBurned"`
 	Burned             string             `json:"burned"`
+	BurnedUSD          string             `json:"burnedUSD"`
 	Duration           uint64             `json:"duration"`
 	Issuance           string             `json:"issuance"`
+	IssuanceUSD        string             `json:"issuanceUSD"`
 	Rewards            string             `json:"rewards"`
+	Supply             string             `json:"supply,omitempty"`
 	Tips               string             `json:"tips"`
+	TipsUSD            string             `json:"tipsUSD"`
 }
 
 // InitialData type represents the initial data that the client requests.
@@ -87,8 +104,36 @@ type InitialData struct {
 	TotalsMonth Totals           `json:"totalsMonth"`
 	TotalsWeek  Totals           `json:"totalsWeek"`
 	BlockNumber uint64           `json:"blockNumber"`
+	Network     *network.Config  `json:"network"`
 	Version     string           `json:"version"`
 	USDPrice    float64          `json:"usdPrice"`
+
+	// USDPriceTimestamp is the unix time USDPrice was last updated at, 0 if
+	// it has never been.
+	USDPriceTimestamp int64 `json:"usdPriceTimestamp"`
+
+	// Prices are the known prices in every watched quote currency, like EUR,
+	// and PriceTimestamps the unix time they were last updated at.
+	Prices          map[string]float64 `json:"prices"`
+	PriceTimestamps map[string]int64   `json:"priceTimestamps"`
+
+	// Currency is the quote currency requested by the client and Price the
+	// price in it, they are left out when none is requested.
+	Currency string  `json:"currency,omitempty"`
+	Price    float64 `json:"price,omitempty"`
+}
+
+// BlockStatsData type represents a stored block with its percentiles.
+type BlockStatsData struct {
+	Block       sql.BlockStats              `json:"block"`
+	Percentiles []sql.BlockStatsPercentiles `json:"percentiles"`
+}
+
+// BlockStatsPage type represents a page of stored blocks, Next is the first
+// block of the next page or nil on the last page.
+type BlockStatsPage struct {
+	Blocks []BlockStatsData `json:"blocks"`
+	Next   *hexutil.Uint64  `json:"next"`
 }
 
 // ClientData type represents the data that the server sends at every new block.
@@ -103,11 +148,38 @@ type BlockData struct {
 	TotalsWeek  Totals         `json:"totalsWeek"`
 	Version     string         `json:"version"`
 	USDPrice    float64        `json:"usdPrice"`
+
+	// USDPriceTimestamp is the unix time USDPrice was last updated at, 0 if
+	// it has never been.
+	USDPriceTimestamp int64 `json:"usdPriceTimestamp"`
+
+	// Prices are the known prices in every watched quote currency, like EUR,
+	// and PriceTimestamps the unix time they were last updated at.
+	Prices          map[string]float64 `json:"prices"`
+	PriceTimestamps map[string]int64   `json:"priceTimestamps"`
+
+	// Currency is the quote currency of the subscription and Price the price
+	// in it, they are left out when the subscription has none.
+	Currency string  `json:"currency,omitempty"`
+	Price    float64 `json:"price,omitempty"`
 }
 
-// ClientData type represents the data that the server sends at every new block.
-type AggregatesData struct {
-	TotalsPerDay   []Totals `json:"totalsPerDay"`
-	TotalsPerHour  []Totals `json:"totalsPerHour"`
-	TotalsPerMonth []Totals `json:"totalsPerMonth"`
+// withCurrency returns a copy of the data with the price in currency.
+func (d *BlockData) withCurrency(currency string) *BlockData {
+	data := *d
+	data.Currency = currency
+	data.Price = d.Prices[currency]
+
+	return &data
+}
+
+// AggregatesData type represents the periods of some granularities, keyed by
+// series name like totalsPerDay.
+type AggregatesData map[string][]Totals
+
+// ReorgData type represents a chain reorganization that replaced processed blocks.
+type ReorgData struct {
+	Blocks         []sql.BlockStats `json:"blocks"`
+	CommonAncestor uint64           `json:"commonAncestor"`
+	Depth          uint64           `json:"depth"`
 }
@@ -0,0 +1,250 @@
+package hub
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+// maxLivePriceAge is how long before or after a block was produced the live
+// price can have been fetched to be recorded as its price.
+const maxLivePriceAge = 10 * time.Minute
+
+// candleTimeColumns and candleTimeFormats are the names and the formats of
+// the open time column of the candle files.
+var candleTimeColumns = []string{"timestamp", "time", "unix", "date", "open_time", "opentime"}
+var candleTimeFormats = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// USDPrices defines a mutexed list of the imported ETH/USD prices, sorted by
+// timestamp.
+type USDPrices struct {
+	mu     sync.RWMutex
+	prices []sql.USDPrice
+}
+
+func newUSDPrices() *USDPrices {
+	return &USDPrices{}
+}
+
+// addPrices adds prices, replacing the ones starting at the same time.
+func (up *USDPrices) addPrices(prices ...sql.USDPrice) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+
+	up.prices = append(up.prices, prices...)
+	sort.SliceStable(up.prices, func(i, j int) bool { return up.prices[i].Timestamp < up.prices[j].Timestamp })
+
+	// the prices added last are after the ones starting at the same time
+	deduped := up.prices[:0]
+	for i, p := range up.prices {
+		if i+1 < len(up.prices) && up.prices[i+1].Timestamp == p.Timestamp {
+			continue
+		}
+		deduped = append(deduped, p)
+	}
+	up.prices = deduped
+}
+
+// getPrice returns the price during which timestamp is, false if there is
+// none.
+func (up *USDPrices) getPrice(timestamp uint64) (float64, bool) {
+	up.mu.RLock()
+	defer up.mu.RUnlock()
+
+	i := sort.Search(len(up.prices), func(i int) bool { return up.prices[i].Timestamp > timestamp })
+	if i == 0 {
+		return 0, false
+	}
+
+	p := up.prices[i-1]
+	if timestamp >= p.Timestamp+p.Duration {
+		return 0, false
+	}
+
+	return p.Price, true
+}
+
+func (up *USDPrices) len() int {
+	up.mu.RLock()
+	defer up.mu.RUnlock()
+
+	return len(up.prices)
+}
+
+// initUSDPrices loads the imported prices.
+func (s *Stats) initUSDPrices() error {
+	s.usdPrices = newUSDPrices()
+
+	usdPrices, err := s.db.GetAllUSDPrices()
+	if err != nil {
+		return fmt.Errorf("error getting usd prices from database: %v", err)
+	}
+	s.usdPrices.addPrices(usdPrices...)
+
+	log.Infof("init: USDPrices - Imported %d prices", len(usdPrices))
+
+	return nil
+}
+
+// getUSDPrice returns the ETH/USD price when a block was produced at
+// timestamp, the live price if it was fetched around then or else the
+// imported one, 0 if it is not known.
+func (s *Stats) getUSDPrice(timestamp uint64) float64 {
+	if s.prices != nil {
+		price, updatedAt := s.prices.getPriceUpdatedAt(usdCurrency)
+		age := time.Duration(int64(timestamp)-updatedAt.Unix()) * time.Second
+		if price > 0 && age <= maxLivePriceAge && age >= -maxLivePriceAge {
+			return price
+		}
+	}
+
+	price, _ := s.usdPrices.getPrice(timestamp)
+
+	return price
+}
+
+// getEpochUSDPrice returns the price of the block the issuance of the epoch
+// ending at endTimestamp is credited to, 0 if it is not known.
+func (s *Stats) getEpochUSDPrice(endTimestamp uint64) float64 {
+	entry, ok := s.blocks.getEntry(s.blocks.searchTimestamp(endTimestamp))
+	if !ok {
+		return 0
+	}
+
+	return entry.usdPrice
+}
+
+// usdMicros returns the value of an amount of wei at price, in millionths of a
+// dollar.
+func usdMicros(wei *big.Int, price float64) int64 {
+	if price <= 0 {
+		return 0
+	}
+
+	value := new(big.Int).Mul(wei, big.NewInt(int64(math.Round(price*1e6))))
+	value.Quo(value, big.NewInt(1_000_000_000_000_000_000))
+
+	return value.Int64()
+}
+
+// usdBig returns an amount of millionths of a dollar in 1e-18 dollars, the
+// unit USD amounts are sent and stored in like amounts of ether are in wei.
+func usdBig(micros int64) *big.Int {
+	value := big.NewInt(micros)
+	return value.Mul(value, big.NewInt(1_000_000_000_000))
+}
+
+// readUSDPriceCandles reads the candles of a CSV file with a header, the price
+// of a candle is its close and its time its open time, in seconds,
+// milliseconds or as a date. Every candle lasts duration seconds, or the
+// shortest time between two candles when duration is 0.
+func readUSDPriceCandles(r io.Reader, source string, duration uint64) ([]sql.USDPrice, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %v", err)
+	}
+
+	timeColumn, priceColumn := -1, -1
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for _, timeName := range candleTimeColumns {
+			if name == timeName && timeColumn == -1 {
+				timeColumn = i
+			}
+		}
+		if name == "close" || (name == "price" && priceColumn == -1) {
+			priceColumn = i
+		}
+	}
+	if timeColumn == -1 || priceColumn == -1 {
+		return nil, fmt.Errorf("header %v has no time column (one of %v) or no close column", header, candleTimeColumns)
+	}
+
+	var prices []sql.USDPrice
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading line %d: %v", line, err)
+		}
+		if len(record) <= timeColumn || len(record) <= priceColumn {
+			return nil, fmt.Errorf("line %d has %d columns", line, len(record))
+		}
+
+		timestamp, err := parseCandleTime(strings.TrimSpace(record[timeColumn]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		price, err := strconv.ParseFloat(strings.TrimSpace(record[priceColumn]), 64)
+		if err != nil || price <= 0 {
+			return nil, fmt.Errorf("line %d: price '%s' is not a positive number", line, record[priceColumn])
+		}
+
+		prices = append(prices, sql.USDPrice{
+			Timestamp: timestamp,
+			Price:     price,
+			Source:    source,
+		})
+	}
+
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("no candle to import")
+	}
+
+	// files are often sorted from the latest candle
+	sort.SliceStable(prices, func(i, j int) bool { return prices[i].Timestamp < prices[j].Timestamp })
+
+	if duration == 0 {
+		for i := 1; i < len(prices); i++ {
+			d := prices[i].Timestamp - prices[i-1].Timestamp
+			if d > 0 && (duration == 0 || d < duration) {
+				duration = d
+			}
+		}
+		if duration == 0 {
+			return nil, fmt.Errorf("candle duration can not be inferred from a single candle")
+		}
+	}
+
+	for i := range prices {
+		prices[i].Duration = duration
+	}
+
+	return prices, nil
+}
+
+// parseCandleTime parses a unix time in seconds or milliseconds, or a UTC
+// date.
+func parseCandleTime(value string) (uint64, error) {
+	if n, err := strconv.ParseFloat(value, 64); err == nil && n > 0 {
+		// a time in seconds this large would be after the year 5000
+		if n > 1e11 {
+			n /= 1000
+		}
+		return uint64(n), nil
+	}
+
+	for _, format := range candleTimeFormats {
+		t, err := time.Parse(format, value)
+		if err == nil {
+			return uint64(t.Unix()), nil
+		}
+	}
+
+	return 0, fmt.Errorf("time '%s' is not a unix time or a date", value)
+}
@@ -0,0 +1,181 @@
+package hub
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+// candle returns a price of the source test.
+func candle(timestamp uint64, duration uint64, price float64) sql.USDPrice {
+	return sql.USDPrice{Timestamp: timestamp, Duration: duration, Price: price, Source: "test"}
+}
+
+func TestReadUSDPriceCandles(t *testing.T) {
+	tests := []struct {
+		name     string
+		csv      string
+		duration uint64
+		want     []sql.USDPrice
+	}{
+		{
+			name: "unix seconds",
+			csv:  "timestamp,open,high,low,close\n1628208000,2700,2800,2650,2750.5\n1628208060,2750.5,2760,2740,2745\n",
+			want: []sql.USDPrice{candle(1628208000, 60, 2750.5), candle(1628208060, 60, 2745)},
+		},
+		{
+			name: "milliseconds from the latest candle",
+			csv:  "Open_Time, Close\n1628211600000,2800\n1628208000000,2750\n",
+			want: []sql.USDPrice{candle(1628208000, 3600, 2750), candle(1628211600, 3600, 2800)},
+		},
+		{
+			// the shortest time between two candles, a missing one is a gap
+			name: "dates with a gap",
+			csv:  "date,price\n2021-08-06,2700\n2021-08-07,2900\n2021-08-09,3100\n",
+			want: []sql.USDPrice{candle(1628208000, 86400, 2700), candle(1628294400, 86400, 2900), candle(1628467200, 86400, 3100)},
+		},
+		{
+			name: "close preferred to price",
+			csv:  "time,price,close\n2021-08-06 00:00,1,2700\n2021-08-06 00:05,1,2710\n",
+			want: []sql.USDPrice{candle(1628208000, 300, 2700), candle(1628208300, 300, 2710)},
+		},
+		{
+			name:     "given duration",
+			csv:      "unix,close\n1628208000,2700\n",
+			duration: 3600,
+			want:     []sql.USDPrice{candle(1628208000, 3600, 2700)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prices, err := readUSDPriceCandles(strings.NewReader(test.csv), "test", test.duration)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(prices) != len(test.want) {
+				t.Fatalf("%d candles, want %d: %v", len(prices), len(test.want), prices)
+			}
+			for i := range prices {
+				if prices[i] != test.want[i] {
+					t.Errorf("candle %d is %v, want %v", i, prices[i], test.want[i])
+				}
+			}
+		})
+	}
+
+	invalid := []struct {
+		name string
+		csv  string
+	}{
+		{"no header", ""},
+		{"no time column", "open,close\n2700,2750\n2750,2760\n"},
+		{"no close column", "timestamp,open\n1628208000,2700\n1628208060,2750\n"},
+		{"single candle", "timestamp,close\n1628208000,2700\n"},
+		{"no candle", "timestamp,close\n"},
+		{"bad time", "timestamp,close\nyesterday,2700\n"},
+		{"zero price", "timestamp,close\n1628208000,0\n1628208060,2750\n"},
+		{"missing column", "timestamp,close\n1628208000\n"},
+	}
+
+	for _, test := range invalid {
+		if _, err := readUSDPriceCandles(strings.NewReader(test.csv), "test", 0); err == nil {
+			t.Errorf("%s: candles are read", test.name)
+		}
+	}
+}
+
+// checkUSDPrices checks the price of the blocks from -> to in memory and in
+// the database.
+func checkUSDPrices(t *testing.T, s *Stats, from uint64, to uint64, want func(blockNumber uint64) float64) {
+	t.Helper()
+
+	for i := from; i <= to; i++ {
+		blockStats, ok, err := s.db.GetBlockStats(i)
+		if err != nil || !ok {
+			t.Fatalf("block %d is not in the database: %v", i, err)
+		}
+		if blockStats.USDPrice != want(i) {
+			t.Errorf("block %d has price %v in the database, want %v", i, blockStats.USDPrice, want(i))
+		}
+
+		entry, ok := s.blocks.getEntry(i)
+		if !ok || entry.usdPrice != want(i) {
+			t.Errorf("block %d has price %v in memory, want %v", i, entry.usdPrice, want(i))
+		}
+	}
+}
+
+func TestImportUSDPrices(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, 120)
+	s := newTestStats(t, node)
+	processBlocks(t, s, testLondonBlock, 120)
+
+	// block 105 was priced live
+	blockStats, _, err := s.db.GetBlockStats(105)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockStats.USDPrice = 1000
+	err = s.db.SetBlockUSDPrices([]sql.BlockStats{blockStats})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.blocks.addBlocks(blockStats)
+
+	// minute candles from block 102, 5 blocks each, from the latest
+	var csv strings.Builder
+	csv.WriteString("open_time,open,high,low,close\n")
+	for k := 3; k >= 0; k-- {
+		fmt.Fprintf(&csv, "%d,1,1,1,%d\n", fakeTimestamp(102)+uint64(k)*60, 2000+k)
+	}
+	candlePrice := func(blockNumber uint64) float64 {
+		return float64(2000 + (blockNumber-102)/5)
+	}
+
+	err = s.ImportUSDPrices(strings.NewReader(csv.String()), "test", 0, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the blocks before the candles have no price, and the live price is kept
+	checkUSDPrices(t, s, testLondonBlock, 101, func(uint64) float64 { return 0 })
+	checkUSDPrices(t, s, 102, 120, func(blockNumber uint64) float64 {
+		if blockNumber == 105 {
+			return 1000
+		}
+		return candlePrice(blockNumber)
+	})
+
+	prices, err := s.db.GetAllUSDPrices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 4 || prices[0].Timestamp != fakeTimestamp(102) || prices[0].Duration != 60 || prices[0].Source != "test" {
+		t.Errorf("stored candles are %v", prices)
+	}
+
+	// overwrite replaces the live price
+	err = s.ImportUSDPrices(strings.NewReader(csv.String()), "test", 0, 103, 110, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUSDPrices(t, s, 102, 120, candlePrice)
+
+	blockStats.USDPrice = 1000
+	err = s.db.SetBlockUSDPrices([]sql.BlockStats{blockStats})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.blocks.addBlocks(blockStats)
+
+	// but only in the blocks of the range
+	err = s.ImportUSDPrices(strings.NewReader(csv.String()), "test", 0, 106, 110, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUSDPrices(t, s, 105, 105, func(uint64) float64 { return 1000 })
+}
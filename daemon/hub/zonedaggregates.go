@@ -0,0 +1,129 @@
+package hub
+
+import (
+	"sync"
+	"time"
+
+	// the timezones are available without a zoneinfo database on the host
+	_ "time/tzdata"
+)
+
+// maxCachedTimezones is how many timezones have their periods cached, the
+// cache is cleared when a new one is requested past it.
+const maxCachedTimezones = 32
+
+// ZonedAggregates defines a mutexed cache of the periods computed for the
+// timezones clients requested. Only the periods that ended are cached, they
+// change only when the totals of their blocks are refreshed.
+type ZonedAggregates struct {
+	mu        sync.Mutex
+	locations map[string]*time.Location
+
+	// periods are keyed by timezone, granularity and period start
+	periods map[string]map[string]map[int64]Totals
+}
+
+func newZonedAggregates() *ZonedAggregates {
+	return &ZonedAggregates{
+		locations: map[string]*time.Location{},
+		periods:   map[string]map[string]map[int64]Totals{},
+	}
+}
+
+// getLocation returns the IANA timezone called name.
+func (za *ZonedAggregates) getLocation(name string) (*time.Location, error) {
+	za.mu.Lock()
+	defer za.mu.Unlock()
+
+	if location, ok := za.locations[name]; ok {
+		return location, nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil || name == "" || name == "Local" {
+		return nil, invalidParamsErrorf("timezone '%s' is not an IANA timezone", name)
+	}
+
+	if len(za.locations) >= maxCachedTimezones {
+		za.locations = map[string]*time.Location{}
+		za.periods = map[string]map[string]map[int64]Totals{}
+	}
+	za.locations[name] = location
+
+	return location, nil
+}
+
+func (za *ZonedAggregates) getPeriod(zone string, granularity string, start int64) (Totals, bool) {
+	za.mu.Lock()
+	defer za.mu.Unlock()
+
+	totals, ok := za.periods[zone][granularity][start]
+
+	return totals, ok
+}
+
+func (za *ZonedAggregates) addPeriod(zone string, granularity string, start int64, totals Totals) {
+	za.mu.Lock()
+	defer za.mu.Unlock()
+
+	if _, ok := za.periods[zone]; !ok {
+		za.periods[zone] = map[string]map[int64]Totals{}
+	}
+	if _, ok := za.periods[zone][granularity]; !ok {
+		za.periods[zone][granularity] = map[int64]Totals{}
+	}
+	za.periods[zone][granularity][start] = totals
+}
+
+// reset drops every cached period.
+func (za *ZonedAggregates) reset() {
+	za.mu.Lock()
+	defer za.mu.Unlock()
+
+	za.periods = map[string]map[string]map[int64]Totals{}
+}
+
+// getZonedAggregates returns the latest periodCount periods of granularity g
+// in the timezone called zone, from the latest to the earliest.
+func (s *Stats) getZonedAggregates(g Granularity, zone string, periodCount int) ([]Totals, error) {
+	location, err := s.zonedAggregates.getLocation(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	latestBlockNumber := s.latestBlock.getBlockNumber()
+	latestBlockTime, err := s.getBlockTimestamp(latestBlockNumber)
+	if err != nil {
+		return nil, notReadyErrorf("latest block %d is not processed yet", latestBlockNumber)
+	}
+
+	periods := []Totals{}
+
+	startPeriod := g.start(time.Unix(int64(latestBlockTime), 0).In(location))
+	for len(periods) < periodCount {
+		endPeriod := g.next(startPeriod)
+		if uint64(endPeriod.Unix()) <= s.londonTimestamp {
+			break
+		}
+
+		// the period ended once a block was produced after it
+		ended := uint64(endPeriod.Unix()) <= latestBlockTime
+
+		totals, ok := s.zonedAggregates.getPeriod(zone, g.Name, startPeriod.Unix())
+		if !ok || !ended {
+			totals, err = s.getPeriodTotals(g, startPeriod)
+			if err != nil {
+				return nil, err
+			}
+
+			if ended {
+				s.zonedAggregates.addPeriod(zone, g.Name, startPeriod.Unix(), totals)
+			}
+		}
+		periods = append(periods, totals)
+
+		startPeriod = g.start(startPeriod.Add(-time.Second))
+	}
+
+	return periods, nil
+}
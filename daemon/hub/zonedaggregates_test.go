@@ -0,0 +1,102 @@
+package hub
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mohamedmansour/ethereum-burn-stats/daemon/sql"
+)
+
+// hourlyBlock returns the stats of a block produced at timestamp burning
+// burned wei.
+func hourlyBlock(blockNumber uint64, timestamp time.Time, burned int64) sql.BlockStats {
+	return sql.BlockStats{
+		Number:    uint(blockNumber),
+		Timestamp: uint64(timestamp.Unix()),
+		Hash:      fmt.Sprintf("0x%064x", blockNumber),
+		BaseFee:   sql.NewBig(big.NewInt(fakeBaseFee)),
+		Burned:    sql.NewBig(big.NewInt(burned)),
+		Rewards:   sql.NewBig(big.NewInt(0)),
+		Tips:      sql.NewBig(big.NewInt(0)),
+		GasTarget: 15_000_000,
+		GasUsed:   15_000_000,
+	}
+}
+
+func TestGetZonedAggregatesDaylightSaving(t *testing.T) {
+	node := &fakeNode{}
+	node.setChain("a", testLondonBlock-1, testLondonBlock-1)
+	s := newTestStats(t, node)
+
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a block burning 1 wei every hour from 2021-11-06 to 2021-11-09 in new
+	// york, whose clock is set back on 2021-11-07, so the days before and
+	// after have 24 blocks and the 7th 25
+	first := time.Date(2021, 11, 6, 0, 0, 0, 0, location)
+	last := time.Date(2021, 11, 9, 0, 0, 0, 0, location)
+	blockNumber := uint64(testLondonBlock)
+	fallBackBlock := uint64(0)
+	for timestamp := first; !timestamp.After(last); timestamp = timestamp.Add(time.Hour) {
+		s.blocks.addBlocks(hourlyBlock(blockNumber, timestamp, 1))
+		if fallBackBlock == 0 && timestamp.Day() == 7 {
+			fallBackBlock = blockNumber
+		}
+		blockNumber++
+	}
+	s.latestBlock.updateBlockNumber(blockNumber - 1)
+
+	day, _ := getGranularity("day")
+	checkDays := func(want []string) {
+		t.Helper()
+
+		days, err := s.getZonedAggregates(day, "America/New_York", len(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(days) != len(want) {
+			t.Fatalf("%d days, want %d", len(days), len(want))
+		}
+		for i := range want {
+			if days[i].Burned != want[i] {
+				t.Errorf("day %d burned %s, want %s", i, days[i].Burned, want[i])
+			}
+		}
+	}
+
+	// the latest day only has its first block
+	checkDays([]string{"0x1", "0x18", "0x19", "0x18"})
+
+	days, err := s.getZonedAggregates(day, "America/New_York", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if days[2].Duration != 25*3600 {
+		t.Errorf("duration of 2021-11-07 is %d, want %d", days[2].Duration, 25*3600)
+	}
+
+	// the month holds every block
+	month, _ := getGranularity("month")
+	months, err := s.getZonedAggregates(month, "America/New_York", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if months[0].Burned != "0x4a" {
+		t.Errorf("november burned %s, want 0x4a", months[0].Burned)
+	}
+
+	// the ended days are cached until the totals are refreshed
+	s.blocks.addBlocks(hourlyBlock(fallBackBlock, first.AddDate(0, 0, 1), 2))
+	checkDays([]string{"0x1", "0x18", "0x19", "0x18"})
+
+	err = s.refreshAggregateTotals(fallBackBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDays([]string{"0x1", "0x18", "0x1a", "0x18"})
+}
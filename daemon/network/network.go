@@ -0,0 +1,174 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+)
+
+// BlockReward is the base reward paid to miners starting at Block, in wei.
+type BlockReward struct {
+	Block  uint64 `json:"block"`
+	Reward string `json:"reward"`
+}
+
+// BlobSchedule is the blob base fee update fraction of the blocks produced
+// from Timestamp, as defined in EIP-4844 and changed by later forks.
+type BlobSchedule struct {
+	Timestamp      uint64 `json:"timestamp"`
+	UpdateFraction uint64 `json:"updateFraction"`
+}
+
+// cancunUpdateFraction is the blob base fee update fraction of EIP-4844, used
+// when the config has no blob schedule.
+const cancunUpdateFraction = 3_338_477
+
+// Config describes the chain the daemon tracks. Fork timestamps left at zero
+// are read from the node at startup.
+type Config struct {
+	Name    string `json:"name"`
+	ChainID uint64 `json:"chainId"`
+
+	// GenesisSupply is the ether allocated in the genesis block, in wei. The
+	// supply is not reported when it is empty.
+	GenesisSupply string        `json:"genesisSupply,omitempty"`
+	BlockRewards  []BlockReward `json:"blockRewards,omitempty"`
+
+	LondonBlock     uint64 `json:"londonBlock"`
+	LondonTimestamp uint64 `json:"londonTimestamp,omitempty"`
+
+	// ParisBlock is the first proof of stake block, nil if the network has
+	// not merged yet.
+	ParisBlock     *uint64 `json:"parisBlock,omitempty"`
+	ParisTimestamp uint64  `json:"parisTimestamp,omitempty"`
+
+	// BlobSchedule lists the update fractions of cancun and the forks after
+	// it that changed the blob parameters.
+	BlobSchedule []BlobSchedule `json:"blobSchedule,omitempty"`
+
+	genesisSupply *big.Int
+	blockRewards  []*big.Int
+}
+
+// Load returns the built-in profile called name, or the config stored in the
+// JSON file at path when one is given.
+func Load(name string, path string) (*Config, error) {
+	var config Config
+
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read network config %s: %v", path, err)
+		}
+
+		err = json.Unmarshal(b, &config)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse network config %s: %v", path, err)
+		}
+	} else {
+		profile, ok := profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown network '%s', use one of %v or --network-config", name, Names())
+		}
+		config = profile
+	}
+
+	err := config.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid network config '%s': %v", config.Name, err)
+	}
+
+	return &config, nil
+}
+
+// Names returns the names of the built-in profiles.
+func Names() []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (c *Config) validate() error {
+	if c.ChainID == 0 {
+		return fmt.Errorf("chainId is required")
+	}
+
+	c.genesisSupply = nil
+	if c.GenesisSupply != "" {
+		genesisSupply, ok := new(big.Int).SetString(c.GenesisSupply, 10)
+		if !ok || genesisSupply.Sign() < 0 {
+			return fmt.Errorf("genesisSupply is not a number - %s", c.GenesisSupply)
+		}
+		c.genesisSupply = genesisSupply
+	}
+
+	sort.Slice(c.BlockRewards, func(i, j int) bool { return c.BlockRewards[i].Block < c.BlockRewards[j].Block })
+
+	c.blockRewards = nil
+	for _, r := range c.BlockRewards {
+		reward, ok := new(big.Int).SetString(r.Reward, 10)
+		if !ok {
+			return fmt.Errorf("block reward at block %d is not a number - %s", r.Block, r.Reward)
+		}
+		c.blockRewards = append(c.blockRewards, reward)
+	}
+
+	sort.Slice(c.BlobSchedule, func(i, j int) bool { return c.BlobSchedule[i].Timestamp < c.BlobSchedule[j].Timestamp })
+
+	for _, b := range c.BlobSchedule {
+		if b.UpdateFraction == 0 {
+			return fmt.Errorf("blob update fraction at timestamp %d is zero", b.Timestamp)
+		}
+	}
+
+	return nil
+}
+
+// IsParis returns true if blockNumber is a proof of stake block.
+func (c *Config) IsParis(blockNumber uint64) bool {
+	return c.ParisBlock != nil && blockNumber >= *c.ParisBlock
+}
+
+// GetBlockReward returns the base reward of blockNumber, in wei.
+func (c *Config) GetBlockReward(blockNumber uint64) *big.Int {
+	baseReward := big.NewInt(0)
+	if c.IsParis(blockNumber) {
+		return baseReward
+	}
+
+	for i := len(c.BlockRewards) - 1; i >= 0; i-- {
+		if blockNumber >= c.BlockRewards[i].Block {
+			return baseReward.Set(c.blockRewards[i])
+		}
+	}
+
+	return baseReward
+}
+
+// GetGenesisSupply returns the ether allocated in the genesis block, in wei,
+// false if it is not known.
+func (c *Config) GetGenesisSupply() (*big.Int, bool) {
+	if c.genesisSupply == nil {
+		return nil, false
+	}
+
+	return new(big.Int).Set(c.genesisSupply), true
+}
+
+// GetBlobUpdateFraction returns the blob base fee update fraction of the
+// blocks produced at timestamp.
+func (c *Config) GetBlobUpdateFraction(timestamp uint64) uint64 {
+	for i := len(c.BlobSchedule) - 1; i >= 0; i-- {
+		if timestamp >= c.BlobSchedule[i].Timestamp {
+			return c.BlobSchedule[i].UpdateFraction
+		}
+	}
+
+	return cancunUpdateFraction
+}
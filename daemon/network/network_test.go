@@ -0,0 +1,91 @@
+package network
+
+import (
+	"testing"
+)
+
+func TestGetBlobUpdateFraction(t *testing.T) {
+	mainnet, err := Load("mainnet", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		timestamp      uint64
+		updateFraction uint64
+	}{
+		{1710338135, 3_338_477},
+		{1746612310, 3_338_477},
+		{1746612311, 5_007_716},
+		{1765290070, 5_007_716},
+		{1765290071, 8_346_193},
+		{1767747671, 11_684_671},
+		{1800000000, 11_684_671},
+	}
+
+	for _, test := range tests {
+		if updateFraction := mainnet.GetBlobUpdateFraction(test.timestamp); updateFraction != test.updateFraction {
+			t.Errorf("update fraction at %d is %d, want %d", test.timestamp, updateFraction, test.updateFraction)
+		}
+	}
+
+	// a config without a blob schedule uses the fraction of cancun
+	if updateFraction := (&Config{}).GetBlobUpdateFraction(1800000000); updateFraction != 3_338_477 {
+		t.Errorf("update fraction without a blob schedule is %d, want 3338477", updateFraction)
+	}
+}
+
+func TestValidateBlobSchedule(t *testing.T) {
+	config := Config{
+		ChainID: 1337,
+		BlobSchedule: []BlobSchedule{
+			{Timestamp: 200, UpdateFraction: 8_346_193},
+			{Timestamp: 100, UpdateFraction: 5_007_716},
+		},
+	}
+	err := config.validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updateFraction := config.GetBlobUpdateFraction(150); updateFraction != 5_007_716 {
+		t.Errorf("update fraction at 150 is %d, want 5007716", updateFraction)
+	}
+
+	config.BlobSchedule = append(config.BlobSchedule, BlobSchedule{Timestamp: 300})
+	if config.validate() == nil {
+		t.Error("blob schedule with a zero update fraction is valid")
+	}
+}
+
+func TestValidateGenesisSupply(t *testing.T) {
+	mainnet, err := Load("mainnet", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesisSupply, ok := mainnet.GetGenesisSupply()
+	if !ok || genesisSupply.String() != "72009990499480000000000000" {
+		t.Errorf("genesis supply of mainnet is %v, want 72009990499480000000000000", genesisSupply)
+	}
+
+	// the supply returned can be changed by the caller
+	genesisSupply.SetInt64(0)
+	if genesisSupply, _ := mainnet.GetGenesisSupply(); genesisSupply.Sign() == 0 {
+		t.Error("genesis supply of mainnet was changed")
+	}
+
+	config := Config{ChainID: 1337}
+	err = config.validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.GetGenesisSupply(); ok {
+		t.Error("genesis supply is known without being set")
+	}
+
+	for _, genesisSupply := range []string{"1e18", "0x10", "-1"} {
+		config.GenesisSupply = genesisSupply
+		if config.validate() == nil {
+			t.Errorf("genesis supply %s is valid", genesisSupply)
+		}
+	}
+}
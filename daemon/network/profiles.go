@@ -0,0 +1,59 @@
+package network
+
+func newUint64(v uint64) *uint64 {
+	return &v
+}
+
+var profiles = map[string]Config{
+	"mainnet": {
+		Name:          "mainnet",
+		ChainID:       1,
+		GenesisSupply: "72009990499480000000000000",
+		BlockRewards: []BlockReward{
+			{Block: 0, Reward: "5000000000000000000"},
+			{Block: 4_370_000, Reward: "3000000000000000000"},
+			{Block: 7_280_000, Reward: "2000000000000000000"},
+		},
+		LondonBlock:     12_965_000,
+		LondonTimestamp: 1628166822,
+		ParisBlock:      newUint64(15_537_394),
+		ParisTimestamp:  1663224179,
+		BlobSchedule: []BlobSchedule{
+			{Timestamp: 1710338135, UpdateFraction: 3_338_477},  // cancun
+			{Timestamp: 1746612311, UpdateFraction: 5_007_716},  // prague
+			{Timestamp: 1765290071, UpdateFraction: 8_346_193},  // bpo1
+			{Timestamp: 1767747671, UpdateFraction: 11_684_671}, // bpo2
+		},
+	},
+	"sepolia": {
+		// the genesis allocations are not summed yet, so the supply is
+		// not reported, a network config can set genesisSupply
+		Name:    "sepolia",
+		ChainID: 11155111,
+		BlockRewards: []BlockReward{
+			{Block: 0, Reward: "2000000000000000000"},
+		},
+		LondonBlock: 0,
+		ParisBlock:  newUint64(1_450_409),
+		BlobSchedule: []BlobSchedule{
+			{Timestamp: 1706655072, UpdateFraction: 3_338_477},  // cancun
+			{Timestamp: 1741159776, UpdateFraction: 5_007_716},  // prague
+			{Timestamp: 1761017184, UpdateFraction: 8_346_193},  // bpo1
+			{Timestamp: 1761607008, UpdateFraction: 11_684_671}, // bpo2
+		},
+	},
+	"holesky": {
+		// the genesis allocations are not summed yet, so the supply is
+		// not reported, a network config can set genesisSupply
+		Name:        "holesky",
+		ChainID:     17000,
+		LondonBlock: 0,
+		ParisBlock:  newUint64(0),
+		BlobSchedule: []BlobSchedule{
+			{Timestamp: 1707305664, UpdateFraction: 3_338_477},  // cancun
+			{Timestamp: 1740434112, UpdateFraction: 5_007_716},  // prague
+			{Timestamp: 1759800000, UpdateFraction: 8_346_193},  // bpo1
+			{Timestamp: 1760389824, UpdateFraction: 11_684_671}, // bpo2
+		},
+	},
+}
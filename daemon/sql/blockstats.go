@@ -1,15 +1,47 @@
 package sql
 
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
 type BlockStats struct {
 	Number            uint   `json:"number" gorm:"primaryKey;autoIncrement:false"`
 	Timestamp         uint64 `json:"timestamp"`
-	BaseFee           string `json:"baseFee"`
-	Burned            string `json:"burned"`
-	GasTarget         string `json:"gasTarget"`
-	GasUsed           string `json:"gasUsed"`
-	PriorityFee       string `json:"priorityFee"`
-	Rewards           string `json:"rewards"`
-	Tips              string `json:"tips"`
-	Transactions      string `json:"transactions"`
-	Type2Transactions string `json:"type2transactions"`
+	Hash              string `json:"hash"`
+	ParentHash        string `json:"parentHash"`
+	BaseFee           Big    `json:"baseFee"`
+	BlobBaseFee       Big    `json:"blobBaseFee"`
+	BlobBurned        Big    `json:"blobBurned"`
+	BlobGasUsed       Uint64 `json:"blobGasUsed"`
+	Burned            Big    `json:"burned"`
+	GasTarget         Uint64 `json:"gasTarget"`
+	GasUsed           Uint64 `json:"gasUsed"`
+	GasUsedPercentage uint   `json:"-"`
+	PriorityFee       Big    `json:"priorityFee"`
+	Rewards           Big    `json:"rewards"`
+	Tips              Big    `json:"tips"`
+	Transactions      Uint64 `json:"transactions"`
+	Type2Transactions Uint64 `json:"type2transactions"`
+	Type3Transactions Uint64 `json:"type3transactions"`
+
+	// USDPrice is the ETH/USD price when the block was produced, 0 if it is
+	// not known.
+	USDPrice float64 `json:"usdPrice" gorm:"default:0"`
+
+	// UpdatedAt is when the block was last written in unix nanoseconds, the
+	// read-only daemons read the blocks written again since they last polled.
+	UpdatedAt int64 `json:"-" gorm:"index;default:0"`
+}
+
+// BeforeSave fills in the columns derived from the block.
+func (b *BlockStats) BeforeSave(tx *gorm.DB) error {
+	b.GasUsedPercentage = 0
+	if b.GasTarget != 0 {
+		b.GasUsedPercentage = uint(float64(b.GasUsed) / float64(b.GasTarget*2) * 100)
+	}
+	b.UpdatedAt = time.Now().UnixNano()
+
+	return nil
 }
@@ -0,0 +1,8 @@
+package sql
+
+// Checkpoint is the last block a backfill committed, blocks are committed in
+// order so every block up to it is stored.
+type Checkpoint struct {
+	Name        string `json:"name" gorm:"primaryKey"`
+	BlockNumber uint64 `json:"blockNumber"`
+}
@@ -1,9 +1,12 @@
 package sql
 
 import (
+	"strings"
+	"time"
 
 	//"github.com/ethereum/go-ethereum/core/types"
 
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -13,24 +16,24 @@ type Database struct {
 	db *gorm.DB
 }
 
-func ConnectDatabase(dbPath string) (*Database, error) {
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+// ConnectDatabase opens the SQLite file at dsn, or the Postgres database when
+// dsn is a postgres:// URL, and migrates its schema to the latest version.
+func ConnectDatabase(dsn string) (*Database, error) {
+	dialector := sqlite.Open(dsn)
+	if isPostgresDSN(dsn) {
+		dialector = postgres.Open(dsn)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
 		CreateBatchSize: 100,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if !db.Migrator().HasTable(&BlockStats{}) {
-		db.Migrator().CreateTable(&BlockStats{})
-	} else {
-		db.Migrator().AutoMigrate(BlockStats{})
-	}
-
-	if !db.Migrator().HasTable(&BlockStatsPercentiles{}) {
-		db.Migrator().CreateTable(&BlockStatsPercentiles{})
-	} else {
-		db.Migrator().AutoMigrate(BlockStats{})
+	err = migrate(db)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Database{
@@ -38,59 +41,254 @@ func ConnectDatabase(dbPath string) (*Database, error) {
 	}, nil
 }
 
-func (d *Database) AddBlock(blockStats BlockStats, blockStatsPercentiles []BlockStatsPercentiles) {
+// isPostgresDSN returns true if dsn points to a Postgres database instead of
+// a SQLite file.
+func isPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+func (d *Database) AddBlock(blockStats BlockStats, blockStatsPercentiles []BlockStatsPercentiles) error {
 	if blockStats.Number == 0 {
-		return
+		return nil
 	}
-	d.db.Clauses(clause.OnConflict{
+
+	result := d.db.Clauses(clause.OnConflict{
 		UpdateAll: true,
-	}).Create(blockStats)
+	}).Create(&blockStats)
+	if result.Error != nil {
+		return result.Error
+	}
+
 	for _, b := range blockStatsPercentiles {
-		d.db.Clauses(clause.OnConflict{
+		result = d.db.Clauses(clause.OnConflict{
+			UpdateAll: true,
+		}).Create(&b)
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+
+	return nil
+}
+
+func (d *Database) AddBlocks(blockStats []BlockStats, blockStatsPercentiles []BlockStatsPercentiles) error {
+	result := d.db.CreateInBatches(blockStats, len(blockStats))
+	if result.Error != nil {
+		return result.Error
+	}
+
+	result = d.db.CreateInBatches(blockStatsPercentiles, len(blockStatsPercentiles))
+
+	return result.Error
+}
+
+// AddBlocksWithCheckpoint stores the blocks and moves the checkpoint called
+// name to blockNumber in a single transaction.
+func (d *Database) AddBlocksWithCheckpoint(name string, blockNumber uint64, blockStats []BlockStats, blockStatsPercentiles []BlockStatsPercentiles) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if len(blockStats) > 0 {
+			result := tx.Clauses(clause.OnConflict{
+				UpdateAll: true,
+			}).CreateInBatches(blockStats, len(blockStats))
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		if len(blockStatsPercentiles) > 0 {
+			result := tx.Clauses(clause.OnConflict{
+				UpdateAll: true,
+			}).CreateInBatches(blockStatsPercentiles, len(blockStatsPercentiles))
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		result := tx.Clauses(clause.OnConflict{
 			UpdateAll: true,
-		}).Create(b)
+		}).Create(&Checkpoint{Name: name, BlockNumber: blockNumber})
+
+		return result.Error
+	})
+}
+
+func (d *Database) GetCheckpoint(name string) (uint64, bool, error) {
+	var checkpoints []Checkpoint
+
+	result := d.db.Where("name = ?", name).Limit(1).Find(&checkpoints)
+	if result.Error != nil {
+		return 0, false, result.Error
+	}
+
+	if len(checkpoints) == 0 {
+		return 0, false, nil
 	}
+
+	return checkpoints[0].BlockNumber, true, nil
+}
+
+// SetCheckpoint moves the checkpoint called name to blockNumber.
+func (d *Database) SetCheckpoint(name string, blockNumber uint64) error {
+	result := d.db.Clauses(clause.OnConflict{
+		UpdateAll: true,
+	}).Create(&Checkpoint{Name: name, BlockNumber: blockNumber})
+
+	return result.Error
+}
+
+// DeleteCheckpoint deletes the checkpoint called name.
+func (d *Database) DeleteCheckpoint(name string) error {
+	result := d.db.Where("name = ?", name).Delete(&Checkpoint{})
+
+	return result.Error
+}
+
+// RewindCheckpoint moves the checkpoint called name back to blockNumber if it
+// is after it.
+func (d *Database) RewindCheckpoint(name string, blockNumber uint64) error {
+	result := d.db.Model(&Checkpoint{}).Where("name = ? AND block_number > ?", name, blockNumber).Update("block_number", blockNumber)
+
+	return result.Error
+}
+
+// advanceCheckpoint moves the checkpoint called name to toBlock when it already
+// covers every block before fromBlock, so it never skips over a gap.
+func advanceCheckpoint(tx *gorm.DB, name string, fromBlock uint64, toBlock uint64) error {
+	result := tx.Model(&Checkpoint{}).Where("name = ? AND block_number >= ? AND block_number < ?", name, fromBlock-1, toBlock).Update("block_number", toBlock)
+
+	return result.Error
 }
 
-func (d *Database) AddBlocks(blockStats []BlockStats, blockStatsPercentiles []BlockStatsPercentiles) {
-	d.db.CreateInBatches(blockStats, len(blockStats))
-	d.db.CreateInBatches(blockStatsPercentiles, len(blockStatsPercentiles))
+func (d *Database) DeleteBlocksAfter(blockNumber uint64) error {
+	result := d.db.Where("number > ?", blockNumber).Delete(&BlockStats{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	result = d.db.Where("number > ?", blockNumber).Delete(&BlockStatsPercentiles{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// backfills must fetch the deleted blocks again when resuming
+	result = d.db.Model(&Checkpoint{}).Where("block_number > ?", blockNumber).Update("block_number", blockNumber)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
 }
 
 func (d *Database) GetHighestBlockNumber() (uint64, error) {
+	var blockNumbers []uint64
+	result := d.db.Model(&BlockStats{}).Order("number desc").Limit(1).Pluck("number", &blockNumbers)
+	if result.Error != nil || len(blockNumbers) == 0 {
+		return 0, nil
+	}
+
+	return blockNumbers[0], nil
+}
+
+// EachBlockStats calls fn with every stored block in order, batchSize blocks
+// at a time, so they are never all held in memory.
+func (d *Database) EachBlockStats(batchSize int, fn func(blockStats []BlockStats) error) error {
+	var blockStats []BlockStats
+
+	result := d.db.Order("number").FindInBatches(&blockStats, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(blockStats)
+	})
+
+	return result.Error
+}
+
+func (d *Database) GetBlockStats(blockNumber uint64) (BlockStats, bool, error) {
 	var blockStats []BlockStats
-	result := d.db.Last(&blockStats)
+
+	result := d.db.Where("number = ?", blockNumber).Limit(1).Find(&blockStats)
 	if result.Error != nil {
-		return 0, nil
+		return BlockStats{}, false, result.Error
 	}
 
-	highestBlockNumber := uint64(blockStats[0].Number)
+	if len(blockStats) == 0 {
+		return BlockStats{}, false, nil
+	}
 
-	return highestBlockNumber, nil
+	return blockStats[0], true, nil
 }
 
-func (d *Database) GetAllBlockStats() ([]BlockStats, error) {
+// GetBlockStatsRange returns the stored blocks fromBlock -> toBlock, both
+// included.
+func (d *Database) GetBlockStatsRange(fromBlock uint64, toBlock uint64) ([]BlockStats, error) {
 	var blockStats []BlockStats
 
-	result := d.db.Find(&blockStats)
+	result := d.db.Where("number >= ? AND number <= ?", fromBlock, toBlock).Order("number").Find(&blockStats)
 	if result.Error != nil {
-		return []BlockStats{}, nil
+		return []BlockStats{}, result.Error
 	}
 
 	return blockStats, nil
 }
 
-func (d *Database) GetMissingBlockNumbers(startingBlockNumber uint64) ([]uint64, error) {
+// GetBlockStatsPercentilesRange returns the stored percentiles of the blocks
+// fromBlock -> toBlock, both included.
+func (d *Database) GetBlockStatsPercentilesRange(fromBlock uint64, toBlock uint64) ([]BlockStatsPercentiles, error) {
+	var blockStatsPercentiles []BlockStatsPercentiles
+
+	result := d.db.Where("number >= ? AND number <= ?", fromBlock, toBlock).Order("number").Find(&blockStatsPercentiles)
+	if result.Error != nil {
+		return []BlockStatsPercentiles{}, result.Error
+	}
+
+	return blockStatsPercentiles, nil
+}
+
+func (d *Database) GetBlockStatsAfter(blockNumber uint64) ([]BlockStats, error) {
 	var blockStats []BlockStats
-	var blockNumbers, missingBlockNumbers []uint64
 
-	result := d.db.Find(&blockStats)
+	result := d.db.Where("number > ?", blockNumber).Order("number").Find(&blockStats)
 	if result.Error != nil {
-		return missingBlockNumbers, result.Error
+		return []BlockStats{}, result.Error
+	}
+
+	return blockStats, nil
+}
+
+// GetBlockStatsUpdatedAfter returns the stored blocks up to toBlock written
+// after updatedAt, in unix nanoseconds.
+func (d *Database) GetBlockStatsUpdatedAfter(updatedAt int64, toBlock uint64) ([]BlockStats, error) {
+	var blockStats []BlockStats
+
+	result := d.db.Where("updated_at > ? AND number <= ?", updatedAt, toBlock).Order("number").Find(&blockStats)
+	if result.Error != nil {
+		return []BlockStats{}, result.Error
+	}
+
+	return blockStats, nil
+}
+
+// GetLatestBlockUpdate returns when a block was last written in unix
+// nanoseconds, 0 if none was.
+func (d *Database) GetLatestBlockUpdate() (int64, error) {
+	var updatedAt []int64
+
+	result := d.db.Model(&BlockStats{}).Order("updated_at desc").Limit(1).Pluck("updated_at", &updatedAt)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if len(updatedAt) == 0 {
+		return 0, nil
 	}
 
-	for _, b := range blockStats {
-		blockNumbers = append(blockNumbers, uint64(b.Number))
+	return updatedAt[0], nil
+}
+
+func (d *Database) GetMissingBlockNumbers(startingBlockNumber uint64) ([]uint64, error) {
+	var blockNumbers, missingBlockNumbers []uint64
+
+	result := d.db.Model(&BlockStats{}).Order("number").Pluck("number", &blockNumbers)
+	if result.Error != nil {
+		return missingBlockNumbers, result.Error
 	}
 
 	for i := 1; i < len(blockNumbers); i++ {
@@ -106,3 +304,114 @@ func (d *Database) GetMissingBlockNumbers(startingBlockNumber uint64) ([]uint64,
 
 	return missingBlockNumbers, nil
 }
+
+func (d *Database) AddEpochs(epochStats []EpochStats) error {
+	if len(epochStats) == 0 {
+		return nil
+	}
+
+	result := d.db.Clauses(clause.OnConflict{
+		UpdateAll: true,
+	}).CreateInBatches(epochStats, len(epochStats))
+
+	return result.Error
+}
+
+func (d *Database) GetAllEpochStats() ([]EpochStats, error) {
+	var epochStats []EpochStats
+
+	result := d.db.Order("epoch").Find(&epochStats)
+	if result.Error != nil {
+		return []EpochStats{}, result.Error
+	}
+
+	return epochStats, nil
+}
+
+func (d *Database) GetEpochStatsAfter(epoch uint64) ([]EpochStats, error) {
+	var epochStats []EpochStats
+
+	result := d.db.Where("epoch > ?", epoch).Order("epoch").Find(&epochStats)
+	if result.Error != nil {
+		return []EpochStats{}, result.Error
+	}
+
+	return epochStats, nil
+}
+
+// AddPeriodTotals stores the totals of periods computed from the blocks
+// fromBlock -> toBlock, and advances the checkpoint called name to toBlock.
+func (d *Database) AddPeriodTotals(name string, fromBlock uint64, toBlock uint64, periodTotals []PeriodTotals) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if len(periodTotals) > 0 {
+			result := tx.Clauses(clause.OnConflict{
+				UpdateAll: true,
+			}).CreateInBatches(periodTotals, 1000)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		return advanceCheckpoint(tx, name, fromBlock, toBlock)
+	})
+}
+
+// DeletePeriodTotalsAfter removes the periods that start after timestamp.
+func (d *Database) DeletePeriodTotalsAfter(timestamp uint64) error {
+	result := d.db.Where("start_time > ?", timestamp).Delete(&PeriodTotals{})
+
+	return result.Error
+}
+
+func (d *Database) GetAllPeriodTotals() ([]PeriodTotals, error) {
+	var periodTotals []PeriodTotals
+
+	result := d.db.Order("unit").Order("start_time").Find(&periodTotals)
+	if result.Error != nil {
+		return []PeriodTotals{}, result.Error
+	}
+
+	return periodTotals, nil
+}
+
+// AddUSDPrices stores prices, replacing the ones starting at the same time.
+func (d *Database) AddUSDPrices(usdPrices []USDPrice) error {
+	if len(usdPrices) == 0 {
+		return nil
+	}
+
+	result := d.db.Clauses(clause.OnConflict{
+		UpdateAll: true,
+	}).CreateInBatches(usdPrices, 1000)
+
+	return result.Error
+}
+
+func (d *Database) GetAllUSDPrices() ([]USDPrice, error) {
+	var usdPrices []USDPrice
+
+	result := d.db.Order("timestamp").Find(&usdPrices)
+	if result.Error != nil {
+		return []USDPrice{}, result.Error
+	}
+
+	return usdPrices, nil
+}
+
+// SetBlockUSDPrices updates the USD price of stored blocks in a single
+// transaction.
+func (d *Database) SetBlockUSDPrices(blockStats []BlockStats) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		for _, b := range blockStats {
+			result := tx.Model(&BlockStats{}).Where("number = ?", b.Number).UpdateColumns(map[string]interface{}{
+				"usd_price":  b.USDPrice,
+				"updated_at": time.Now().UnixNano(),
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,7 @@
+package sql
+
+type EpochStats struct {
+	Epoch     uint   `json:"epoch" gorm:"primaryKey;autoIncrement:false"`
+	Timestamp uint64 `json:"timestamp"`
+	Issuance  Big    `json:"issuance"`
+}
@@ -0,0 +1,416 @@
+package sql
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// SchemaMigration is a migration applied to the database.
+type SchemaMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt int64
+}
+
+type migration struct {
+	version uint
+	name    string
+	up      func(tx *gorm.DB) error
+}
+
+// migrations are applied in order and at most once. A released migration must
+// not change, add a new one instead.
+var migrations = []migration{
+	{1, "create hex tables", migrateCreateHexTables},
+	{2, "typed block_stats and epoch_stats", migrateTypedColumns},
+	{3, "create block_totals and period_totals", migrateCreateTotalsTables},
+	{4, "recompute period_totals with exact block boundaries", migrateClearPeriodTotals},
+	{5, "create usd_prices and add usd columns", migrateAddUSDColumns},
+	{6, "drop the backfill checkpoints not scoped to a range", migrateDropUnscopedCheckpoints},
+	{7, "drop block_totals", migrateDropBlockTotals},
+	{8, "add block_stats updated_at", migrateAddUpdatedAt},
+}
+
+// migrate applies the migrations the database has not seen yet, each one in
+// its own transaction.
+func migrate(db *gorm.DB) error {
+	err := createOrAddColumns(db, &SchemaMigration{})
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations: %v", err)
+	}
+
+	var versions []uint
+	result := db.Model(&SchemaMigration{}).Order("version desc").Limit(1).Pluck("version", &versions)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	version := uint(0)
+	if len(versions) > 0 {
+		version = versions[0]
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		start := time.Now()
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := m.up(tx)
+			if err != nil {
+				return err
+			}
+
+			return tx.Create(&SchemaMigration{
+				Version:   m.version,
+				Name:      m.name,
+				AppliedAt: time.Now().Unix(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("error applying migration %d '%s': %v", m.version, m.name, err)
+		}
+
+		logrus.Infof("applied migration %d '%s' in %s", m.version, m.name, time.Since(start).Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+// createOrAddColumns creates the table of model, or adds the columns it is
+// missing without changing the existing ones.
+func createOrAddColumns(tx *gorm.DB, model interface{}) error {
+	m := tx.Migrator()
+	if !m.HasTable(model) {
+		return m.CreateTable(model)
+	}
+
+	stmt := &gorm.Statement{DB: tx}
+	err := stmt.Parse(model)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range stmt.Schema.DBNames {
+		if !m.HasColumn(model, name) {
+			err = m.AddColumn(model, name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// hexBlockStats is a block_stats row before migration 2, quantities are hex
+// strings.
+type hexBlockStats struct {
+	Number            uint `gorm:"primaryKey;autoIncrement:false"`
+	Timestamp         uint64
+	Hash              string
+	ParentHash        string
+	BaseFee           string
+	BlobBaseFee       string
+	BlobBurned        string
+	BlobGasUsed       string
+	Burned            string
+	GasTarget         string
+	GasUsed           string
+	PriorityFee       string
+	Rewards           string
+	Tips              string
+	Transactions      string
+	Type2Transactions string
+	Type3Transactions string
+}
+
+func (hexBlockStats) TableName() string {
+	return "block_stats"
+}
+
+// hexEpochStats is an epoch_stats row before migration 2.
+type hexEpochStats struct {
+	Epoch     uint `gorm:"primaryKey;autoIncrement:false"`
+	Timestamp uint64
+	Issuance  string
+}
+
+func (hexEpochStats) TableName() string {
+	return "epoch_stats"
+}
+
+// migrateCreateHexTables creates the tables of databases created before the
+// migrations were versioned.
+func migrateCreateHexTables(tx *gorm.DB) error {
+	models := []interface{}{
+		&hexBlockStats{},
+		&BlockStatsPercentiles{},
+		&hexEpochStats{},
+		&Checkpoint{},
+	}
+
+	for _, model := range models {
+		err := createOrAddColumns(tx, model)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateTypedColumns converts the hex strings of block_stats and epoch_stats
+// to numeric columns. Postgres databases already store block_stats typed.
+func migrateTypedColumns(tx *gorm.DB) error {
+	hexColumns, err := hasTextColumn(tx, &hexBlockStats{}, "gas_used")
+	if err != nil {
+		return err
+	}
+
+	if !hexColumns {
+		err = createOrAddColumns(tx, &BlockStats{})
+		if err != nil {
+			return err
+		}
+	} else {
+		err = tx.Migrator().RenameTable("block_stats", "block_stats_hex")
+		if err != nil {
+			return err
+		}
+
+		err = tx.Migrator().CreateTable(&BlockStats{})
+		if err != nil {
+			return err
+		}
+
+		var rows []hexBlockStats
+		result := tx.Table("block_stats_hex").Order("number").FindInBatches(&rows, 10000, func(batch *gorm.DB, _ int) error {
+			blockStats := make([]BlockStats, len(rows))
+			for i, row := range rows {
+				b, err := fromHexBlockStats(row)
+				if err != nil {
+					return err
+				}
+				blockStats[i] = b
+			}
+
+			return tx.CreateInBatches(blockStats, 1000).Error
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		err = tx.Migrator().DropTable("block_stats_hex")
+		if err != nil {
+			return err
+		}
+	}
+
+	// epoch issuance was hex in every database
+	var epochRows []hexEpochStats
+	result := tx.Order("epoch").Find(&epochRows)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	err = tx.Migrator().DropTable(&hexEpochStats{})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Migrator().CreateTable(&EpochStats{})
+	if err != nil {
+		return err
+	}
+
+	epochStats := make([]EpochStats, len(epochRows))
+	for i, row := range epochRows {
+		issuance, err := decodeHexBig(row.Issuance)
+		if err != nil {
+			return fmt.Errorf("epoch %d: couldn't decode Issuance: %v", row.Epoch, err)
+		}
+
+		epochStats[i] = EpochStats{
+			Epoch:     row.Epoch,
+			Timestamp: row.Timestamp,
+			Issuance:  NewBig(issuance),
+		}
+	}
+
+	if len(epochStats) > 0 {
+		return tx.CreateInBatches(epochStats, 1000).Error
+	}
+
+	return nil
+}
+
+func hasTextColumn(tx *gorm.DB, model interface{}, name string) (bool, error) {
+	columnTypes, err := tx.Migrator().ColumnTypes(model)
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range columnTypes {
+		if c.Name() == name {
+			switch c.DatabaseTypeName() {
+			case "text", "TEXT", "varchar", "VARCHAR":
+				return true, nil
+			}
+			return false, nil
+		}
+	}
+
+	return false, fmt.Errorf("column %s not found", name)
+}
+
+func fromHexBlockStats(row hexBlockStats) (BlockStats, error) {
+	blockStats := BlockStats{
+		Number:     row.Number,
+		Timestamp:  row.Timestamp,
+		Hash:       row.Hash,
+		ParentHash: row.ParentHash,
+	}
+
+	bigs := []struct {
+		name  string
+		hex   string
+		value *Big
+	}{
+		{"BaseFee", row.BaseFee, &blockStats.BaseFee},
+		{"BlobBaseFee", row.BlobBaseFee, &blockStats.BlobBaseFee},
+		{"BlobBurned", row.BlobBurned, &blockStats.BlobBurned},
+		{"Burned", row.Burned, &blockStats.Burned},
+		{"PriorityFee", row.PriorityFee, &blockStats.PriorityFee},
+		{"Rewards", row.Rewards, &blockStats.Rewards},
+		{"Tips", row.Tips, &blockStats.Tips},
+	}
+
+	for _, b := range bigs {
+		v, err := decodeHexBig(b.hex)
+		if err != nil {
+			return blockStats, fmt.Errorf("block %d: couldn't decode %s: %v", row.Number, b.name, err)
+		}
+		*b.value = NewBig(v)
+	}
+
+	uints := []struct {
+		name  string
+		hex   string
+		value *Uint64
+	}{
+		{"BlobGasUsed", row.BlobGasUsed, &blockStats.BlobGasUsed},
+		{"GasTarget", row.GasTarget, &blockStats.GasTarget},
+		{"GasUsed", row.GasUsed, &blockStats.GasUsed},
+		{"Transactions", row.Transactions, &blockStats.Transactions},
+		{"Type2Transactions", row.Type2Transactions, &blockStats.Type2Transactions},
+		{"Type3Transactions", row.Type3Transactions, &blockStats.Type3Transactions},
+	}
+
+	for _, u := range uints {
+		v, err := decodeHexBig(u.hex)
+		if err != nil || !v.IsUint64() {
+			return blockStats, fmt.Errorf("block %d: couldn't decode %s: %s", row.Number, u.name, u.hex)
+		}
+		*u.value = Uint64(v.Uint64())
+	}
+
+	return blockStats, nil
+}
+
+// decodeHexBig decodes a hex quantity that can be negative, fields added after
+// a block was stored are empty.
+func decodeHexBig(hex string) (*big.Int, error) {
+	if hex == "" {
+		return big.NewInt(0), nil
+	}
+
+	if strings.HasPrefix(hex, "-") {
+		v, err := hexutil.DecodeBig(hex[1:])
+		if err != nil {
+			return nil, err
+		}
+		return v.Neg(v), nil
+	}
+
+	return hexutil.DecodeBig(hex)
+}
+
+// migrateCreateTotalsTables creates the tables storing the totals, so they are
+// not computed again from london on every start.
+func migrateCreateTotalsTables(tx *gorm.DB) error {
+	err := createOrAddColumns(tx, &BlockTotals{})
+	if err != nil {
+		return err
+	}
+
+	return createOrAddColumns(tx, &PeriodTotals{})
+}
+
+// migrateClearPeriodTotals drops the periods stored before they included
+// exactly the blocks produced during them, they are computed again on start.
+func migrateClearPeriodTotals(tx *gorm.DB) error {
+	return tx.Where("1 = 1").Delete(&PeriodTotals{}).Error
+}
+
+// migrateAddUSDColumns creates the table of the imported prices, and adds the
+// price of the blocks and the totals in USD. The price of the stored blocks is
+// not known, it is 0 until prices are imported.
+func migrateAddUSDColumns(tx *gorm.DB) error {
+	models := []interface{}{
+		&USDPrice{},
+		&BlockStats{},
+		&BlockTotals{},
+		&PeriodTotals{},
+	}
+
+	for _, model := range models {
+		err := createOrAddColumns(tx, model)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateDropUnscopedCheckpoints drops the backfill checkpoints named without
+// their range, a run of another range would resume from them.
+func migrateDropUnscopedCheckpoints(tx *gorm.DB) error {
+	return tx.Where("name IN ?", []string{"backfill", "reprocess", "latest", "missing"}).Delete(&Checkpoint{}).Error
+}
+
+// migrateDropBlockTotals drops the cumulative totals of every block and their
+// checkpoint. They were never read, the totals are computed from the blocks
+// loaded in memory.
+func migrateDropBlockTotals(tx *gorm.DB) error {
+	err := tx.Migrator().DropTable(&BlockTotals{})
+	if err != nil {
+		return err
+	}
+
+	return tx.Where("name = ?", "totals").Delete(&Checkpoint{}).Error
+}
+
+// migrateAddUpdatedAt adds when every block was last written, the stored
+// blocks were all written before the read-only daemons started following it.
+func migrateAddUpdatedAt(tx *gorm.DB) error {
+	err := createOrAddColumns(tx, &BlockStats{})
+	if err != nil {
+		return err
+	}
+
+	if tx.Migrator().HasIndex(&BlockStats{}, "UpdatedAt") {
+		return nil
+	}
+
+	return tx.Migrator().CreateIndex(&BlockStats{}, "UpdatedAt")
+}
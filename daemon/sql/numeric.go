@@ -0,0 +1,167 @@
+package sql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Big is an arbitrary precision quantity such as an amount of wei. It is
+// stored as a decimal and encoded as a hex string in JSON, like hexutil.Big.
+//
+// Postgres stores it as numeric. SQLite would store a numeric above int64 as a
+// lossy real, so it is stored as text there, CAST it to aggregate or compare.
+type Big big.Int
+
+// NewBig returns the Big of v, nil is zero.
+func NewBig(v *big.Int) Big {
+	if v == nil {
+		return Big{}
+	}
+
+	return Big(*new(big.Int).Set(v))
+}
+
+// ToInt returns a copy of b as a *big.Int.
+func (b Big) ToInt() *big.Int {
+	return new(big.Int).Set((*big.Int)(&b))
+}
+
+// String returns the decimal representation of b.
+func (b Big) String() string {
+	return (*big.Int)(&b).String()
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b Big) MarshalText() ([]byte, error) {
+	return hexutil.Big(b).MarshalText()
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, it accepts the negative
+// values MarshalText encodes with a leading '-'.
+func (b *Big) UnmarshalText(input []byte) error {
+	v, err := decodeHexBig(string(input))
+	if err != nil {
+		return err
+	}
+	*b = Big(*v)
+
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (b Big) Value() (driver.Value, error) {
+	return b.String(), nil
+}
+
+// Scan implements sql.Scanner.
+func (b *Big) Scan(src interface{}) error {
+	var decimal string
+
+	switch v := src.(type) {
+	case nil:
+		*b = Big{}
+		return nil
+	case int64:
+		*b = Big(*big.NewInt(v))
+		return nil
+	case string:
+		decimal = v
+	case []byte:
+		decimal = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into sql.Big", src)
+	}
+
+	value, ok := new(big.Int).SetString(decimal, 10)
+	if !ok {
+		return fmt.Errorf("cannot scan '%s' into sql.Big", decimal)
+	}
+	*b = Big(*value)
+
+	return nil
+}
+
+// GormDBDataType implements schema.GormDBDataTypeInterface.
+func (Big) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "numeric"
+	}
+
+	return "text"
+}
+
+// Uint64 is a quantity such as an amount of gas. It is stored as an integer
+// and encoded as a hex string in JSON, like hexutil.Uint64.
+type Uint64 uint64
+
+// MarshalText implements encoding.TextMarshaler.
+func (u Uint64) MarshalText() ([]byte, error) {
+	return hexutil.Uint64(u).MarshalText()
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (u *Uint64) UnmarshalJSON(input []byte) error {
+	return (*hexutil.Uint64)(u).UnmarshalJSON(input)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (u *Uint64) UnmarshalText(input []byte) error {
+	return (*hexutil.Uint64)(u).UnmarshalText(input)
+}
+
+// Value implements driver.Valuer.
+func (u Uint64) Value() (driver.Value, error) {
+	if u > 1<<63-1 {
+		return nil, fmt.Errorf("sql.Uint64 %d overflows int64", u)
+	}
+
+	return int64(u), nil
+}
+
+// Scan implements sql.Scanner.
+func (u *Uint64) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*u = 0
+	case int64:
+		*u = Uint64(v)
+	case string:
+		return u.scanString(v)
+	case []byte:
+		return u.scanString(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into sql.Uint64", src)
+	}
+
+	return nil
+}
+
+func (u *Uint64) scanString(src string) error {
+	v, err := strconv.ParseUint(src, 10, 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan '%s' into sql.Uint64", src)
+	}
+	*u = Uint64(v)
+
+	return nil
+}
+
+// GormDataType implements schema.GormDataTypeInterface.
+func (Uint64) GormDataType() string {
+	return string(schema.Uint)
+}
+
+// GormDBDataType implements schema.GormDBDataTypeInterface.
+func (Uint64) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "bigint"
+	}
+
+	return "integer"
+}
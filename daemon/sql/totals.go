@@ -0,0 +1,38 @@
+package sql
+
+// BlockTotals are the cumulative totals since london at the end of a block.
+// The USD amounts are in 1e-18 dollars, like the other amounts are in wei.
+// The table is only created and dropped by the migrations.
+type BlockTotals struct {
+	Number      uint   `json:"number" gorm:"primaryKey;autoIncrement:false"`
+	Duration    uint64 `json:"duration"`
+	BlobBurned  Big    `json:"blobBurned"`
+	Burned      Big    `json:"burned"`
+	BurnedUSD   Big    `json:"burnedUSD"`
+	Issuance    Big    `json:"issuance"`
+	IssuanceUSD Big    `json:"issuanceUSD"`
+	Rewards     Big    `json:"rewards"`
+	Tips        Big    `json:"tips"`
+	TipsUSD     Big    `json:"tipsUSD"`
+}
+
+// PeriodTotals are the totals of the blocks produced during an hour, a day or
+// a month, Unit is the name of the period.
+type PeriodTotals struct {
+	Unit             string `json:"unit" gorm:"primaryKey"`
+	StartTime        uint64 `json:"startTime" gorm:"primaryKey;autoIncrement:false"`
+	EndTime          uint64 `json:"endTime"`
+	Duration         uint64 `json:"duration"`
+	BlobBurned       Big    `json:"blobBurned"`
+	Burned           Big    `json:"burned"`
+	BurnedUSD        Big    `json:"burnedUSD"`
+	Issuance         Big    `json:"issuance"`
+	IssuanceUSD      Big    `json:"issuanceUSD"`
+	Rewards          Big    `json:"rewards"`
+	Tips             Big    `json:"tips"`
+	TipsUSD          Big    `json:"tipsUSD"`
+	BaseFeeMaximum   uint   `json:"baseFeeMaximum"`
+	BaseFeeMedian    uint   `json:"baseFeeMedian"`
+	BaseFeeMinimum   uint   `json:"baseFeeMinimum"`
+	BaseFeeNinetieth uint   `json:"baseFeeNinetieth"`
+}
@@ -0,0 +1,10 @@
+package sql
+
+// USDPrice is the ETH/USD price during the Duration seconds from Timestamp,
+// like a candle of an exchange.
+type USDPrice struct {
+	Timestamp uint64  `json:"timestamp" gorm:"primaryKey;autoIncrement:false"`
+	Duration  uint64  `json:"duration"`
+	Price     float64 `json:"price"`
+	Source    string  `json:"source"`
+}
@@ -62,6 +62,9 @@ const DefaultExplorerData = {
     clients: 0,
     version: 'NA',
     usdPrice: 1,
+    usdPriceTimestamp: 0,
+    prices: {},
+    priceTimestamps: {},
     currentBlock: 0,
     currentBaseFee: Zero,
     currentPriorityFee: Zero,
@@ -105,6 +108,11 @@ const CreateMemoryIndex = (initialData: InitialData): InMemoryIndex => {
     clients: initialData.clients,
     version: initialData.version,
     usdPrice: initialData.usdPrice,
+    usdPriceTimestamp: initialData.usdPriceTimestamp,
+    prices: initialData.prices || {},
+    priceTimestamps: initialData.priceTimestamps || {},
+    currency: initialData.currency,
+    price: initialData.price,
   }
 
   const session: BlockExplorerSession = {
@@ -130,7 +138,7 @@ const CreateMemoryIndex = (initialData: InitialData): InMemoryIndex => {
   }
 
   const insert = (data: BlockData) => {
-    const { block, totals, totalsHour, totalsDay, totalsWeek, totalsMonth, clients, version, usdPrice } = data
+    const { block, totals, totalsHour, totalsDay, totalsWeek, totalsMonth, clients, version, usdPrice, usdPriceTimestamp, prices, priceTimestamps, currency, price } = data
 
     if (blockIndex[block.number]) {
       console.log('repeat', block.number);
@@ -160,6 +168,11 @@ const CreateMemoryIndex = (initialData: InitialData): InMemoryIndex => {
     details.clients = clients
     details.version = version
     details.usdPrice = usdPrice
+    details.usdPriceTimestamp = usdPriceTimestamp
+    details.prices = prices || {}
+    details.priceTimestamps = priceTimestamps || {}
+    details.currency = currency
+    details.price = price
     session.blockCount = session.blockCount + 1
     session.transactionCount = session.transactionCount + block.transactions
     session.minBaseFee = session.minBaseFee ? BigNumberMin(block.baseFee, session.minBaseFee) : block.baseFee
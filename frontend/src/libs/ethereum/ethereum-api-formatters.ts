@@ -25,6 +25,9 @@ export class EthereumApiFormatters {
     b.baseFee = HexToBigNumber(b.baseFee)
     b.priorityFee = HexToBigNumber(b.priorityFee)
     b.burned = HexToBigNumber(b.burned)
+    b.blobBaseFee = HexToBigNumber(b.blobBaseFee)
+    b.blobBurned = HexToBigNumber(b.blobBurned)
+    b.blobGasUsed = HexToBigNumber(b.blobGasUsed)
     b.gasTarget = HexToBigNumber(b.gasTarget)
     b.gasUsed = HexToBigNumber(b.gasUsed)
     b.rewards = HexToBigNumber(b.rewards)
@@ -33,6 +36,7 @@ export class EthereumApiFormatters {
     b.timestamp = HexToNumber(b.timestamp)
     b.transactions = HexToNumber(b.transactions)
     b.type2transactions = HexToNumber(b.type2transactions)
+    b.type3transactions = HexToNumber(b.type3transactions)
     return b
   }
 
@@ -52,9 +56,16 @@ export class EthereumApiFormatters {
 
   static FormatTotals(s: Totals): Totals {
     s.burned = HexToBigNumber(s.burned)
+    s.blobBurned = HexToBigNumber(s.blobBurned)
     s.rewards = HexToBigNumber(s.rewards)
     s.tips = HexToBigNumber(s.tips)
     s.issuance = HexToBigNumber(s.issuance)
+    s.burnedUSD = HexToBigNumber(s.burnedUSD)
+    s.issuanceUSD = HexToBigNumber(s.issuanceUSD)
+    s.tipsUSD = HexToBigNumber(s.tipsUSD)
+    if (s.supply) {
+      s.supply = HexToBigNumber(s.supply)
+    }
     s.netReduction = caclulateNetReduction(s.burned, s.issuance)
     return s
   }
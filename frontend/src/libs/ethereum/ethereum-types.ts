@@ -12,6 +12,9 @@ export interface BlockStats {
   baseFee: BigNumber
   priorityFee: BigNumber
   burned: BigNumber
+  blobBaseFee: BigNumber
+  blobBurned: BigNumber
+  blobGasUsed: BigNumber
   gasTarget: BigNumber
   gasUsed: BigNumber
   rewards: BigNumber
@@ -20,6 +23,9 @@ export interface BlockStats {
   timestamp: number
   transactions: number
   type2transactions: number
+  type3transactions: number
+  // ETH/USD price when the block was produced, 0 if it is not known
+  usdPrice: number
 }
 
 export interface BaseBlock {
@@ -59,9 +65,16 @@ export interface Totals {
   baseFee: number
   baseFeePercentiles: Percentiles
   burned: BigNumber
+  blobBurned: BigNumber
   rewards: BigNumber
   tips: BigNumber
   issuance: BigNumber
+  // valued at the price of each block, in 1e-18 dollars like the amounts in wei
+  burnedUSD: BigNumber
+  issuanceUSD: BigNumber
+  tipsUSD: BigNumber
+  // genesis supply plus the issuance, only in the totals since london
+  supply?: BigNumber
   netReduction: number
 }
 
@@ -78,6 +91,14 @@ export interface BaseData {
   totalsMonth: Totals
   version: string
   usdPrice: number
+  // unix time the price was last updated at, 0 if it has never been
+  usdPriceTimestamp: number
+  // prices and the unix time they were last updated at by quote currency
+  prices: { [currency: string]: number }
+  priceTimestamps: { [currency: string]: number }
+  // quote currency requested by the client and the price in it
+  currency?: string
+  price?: number
 }
 
 export interface InitialData extends BaseData {
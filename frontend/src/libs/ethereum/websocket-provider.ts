@@ -44,6 +44,20 @@ interface AsyncMessage<T> {
     subscription: string
   }
   result?: string
+  error?: {
+    code: number
+    message: string
+    data?: unknown
+  }
+}
+
+/**
+ * Defines a JSON-RPC error response, the codes are listed in the daemon's hub/jsonrpc.go.
+ */
+export class JsonRpcError extends Error {
+  constructor(public code: number, message: string, public data?: unknown) {
+    super(message)
+  }
 }
 
 // TODO: This is for the V7 upgrade, wait till we have a new version of @types/lru-cache
@@ -216,8 +230,12 @@ export class WebSocketProvider<EventMap extends WebSocketEventMap> extends WebSo
     }
 
     if (eventData.id) {
-      const [resolve,] = this.promiseMap[eventData.id]
-      resolve(eventData.result !== undefined ? eventData.result : eventData.params?.result)
+      const [resolve, reject] = this.promiseMap[eventData.id]
+      if (eventData.error) {
+        reject(new JsonRpcError(eventData.error.code, eventData.error.message, eventData.error.data))
+      } else {
+        resolve(eventData.result !== undefined ? eventData.result : eventData.params?.result)
+      }
       delete this.promiseMap[eventData.id]
     } else if (eventData.method === 'eth_subscription') {
       if (!eventData.params) {
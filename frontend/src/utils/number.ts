@@ -9,7 +9,7 @@ export function BigNumberMax(x: BigNumber, y: BigNumber): BigNumber {
 }
 
 export function HexToBigNumber(num: any): BigNumber {
-  if (num === null || num === undefined) {
+  if (num === null || num === undefined || num === "") {
     return BigNumber.from(0);
   }
   return BigNumber.from(num);
@@ -1,7 +1,12 @@
 create table block_stats (
 	number			INTEGER PRIMARY KEY,
 	timestamp		INTEGER,
+	hash			TEXT,
+	parent_hash		TEXT,
 	base_fee		NUMERIC(256),
+	blob_base_fee		NUMERIC(256),
+	blob_burned		NUMERIC(256),
+	blob_gas_used		BIGINT,
 	burned			NUMERIC(256),
 	gas_target		INTEGER,
 	gas_used		INTEGER,
@@ -10,9 +15,14 @@ create table block_stats (
 	rewards			NUMERIC(256),
 	tips			NUMERIC(256),
 	transactions		INTEGER,
-	type2_transactions	INTEGER
+	type2_transactions	INTEGER,
+	type3_transactions	INTEGER,
+	usd_price		DOUBLE PRECISION DEFAULT 0,
+	updated_at		BIGINT DEFAULT 0
 );
 
+CREATE INDEX idx_block_stats_updated_at ON block_stats (updated_at);
+
 CREATE FUNCTION eth(numeric) RETURNS numeric
     AS 'select $1 / 1000000000000000000;'
     LANGUAGE SQL
@@ -7,7 +7,6 @@ import (
 	"math/big"
 	"time"
 
-	"github.com/ethereum/go-ethereum/common/hexutil"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 
@@ -81,7 +80,7 @@ func main() {
 	fmt.Printf("Starting from block number %d\n", count)
 
 	// Get all the blocks after the latest block stored.
-	rows, err := sqliteDb.Query("SELECT * FROM block_stats WHERE number > $1", count)
+	rows, err := sqliteDb.Query("SELECT number, timestamp, base_fee, burned, gas_target, gas_used, priority_fee, rewards, tips, transactions, type2_transactions FROM block_stats WHERE number > $1", count)
 	if err != nil {
 		panic(err)
 	}
@@ -103,10 +102,7 @@ func main() {
 			panic(err)
 		}
 
-		blockstats, err := decodeBlockStats(cl)
-		if err != nil {
-			panic(err)
-		}
+		blockstats := decodeBlockStats(cl)
 
 		_, psErr := txn.Exec(insertStatement,
 			blockstats.Number,
@@ -174,71 +170,26 @@ type WatchTheBurnBlockStat struct {
 	Type2Transactions uint64
 }
 
-func decodeBlockStats(block watchtheburn.BlockStats) (*WatchTheBurnBlockStat, error) {
-	baseFee, err := hexutil.DecodeBig(block.BaseFee)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode BaseFee: %v", err)
-	}
-
-	burned, err := hexutil.DecodeBig(block.Burned)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode Burned: %v", err)
-	}
-
-	gasTarget, err := hexutil.DecodeUint64(block.GasTarget)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode GasTarget: %v", err)
-	}
-
-	gasUsed, err := hexutil.DecodeUint64(block.GasUsed)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode GasUsed: %v", err)
-	}
-
-	priorityFee, err := hexutil.DecodeBig(block.PriorityFee)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode PriorityFee: %v", err)
-	}
-
-	rewards, err := hexutil.DecodeBig(block.Rewards)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode Rewards: %v", err)
-	}
-
-	tips, err := hexutil.DecodeBig(block.Tips)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode Tips: %v", err)
-	}
-
-	transactions, err := hexutil.DecodeUint64(block.Transactions)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode Transactions: %v", err)
-	}
-
-	type2Transactions, err := hexutil.DecodeUint64(block.Type2Transactions)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode Type2Transactions: %v", err)
-	}
-
+func decodeBlockStats(block watchtheburn.BlockStats) *WatchTheBurnBlockStat {
 	var gasUsedPercentage float64
-	if gasTarget == 0 {
+	if block.GasTarget == 0 {
 		gasUsedPercentage = 0.0
 	} else {
-		gasUsedPercentage = float64(gasUsed) / float64(gasTarget*2) * 100
+		gasUsedPercentage = float64(block.GasUsed) / float64(block.GasTarget*2) * 100
 	}
 
 	return &WatchTheBurnBlockStat{
 		Number:            block.Number,
-		BaseFee:           *baseFee,
-		Burned:            *burned,
-		GasTarget:         gasTarget,
-		GasUsed:           gasUsed,
-		PriorityFee:       *priorityFee,
-		Rewards:           *rewards,
-		Tips:              *tips,
-		Transactions:      transactions,
-		Type2Transactions: type2Transactions,
+		BaseFee:           *block.BaseFee.ToInt(),
+		Burned:            *block.Burned.ToInt(),
+		GasTarget:         uint64(block.GasTarget),
+		GasUsed:           uint64(block.GasUsed),
+		PriorityFee:       *block.PriorityFee.ToInt(),
+		Rewards:           *block.Rewards.ToInt(),
+		Tips:              *block.Tips.ToInt(),
+		Transactions:      uint64(block.Transactions),
+		Type2Transactions: uint64(block.Type2Transactions),
 		Timestamp:         block.Timestamp,
 		GasUsedPercentage: gasUsedPercentage,
-	}, nil
+	}
 }